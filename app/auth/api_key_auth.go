@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"backend/app/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/guregu/null.v4"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// APIKeyPrefix starts every api key so that leaked keys are easy to recognize
+const APIKeyPrefix = "dk_"
+
+// last_used_at is only written once per interval to avoid a write on every request
+const apiKeyUsageInterval = time.Minute
+
+type CreateAPIKeyData struct {
+	Name      string             `json:"name"`
+	Scope     models.APIKeyScope `json:"scope"`
+	ExpiresAt null.Time          `json:"expires_at"`
+}
+
+// CreateAPIKey returns the new key along with the only copy of the plain key
+func (a *TokenAuth) CreateAPIKey(user *models.User, data *CreateAPIKeyData) (*models.APIKey, string, error) {
+	if strings.TrimSpace(data.Name) == "" {
+		return nil, "", fmt.Errorf("%w: the name is required", ErrInvalidAPIKey)
+	}
+
+	if data.Scope.IsValid() != nil {
+		return nil, "", fmt.Errorf("%w: unknown scope %q", ErrInvalidAPIKey, data.Scope)
+	}
+
+	if data.Scope == models.AdminScope && user.Role != models.AdminRole {
+		return nil, "", fmt.Errorf("%w: only admins can create admin keys", ErrInvalidAPIKey)
+	}
+
+	if data.ExpiresAt.Valid && !data.ExpiresAt.Time.After(time.Now()) {
+		return nil, "", fmt.Errorf("%w: the expiry must be in the future", ErrInvalidAPIKey)
+	}
+
+	randomKey := make([]byte, 32)
+	if _, randomErr := rand.Read(randomKey); randomErr != nil {
+		return nil, "", randomErr
+	}
+	plainKey := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(randomKey)
+
+	apiKey := &models.APIKey{
+		UserID:    user.ID,
+		Name:      data.Name,
+		Prefix:    plainKey[:len(APIKeyPrefix)+8],
+		KeyHash:   hashAPIKey(plainKey),
+		Scope:     data.Scope,
+		ExpiresAt: data.ExpiresAt,
+	}
+
+	if result := a.DB.Create(apiKey); result.Error != nil {
+		return nil, "", result.Error
+	}
+
+	return apiKey, plainKey, nil
+}
+
+func (a *TokenAuth) GetAPIKeys(userId uint) ([]*models.APIKey, error) {
+	apiKeys := []*models.APIKey{}
+	if result := a.DB.Where("user_id = ?", userId).Order("id").Find(&apiKeys); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return apiKeys, nil
+}
+
+// RevokeAPIKey deletes a key of the user, revoked keys stop working immediately
+func (a *TokenAuth) RevokeAPIKey(userId uint, apiKeyId uint) error {
+	result := a.DB.Where("user_id = ?", userId).Delete(&models.APIKey{}, apiKeyId)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (a *TokenAuth) CheckAPIKey(key string) (*models.User, *models.APIKey, error) {
+	apiKey := &models.APIKey{}
+	if result := a.DB.Preload("User").First(apiKey, "key_hash = ?", hashAPIKey(key)); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidToken
+		}
+		return nil, nil, result.Error
+	}
+
+	now := time.Now()
+	if apiKey.ExpiresAt.Valid && apiKey.ExpiresAt.Time.Before(now) {
+		return nil, nil, ErrTokenExpired
+	}
+
+	if !apiKey.LastUsedAt.Valid || apiKey.LastUsedAt.Time.Before(now.Add(-apiKeyUsageInterval)) {
+		if result := a.DB.Model(apiKey).UpdateColumn("last_used_at", now); result.Error != nil {
+			return nil, nil, result.Error
+		}
+	}
+
+	return &apiKey.User, apiKey, nil
+}
+
+func hashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
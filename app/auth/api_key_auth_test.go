@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"backend/app/models"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/guregu/null.v4"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupDBForAPIKeyTests(t *testing.T) (*gorm.DB, func() error) {
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+
+	if err != nil {
+		t.Fatalf("failed to open sqlite connection: %v", err)
+	}
+
+	if migrationErr := db.AutoMigrate(&models.User{}, &models.APIKey{}); migrationErr != nil {
+		t.Fatalf("failed to migrate: %v", migrationErr)
+	}
+
+	sqlDB, sqlErr := db.DB()
+	if sqlErr != nil {
+		t.Fatalf("failed to obtain SQL DB: %v", sqlErr)
+	}
+	return db, sqlDB.Close
+}
+
+func TestCreateAndCheckAPIKey(t *testing.T) {
+	db, cleanup := setupDBForAPIKeyTests(t)
+	defer cleanup()
+	tokenAuth := NewTokenAuth(db)
+
+	user, userErr := NewUserAuth(db).CreateUser("email@email.com", "password", models.AnnotatorRole)
+	if userErr != nil {
+		t.Fatalf("failed to create user: %v", userErr)
+	}
+
+	apiKey, plainKey, keyErr := tokenAuth.CreateAPIKey(user, &CreateAPIKeyData{Name: "ci", Scope: models.AnnotateScope})
+	if keyErr != nil {
+		t.Fatalf("failed to create api key: %v", keyErr)
+	}
+
+	if !strings.HasPrefix(plainKey, apiKey.Prefix) || apiKey.KeyHash == plainKey {
+		t.Fatalf("the key should only be stored hashed")
+	}
+
+	authenticatedUser, checkedKey, authErr := tokenAuth.CheckAPIKey(plainKey)
+	if authErr != nil {
+		t.Fatalf("failed to check api key: %v", authErr)
+	}
+
+	if authenticatedUser.ID != user.ID || checkedKey.Scope != models.AnnotateScope {
+		t.Fatalf("unexpected user or scope: %v %v", authenticatedUser.ID, checkedKey.Scope)
+	}
+
+	if _, _, authErr := tokenAuth.CheckAPIKey(plainKey + "x"); !errors.Is(authErr, ErrInvalidToken) {
+		t.Fatalf("unexpected error returned: %v", authErr)
+	}
+
+	if revokeErr := tokenAuth.RevokeAPIKey(user.ID+1, apiKey.ID); !errors.Is(revokeErr, gorm.ErrRecordNotFound) {
+		t.Fatalf("only the owner should revoke a key: %v", revokeErr)
+	}
+
+	if revokeErr := tokenAuth.RevokeAPIKey(user.ID, apiKey.ID); revokeErr != nil {
+		t.Fatalf("failed to revoke api key: %v", revokeErr)
+	}
+
+	if _, _, authErr := tokenAuth.CheckAPIKey(plainKey); !errors.Is(authErr, ErrInvalidToken) {
+		t.Fatalf("revoked keys should be rejected: %v", authErr)
+	}
+}
+
+func TestCheckExpiredAPIKey(t *testing.T) {
+	db, cleanup := setupDBForAPIKeyTests(t)
+	defer cleanup()
+	tokenAuth := NewTokenAuth(db)
+
+	user, userErr := NewUserAuth(db).CreateUser("email@email.com", "password", models.AdminRole)
+	if userErr != nil {
+		t.Fatalf("failed to create user: %v", userErr)
+	}
+
+	apiKey, plainKey, keyErr := tokenAuth.CreateAPIKey(user, &CreateAPIKeyData{Name: "ci", Scope: models.AdminScope, ExpiresAt: null.TimeFrom(time.Now().Add(time.Hour))})
+	if keyErr != nil {
+		t.Fatalf("failed to create api key: %v", keyErr)
+	}
+
+	if result := db.Model(apiKey).Update("expires_at", time.Now().Add(-time.Hour)); result.Error != nil {
+		t.Fatalf("failed to update api key expiration time: %v", result.Error)
+	}
+
+	if _, _, authErr := tokenAuth.CheckAPIKey(plainKey); !errors.Is(authErr, ErrTokenExpired) {
+		t.Fatalf("unexpected error returned: %v", authErr)
+	}
+}
+
+func TestCreateInvalidAPIKeys(t *testing.T) {
+	db, cleanup := setupDBForAPIKeyTests(t)
+	defer cleanup()
+	tokenAuth := NewTokenAuth(db)
+
+	user, userErr := NewUserAuth(db).CreateUser("email@email.com", "password", models.AnnotatorRole)
+	if userErr != nil {
+		t.Fatalf("failed to create user: %v", userErr)
+	}
+
+	invalidKeys := []*CreateAPIKeyData{
+		{Scope: models.ReadOnlyScope},
+		{Name: "ci", Scope: "write"},
+		{Name: "ci", Scope: models.AdminScope},
+		{Name: "ci", Scope: models.ReadOnlyScope, ExpiresAt: null.TimeFrom(time.Now().Add(-time.Minute))},
+	}
+
+	for _, data := range invalidKeys {
+		if _, _, keyErr := tokenAuth.CreateAPIKey(user, data); !errors.Is(keyErr, ErrInvalidAPIKey) {
+			t.Fatalf("unexpected error returned for %v: %v", data, keyErr)
+		}
+	}
+}
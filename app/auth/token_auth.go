@@ -95,6 +95,79 @@ func (a *TokenAuth) RefreshToken(token string) (*models.AuthToken, error) {
 	return a.CreateAuthToken(&authToken.User)
 }
 
+// Session describes an auth token of a user without its secrets
+type Session struct {
+	ID               uint      `json:"id"`
+	CreatedAt        time.Time `json:"created_at"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+	Current          bool      `json:"current"`
+}
+
+// GetSessions lists the auth tokens of the user that can still be used or refreshed,
+// the one matching currentToken is marked as current
+func (a *TokenAuth) GetSessions(userId uint, currentToken string) ([]*Session, error) {
+	var authTokens []*models.AuthToken
+	now := time.Now()
+	result := a.DB.Preload("RefreshToken").
+		Where("user_id = ?", userId).
+		Where("expires_at > ? OR EXISTS (SELECT 1 FROM refresh_tokens WHERE refresh_tokens.auth_token_id = auth_tokens.id AND refresh_tokens.expires_at > ? AND refresh_tokens.deleted_at IS NULL)", now, now).
+		Order("created_at desc").
+		Find(&authTokens)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	sessions := make([]*Session, len(authTokens))
+	for i, authToken := range authTokens {
+		sessions[i] = &Session{
+			ID:               authToken.ID,
+			CreatedAt:        authToken.CreatedAt,
+			ExpiresAt:        authToken.ExpiresAt,
+			RefreshExpiresAt: authToken.RefreshToken.ExpiresAt,
+			Current:          currentToken != "" && authToken.Token == currentToken,
+		}
+	}
+
+	return sessions, nil
+}
+
+// RevokeAuthToken deletes the auth token and its refresh token, unknown tokens are already revoked
+func (a *TokenAuth) RevokeAuthToken(token string) error {
+	return a.DB.Transaction(func(tx *gorm.DB) error {
+		authToken := &models.AuthToken{}
+		if result := tx.First(authToken, "token = ?", token); result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return result.Error
+		}
+
+		if result := tx.Where("auth_token_id = ?", authToken.ID).Delete(&models.RefreshToken{}); result.Error != nil {
+			return result.Error
+		}
+
+		return tx.Delete(authToken).Error
+	})
+}
+
+// RevokeUserTokens deletes all the auth and refresh tokens of the user and returns the number of revoked sessions
+func (a *TokenAuth) RevokeUserTokens(userId uint) (int64, error) {
+	var revoked int64
+	txErr := a.DB.Transaction(func(tx *gorm.DB) error {
+		userTokens := tx.Model(&models.AuthToken{}).Select("id").Where("user_id = ?", userId)
+		if result := tx.Where("auth_token_id IN (?)", userTokens).Delete(&models.RefreshToken{}); result.Error != nil {
+			return result.Error
+		}
+
+		result := tx.Where("user_id = ?", userId).Delete(&models.AuthToken{})
+		revoked = result.RowsAffected
+		return result.Error
+	})
+
+	return revoked, txErr
+}
+
 func (a *TokenAuth) CreateAuthCookies(authToken *models.AuthToken) (*http.Cookie, *http.Cookie) {
 	now := time.Now()
 	authTokenCookie := &http.Cookie{
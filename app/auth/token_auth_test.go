@@ -279,3 +279,97 @@ func TestCreateLogoutCookies(t *testing.T) {
 		t.Fatalf("refresh token cookie max age should be -1, got %v", refreshTokenCookie.MaxAge)
 	}
 }
+
+func TestRevokeAuthToken(t *testing.T) {
+	db, cleanup := setupDBForTokenTests(t)
+	defer cleanup()
+	tokenAuth := NewTokenAuth(db)
+
+	userAuth := NewUserAuth(db)
+	user, userErr := userAuth.CreateUser("email@email.com", "password", models.AdminRole)
+	if userErr != nil {
+		t.Fatalf("failed to create user: %v", userErr)
+	}
+
+	authToken, tokenErr := tokenAuth.CreateAuthToken(user)
+	if tokenErr != nil {
+		t.Fatalf("failed to create auth token: %v", tokenErr)
+	}
+
+	otherToken, tokenErr := tokenAuth.CreateAuthToken(user)
+	if tokenErr != nil {
+		t.Fatalf("failed to create auth token: %v", tokenErr)
+	}
+
+	if revokeErr := tokenAuth.RevokeAuthToken(authToken.Token); revokeErr != nil {
+		t.Fatalf("failed to revoke auth token: %v", revokeErr)
+	}
+
+	if _, authErr := tokenAuth.CheckAuthToken(authToken.Token); !errors.Is(authErr, ErrInvalidToken) {
+		t.Fatalf("revoked auth token should be rejected: %v", authErr)
+	}
+
+	if _, refreshErr := tokenAuth.RefreshToken(authToken.RefreshToken.Token); !errors.Is(refreshErr, gorm.ErrRecordNotFound) {
+		t.Fatalf("revoked refresh token should be rejected: %v", refreshErr)
+	}
+
+	sessions, sessionsErr := tokenAuth.GetSessions(user.ID, otherToken.Token)
+	if sessionsErr != nil {
+		t.Fatalf("failed to get sessions: %v", sessionsErr)
+	}
+
+	if len(sessions) != 1 || sessions[0].ID != otherToken.ID || !sessions[0].Current {
+		t.Fatalf("only the other session should be listed as current: %v", sessions)
+	}
+
+	if revokeErr := tokenAuth.RevokeAuthToken("unknown token"); revokeErr != nil {
+		t.Fatalf("revoking an unknown token should do nothing: %v", revokeErr)
+	}
+}
+
+func TestRevokeUserTokens(t *testing.T) {
+	db, cleanup := setupDBForTokenTests(t)
+	defer cleanup()
+	tokenAuth := NewTokenAuth(db)
+
+	userAuth := NewUserAuth(db)
+	user, userErr := userAuth.CreateUser("email@email.com", "password", models.AdminRole)
+	if userErr != nil {
+		t.Fatalf("failed to create user: %v", userErr)
+	}
+
+	otherUser, userErr := userAuth.CreateUser("other@email.com", "password", models.AnnotatorRole)
+	if userErr != nil {
+		t.Fatalf("failed to create user: %v", userErr)
+	}
+
+	for _, owner := range []*models.User{user, user, otherUser} {
+		if _, tokenErr := tokenAuth.CreateAuthToken(owner); tokenErr != nil {
+			t.Fatalf("failed to create auth token: %v", tokenErr)
+		}
+	}
+
+	revoked, revokeErr := tokenAuth.RevokeUserTokens(user.ID)
+	if revokeErr != nil {
+		t.Fatalf("failed to revoke tokens: %v", revokeErr)
+	}
+
+	if revoked != 2 {
+		t.Fatalf("expected 2 revoked sessions, got %v", revoked)
+	}
+
+	var refreshTokenCount int64 = 0
+	db.Model(&models.RefreshToken{}).Count(&refreshTokenCount)
+	if refreshTokenCount != 1 {
+		t.Fatalf("only the refresh token of the other user should be left, got %v", refreshTokenCount)
+	}
+
+	sessions, sessionsErr := tokenAuth.GetSessions(otherUser.ID, "")
+	if sessionsErr != nil {
+		t.Fatalf("failed to get sessions: %v", sessionsErr)
+	}
+
+	if len(sessions) != 1 || sessions[0].Current {
+		t.Fatalf("the session of the other user should be kept: %v", sessions)
+	}
+}
@@ -48,6 +48,11 @@ func (a *AdminController) Init(router *mux.Router) {
 	adminUserManagementRouter.HandleFunc("/roles/", a.patchUserRole).Methods("PATCH", "OPTIONS")
 	adminUserManagementRouter.HandleFunc("/dataset-perms/", a.postUserDatasetPerm).Methods("POST", "OPTIONS")
 	adminUserManagementRouter.HandleFunc("/dataset-perms/", a.deleteUserDatasetPerm).Methods("DELETE", "OPTIONS")
+	adminUserManagementRouter.HandleFunc("/sessions/", a.deleteUserSessions).Methods("DELETE", "OPTIONS")
+}
+
+type RevokedSessionsResponse struct {
+	RevokedSessions int64 `json:"revoked_sessions"`
 }
 
 func (a *AdminController) getUsers(w http.ResponseWriter, r *http.Request) {
@@ -135,3 +140,16 @@ func (a *AdminController) deleteUserDatasetPerm(w http.ResponseWriter, r *http.R
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func (a *AdminController) deleteUserSessions(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(middlewares.UserIdContextKey).(int)
+
+	revoked, revokeErr := a.tokenAuth.RevokeUserTokens(uint(userId))
+	if revokeErr != nil {
+		utils.HandleCommonErrors(revokeErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&RevokedSessionsResponse{RevokedSessions: revoked})
+}
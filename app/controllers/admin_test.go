@@ -549,3 +549,39 @@ func TestDeleteUserDatasetPerm(t *testing.T) {
 	is.NoErr(db.Model(&models.UserDataset{}).Count(&count).Error)
 	is.Equal(count, int64(0))
 }
+
+func TestDeleteUserSessions(t *testing.T) {
+	db, cleanup, router := setupAdminController(t)
+	defer cleanup()
+	is := is.New(t)
+
+	users := []models.User{
+		{Email: "user1", Role: models.AdminRole},
+		{Email: "user2", Role: models.AnnotatorRole},
+	}
+	is.NoErr(db.Create(&users).Error)
+
+	tokenAuth := auth.NewTokenAuth(db)
+	authToken, tokenErr := tokenAuth.CreateAuthToken(&users[0])
+	is.NoErr(tokenErr)
+	authCookie, _ := tokenAuth.CreateAuthCookies(authToken)
+	annotatorToken, tokenErr := tokenAuth.CreateAuthToken(&users[1])
+	is.NoErr(tokenErr)
+
+	url := fmt.Sprintf("/users/%v/sessions/", users[1].ID)
+	req := httptest.NewRequest("DELETE", url, nil)
+	req.AddCookie(authCookie)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	is.Equal(rr.Code, http.StatusOK)
+
+	response := &RevokedSessionsResponse{}
+	is.NoErr(json.NewDecoder(rr.Body).Decode(response))
+	is.Equal(response.RevokedSessions, int64(1))
+
+	_, authErr := tokenAuth.CheckAuthToken(annotatorToken.Token)
+	is.True(authErr != nil)
+
+	_, authErr = tokenAuth.CheckAuthToken(authToken.Token)
+	is.NoErr(authErr)
+}
@@ -5,6 +5,7 @@ import (
 	utils "backend/app/controllers/utils"
 	"backend/app/handlers"
 	"backend/app/middlewares"
+	"backend/app/models"
 	"encoding/json"
 	"errors"
 	"log"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
+	"gorm.io/gorm"
 )
 
 type RegisterRequest struct {
@@ -46,6 +48,7 @@ func (a *AuthController) Init(router *mux.Router) {
 	router.HandleFunc("/login/", a.login).Methods("POST", "OPTIONS")
 	router.HandleFunc("/refresh-token/", a.refreshToken).Methods("POST", "OPTIONS")
 	router.Handle("/logout/", authTokenMiddleware(http.HandlerFunc(a.logout))).Methods("POST", "OPTIONS")
+	router.Handle("/logout-all/", authTokenMiddleware(middlewares.SessionOnlyMiddleware(http.HandlerFunc(a.logoutAll)))).Methods("POST", "OPTIONS")
 }
 
 func (a *AuthController) login(w http.ResponseWriter, r *http.Request) {
@@ -102,7 +105,30 @@ func (a *AuthController) login(w http.ResponseWriter, r *http.Request) {
 // 	json.NewEncoder(w).Encode(user)
 // }
 
+// logout revokes the tokens of the current session, so that its cookies stop working even if they were copied
 func (a *AuthController) logout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(auth.AuthTokenCookieName); err == nil {
+		if revokeErr := a.tokenAuth.RevokeAuthToken(cookie.Value); revokeErr != nil {
+			utils.HandleCommonErrors(revokeErr, w)
+			return
+		}
+	}
+
+	loggedOutAuthTokenCookie, loggedOutRefreshTokenCookie := a.tokenAuth.CreateLogoutCookies()
+
+	http.SetCookie(w, loggedOutAuthTokenCookie)
+	http.SetCookie(w, loggedOutRefreshTokenCookie)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logoutAll revokes every session of the user
+func (a *AuthController) logoutAll(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middlewares.UserContextKey).(*models.User)
+	if _, revokeErr := a.tokenAuth.RevokeUserTokens(user.ID); revokeErr != nil {
+		utils.HandleCommonErrors(revokeErr, w)
+		return
+	}
+
 	loggedOutAuthTokenCookie, loggedOutRefreshTokenCookie := a.tokenAuth.CreateLogoutCookies()
 
 	http.SetCookie(w, loggedOutAuthTokenCookie)
@@ -119,7 +145,12 @@ func (a *AuthController) refreshToken(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCookies, loginErr := a.authHandler.RefreshToken(cookie.Value)
-	if loginErr != nil {
+	if errors.Is(loginErr, gorm.ErrRecordNotFound) || errors.Is(loginErr, auth.ErrTokenExpired) {
+		// the session has expired or has been revoked
+		w.WriteHeader(http.StatusUnauthorized)
+		utils.WriteError(errors.New("Unauthorized"), w)
+		return
+	} else if loginErr != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		log.Panic(loginErr)
 		return
@@ -167,6 +167,48 @@ func TestLogout(t *testing.T) {
 	responseRefreshCookie := getCookieByName(cookies, auth.RefreshTokenCookieName)
 	is.Equal(responseRefreshCookie.Value, "")
 	is.Equal(responseRefreshCookie.MaxAge, -1)
+
+	// the old cookie no longer works
+	req = httptest.NewRequest("POST", "/logout/", nil)
+	req.AddCookie(authCookie)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	is.Equal(rr.Code, http.StatusUnauthorized)
+}
+
+func TestLogoutEverywhere(t *testing.T) {
+	db, cleanup, router := setupAuthController(t)
+	defer cleanup()
+	is := is.New(t)
+
+	admin := models.User{Email: "user2", Role: models.AdminRole}
+	is.NoErr(db.Create(&admin).Error)
+
+	tokenAuth := auth.NewTokenAuth(db)
+	authToken, tokenErr := tokenAuth.CreateAuthToken(&admin)
+	is.NoErr(tokenErr)
+	authCookie, _ := tokenAuth.CreateAuthCookies(authToken)
+	otherToken, tokenErr := tokenAuth.CreateAuthToken(&admin)
+	is.NoErr(tokenErr)
+	otherAuthCookie, otherRefreshCookie := tokenAuth.CreateAuthCookies(otherToken)
+
+	req := httptest.NewRequest("POST", "/logout-all/", nil)
+	req.AddCookie(authCookie)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	is.Equal(rr.Code, http.StatusNoContent)
+
+	req = httptest.NewRequest("POST", "/logout/", nil)
+	req.AddCookie(otherAuthCookie)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	is.Equal(rr.Code, http.StatusUnauthorized)
+
+	req = httptest.NewRequest("POST", "/refresh-token/", nil)
+	req.AddCookie(otherRefreshCookie)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	is.Equal(rr.Code, http.StatusUnauthorized)
 }
 
 func TestRefreshTokenWithoutCookiesSet(t *testing.T) {
@@ -6,17 +6,23 @@ import (
 	"backend/app/handlers"
 	"backend/app/middlewares"
 	"backend/app/models"
+	dataset_utils "backend/app/utils/dataset"
 	dataset_export "backend/app/utils/dataset/export"
 	dataset_import "backend/app/utils/dataset/import"
+	"backend/app/utils/preannotate"
+	"backend/app/utils/search"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
-	"gorm.io/gorm"
+	"gopkg.in/guregu/null.v4"
 )
 
 type DatasetsController struct {
@@ -24,16 +30,26 @@ type DatasetsController struct {
 	datasetsHandler         *handlers.DatasetsHandler
 	samplesHandler          *handlers.SamplesHandler
 	userDatasetPermsHandler *handlers.UserDatasetPermsHandler
-	db                      *gorm.DB
+	datasetImportHandler    *handlers.DatasetImportHandler
+	agreementHandler        *handlers.AgreementHandler
+	searchHandler           *handlers.SearchHandler
+	tagsHandler             *handlers.TagsHandler
+	preAnnotationHandler    *handlers.PreAnnotationHandler
+	labelingRulesHandler    *handlers.LabelingRulesHandler
 }
 
-func NewDatasetsController(tokenAuth *auth.TokenAuth, datasetsHandler *handlers.DatasetsHandler, samplesHandler *handlers.SamplesHandler, userDatasetPermsHandler *handlers.UserDatasetPermsHandler, db *gorm.DB) *DatasetsController {
+func NewDatasetsController(tokenAuth *auth.TokenAuth, datasetsHandler *handlers.DatasetsHandler, samplesHandler *handlers.SamplesHandler, userDatasetPermsHandler *handlers.UserDatasetPermsHandler, datasetImportHandler *handlers.DatasetImportHandler, agreementHandler *handlers.AgreementHandler, searchHandler *handlers.SearchHandler, tagsHandler *handlers.TagsHandler, preAnnotationHandler *handlers.PreAnnotationHandler, labelingRulesHandler *handlers.LabelingRulesHandler) *DatasetsController {
 	return &DatasetsController{
 		tokenAuth:               tokenAuth,
 		datasetsHandler:         datasetsHandler,
 		samplesHandler:          samplesHandler,
 		userDatasetPermsHandler: userDatasetPermsHandler,
-		db:                      db,
+		datasetImportHandler:    datasetImportHandler,
+		agreementHandler:        agreementHandler,
+		searchHandler:           searchHandler,
+		tagsHandler:             tagsHandler,
+		preAnnotationHandler:    preAnnotationHandler,
+		labelingRulesHandler:    labelingRulesHandler,
 	}
 }
 
@@ -43,19 +59,50 @@ func (d *DatasetsController) Init(router *mux.Router) {
 
 	router.HandleFunc("/", d.getDatasets).Methods("GET", "OPTIONS")
 	router.Handle("/", middlewares.IsAdminMiddleware(http.HandlerFunc(d.postDataset))).Methods("POST", "OPTIONS")
+	router.HandleFunc("/search/", d.searchDatasets).Methods("GET", "OPTIONS")
 
 	datasetRouter := router.PathPrefix("/{datasetId:[0-9]+}").Subrouter()
 	datasetPermsMiddleware := middlewares.GetDatasetPermsMiddleware(d.userDatasetPermsHandler)
 	datasetRouter.Use(middlewares.ParseDatasetIdMiddleware, datasetPermsMiddleware)
 
 	datasetRouter.HandleFunc("/", d.getDataset).Methods("GET", "OPTIONS")
+	datasetRouter.Handle("/", middlewares.IsAdminMiddleware(http.HandlerFunc(d.patchDataset))).Methods("PATCH", "OPTIONS")
 	datasetRouter.Handle("/", middlewares.IsAdminMiddleware(http.HandlerFunc(d.deleteDataset))).Methods("DELETE", "OPTIONS")
 	datasetRouter.Handle("/export/", middlewares.IsAdminMiddleware(http.HandlerFunc(d.exportDataset))).Methods("GET", "OPTIONS")
+	datasetRouter.Handle("/preannotate/", middlewares.IsAdminMiddleware(http.HandlerFunc(d.preAnnotateDataset))).Methods("POST", "OPTIONS")
+	datasetRouter.Handle("/rules/", middlewares.IsAdminMiddleware(http.HandlerFunc(d.getLabelingRules))).Methods("GET", "OPTIONS")
+	datasetRouter.Handle("/rules/", middlewares.IsAdminMiddleware(http.HandlerFunc(d.postLabelingRule))).Methods("POST", "OPTIONS")
+	datasetRouter.Handle("/rules/apply/", middlewares.IsAdminMiddleware(http.HandlerFunc(d.applyLabelingRules))).Methods("POST", "OPTIONS")
+	datasetRouter.Handle("/rules/{ruleId:[0-9]+}/", middlewares.IsAdminMiddleware(http.HandlerFunc(d.putLabelingRule))).Methods("PUT", "OPTIONS")
+	datasetRouter.Handle("/rules/{ruleId:[0-9]+}/", middlewares.IsAdminMiddleware(http.HandlerFunc(d.deleteLabelingRule))).Methods("DELETE", "OPTIONS")
+	datasetRouter.Handle("/agreement/", middlewares.IsAdminMiddleware(http.HandlerFunc(d.getAgreement))).Methods("GET", "OPTIONS")
+	datasetRouter.HandleFunc("/search/", d.searchDataset).Methods("GET", "OPTIONS")
+	datasetRouter.HandleFunc("/tags/", d.getTags).Methods("GET", "OPTIONS")
+	datasetRouter.Handle("/tags/{kind:entity|relationship}/", middlewares.IsAdminMiddleware(http.HandlerFunc(d.postTag))).Methods("POST", "OPTIONS")
+	datasetRouter.Handle("/tags/{kind:entity|relationship}/{name}/", middlewares.IsAdminMiddleware(http.HandlerFunc(d.putTag))).Methods("PUT", "OPTIONS")
+	datasetRouter.Handle("/tags/{kind:entity|relationship}/{name}/", middlewares.IsAdminMiddleware(http.HandlerFunc(d.deleteTag))).Methods("DELETE", "OPTIONS")
+	datasetRouter.Handle("/tags/{kind:entity|relationship}/{name}/merge/", middlewares.IsAdminMiddleware(http.HandlerFunc(d.mergeTag))).Methods("POST", "OPTIONS")
 	datasetRouter.HandleFunc("/samples/", d.getSamples).Methods("GET", "OPTIONS")
 	datasetRouter.HandleFunc("/samples/next/", d.assignNextSample).Methods("GET", "OPTIONS")
+	datasetRouter.Handle("/samples/import/", middlewares.IsAdminMiddleware(http.HandlerFunc(d.appendSamples))).Methods("POST", "OPTIONS")
+	datasetRouter.Handle("/samples/priorities/", middlewares.IsAdminMiddleware(http.HandlerFunc(d.updateSamplePriorities))).Methods("POST", "OPTIONS")
+	datasetRouter.Handle("/samples/bulk/", middlewares.IsAdminMiddleware(http.HandlerFunc(d.bulkUpdateSamples))).Methods("POST", "OPTIONS")
+	datasetRouter.HandleFunc("/samples/external/{externalId}/", d.getSampleByExternalId).Methods("GET", "OPTIONS")
 	datasetRouter.HandleFunc("/samples/{status:[a-z]+}/", d.getSamplesWithStatus).Methods("GET", "OPTIONS")
 	datasetRouter.HandleFunc("/samples/{sampleId:[0-9]+}/", d.getSample).Methods("GET", "OPTIONS")
 	datasetRouter.HandleFunc("/samples/{sampleId:[0-9]+}/", d.patchSample).Methods("PATCH", "OPTIONS")
+	datasetRouter.HandleFunc("/samples/{sampleId:[0-9]+}/lease/", d.extendSampleLease).Methods("POST", "OPTIONS")
+	datasetRouter.Handle("/samples/{sampleId:[0-9]+}/diff/", middlewares.IsReviewerMiddleware(http.HandlerFunc(d.diffSample))).Methods("GET", "OPTIONS")
+	datasetRouter.Handle("/samples/{sampleId:[0-9]+}/history/", middlewares.IsAdminMiddleware(http.HandlerFunc(d.getSampleHistory))).Methods("GET", "OPTIONS")
+	datasetRouter.Handle("/samples/{sampleId:[0-9]+}/history/{revisionId:[0-9]+}/restore/", middlewares.IsAdminMiddleware(http.HandlerFunc(d.restoreSampleRevision))).Methods("POST", "OPTIONS")
+
+	reviewRouter := datasetRouter.PathPrefix("/review").Subrouter()
+	reviewRouter.Use(middlewares.IsReviewerMiddleware)
+	reviewRouter.HandleFunc("/", d.getReviewQueue).Methods("GET", "OPTIONS")
+	reviewRouter.HandleFunc("/{sampleId:[0-9]+}/", d.getSampleForReview).Methods("GET", "OPTIONS")
+	reviewRouter.HandleFunc("/{sampleId:[0-9]+}/accept/", d.acceptSample).Methods("POST", "OPTIONS")
+	reviewRouter.HandleFunc("/{sampleId:[0-9]+}/return/", d.returnSample).Methods("POST", "OPTIONS")
+	reviewRouter.HandleFunc("/{sampleId:[0-9]+}/merge/", d.mergeSample).Methods("POST", "OPTIONS")
 }
 
 func (d *DatasetsController) deleteDataset(w http.ResponseWriter, r *http.Request) {
@@ -71,6 +118,13 @@ func (d *DatasetsController) deleteDataset(w http.ResponseWriter, r *http.Reques
 func (d *DatasetsController) exportDataset(w http.ResponseWriter, r *http.Request) {
 	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
 
+	format, formatErr := parseExportFormat(r)
+	if formatErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(formatErr, w)
+		return
+	}
+
 	dataset, datasetErr := d.datasetsHandler.GetDataset(uint(datasetId))
 	if datasetErr != nil {
 		utils.HandleCommonErrors(datasetErr, w)
@@ -83,16 +137,60 @@ func (d *DatasetsController) exportDataset(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	jsonDataset, exportErr := dataset_export.ExportDataset(dataset, samples)
-	if exportErr != nil {
-		utils.HandleCommonErrors(exportErr, w)
-		return
-	}
+	dispositionHeader := fmt.Sprintf("attachment; filename=dataset_%d%s", datasetId, format.FileExtension())
+	switch format {
+	case dataset_utils.ConllFormat:
+		// with the report param only the issues found while converting the spans are returned
+		if r.URL.Query().Get("report") != "" {
+			report, exportErr := dataset_export.ExportDatasetConll(io.Discard, samples)
+			if exportErr != nil {
+				utils.HandleCommonErrors(exportErr, w)
+				return
+			}
 
-	dispositionHeader := fmt.Sprintf("attachment; filename=dataset_%d.json", datasetId)
-	w.Header().Set("Content-Disposition", dispositionHeader)
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(jsonDataset)
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(report)
+			return
+		}
+
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Header().Set("Content-Disposition", dispositionHeader)
+		w.WriteHeader(http.StatusOK)
+		if _, exportErr := dataset_export.ExportDatasetConll(w, samples); exportErr != nil {
+			log.Println(exportErr)
+		}
+	case dataset_utils.JsonlFormat:
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Header().Set("Content-Disposition", dispositionHeader)
+		w.WriteHeader(http.StatusOK)
+		if exportErr := dataset_export.ExportDatasetJsonl(w, dataset, samples); exportErr != nil {
+			log.Println(exportErr)
+		}
+	case dataset_utils.SpacyFormat:
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Header().Set("Content-Disposition", dispositionHeader)
+		w.WriteHeader(http.StatusOK)
+		if exportErr := dataset_export.ExportDatasetSpacy(w, samples); exportErr != nil {
+			log.Println(exportErr)
+		}
+	case dataset_utils.BratFormat:
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Header().Set("Content-Disposition", dispositionHeader)
+		w.WriteHeader(http.StatusOK)
+		if exportErr := dataset_export.ExportDatasetBrat(w, dataset, samples); exportErr != nil {
+			log.Println(exportErr)
+		}
+	default:
+		jsonDataset, exportErr := dataset_export.ExportDataset(dataset, samples)
+		if exportErr != nil {
+			utils.HandleCommonErrors(exportErr, w)
+			return
+		}
+
+		w.Header().Set("Content-Disposition", dispositionHeader)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(jsonDataset)
+	}
 }
 
 func (d *DatasetsController) getDatasets(w http.ResponseWriter, r *http.Request) {
@@ -115,45 +213,158 @@ func (d *DatasetsController) getDatasets(w http.ResponseWriter, r *http.Request)
 }
 
 func (d *DatasetsController) postDataset(w http.ResponseWriter, r *http.Request) {
-	r.ParseMultipartForm(32 << 20)
-	file, _, err := r.FormFile("file")
-	if err != nil {
-		log.Panic(err)
+	user := r.Context().Value(middlewares.UserContextKey).(*models.User)
+
+	reader, file, readerErr := openUploadedDataset(r)
+	if readerErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(readerErr, w)
+		return
 	}
 	defer file.Close()
 
-	jsonDataset, parsingErr := dataset_import.ParseDataset(file)
-	if parsingErr != nil {
-		log.Panic(parsingErr)
+	preAnnotator, preAnnotatorErr := d.parsePreAnnotator(r)
+	if preAnnotatorErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(preAnnotatorErr, w)
+		return
+	}
+
+	report, importErr := d.datasetImportHandler.ImportDataset(reader, user.ID, preAnnotator)
+	if importErr != nil {
+		if errors.Is(importErr, dataset_import.ErrInvalidDataset) {
+			w.WriteHeader(http.StatusBadRequest)
+			utils.WriteError(importErr, w)
+			return
+		}
+
+		utils.HandleCommonErrors(importErr, w)
+		return
 	}
 
-	metadata, metadataErr := dataset_import.MarshalDatasetMetadata(jsonDataset.Metadata)
-	if metadataErr != nil {
-		log.Panic(metadataErr)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(report)
+}
+
+func (d *DatasetsController) appendSamples(w http.ResponseWriter, r *http.Request) {
+	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+	user := r.Context().Value(middlewares.UserContextKey).(*models.User)
+
+	options, optionsErr := parseAppendOptions(r)
+	if optionsErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(optionsErr, w)
+		return
 	}
 
-	// create dataset
-	dataset := &models.Dataset{
-		Name:     jsonDataset.Name,
-		Metadata: metadata,
+	reader, file, readerErr := openUploadedDataset(r)
+	if readerErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(readerErr, w)
+		return
 	}
+	defer file.Close()
 
-	if datasetCreateErr := d.db.Create(&dataset).Error; datasetCreateErr != nil {
-		log.Fatal(datasetCreateErr)
+	preAnnotator, preAnnotatorErr := d.parsePreAnnotator(r)
+	if preAnnotatorErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(preAnnotatorErr, w)
+		return
 	}
+	options.PreAnnotator = preAnnotator
 
-	samples, samplesErr := dataset_import.MapSampleDataToSample(jsonDataset.Samples, dataset.ID)
-	if samplesErr != nil {
-		log.Panic(samplesErr)
+	report, appendErr := d.datasetImportHandler.AppendSamples(uint(datasetId), user.ID, reader, options)
+	if appendErr != nil {
+		if errors.Is(appendErr, dataset_import.ErrInvalidDataset) {
+			w.WriteHeader(http.StatusBadRequest)
+			utils.WriteError(appendErr, w)
+			return
+		}
+
+		utils.HandleCommonErrors(appendErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+// parsePreAnnotator reads the optional pre-annotator config of an upload from the preannotator form field
+func (d *DatasetsController) parsePreAnnotator(r *http.Request) (*preannotate.Model, error) {
+	configJson := r.FormValue("preannotator")
+	if configJson == "" {
+		return nil, nil
 	}
 
-	// create samples in a batch
-	if sampleCreateErr := d.db.Create(&samples).Error; sampleCreateErr != nil {
-		log.Fatal(sampleCreateErr)
+	config := &preannotate.Config{}
+	if err := json.Unmarshal([]byte(configJson), config); err != nil {
+		return nil, err
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(dataset)
+	return d.preAnnotationHandler.NewModel(config)
+}
+
+func (d *DatasetsController) preAnnotateDataset(w http.ResponseWriter, r *http.Request) {
+	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+	user := r.Context().Value(middlewares.UserContextKey).(*models.User)
+
+	config := &preannotate.Config{}
+	if err := json.NewDecoder(r.Body).Decode(config); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(err, w)
+		return
+	}
+
+	model, modelErr := d.preAnnotationHandler.NewModel(config)
+	if modelErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(modelErr, w)
+		return
+	}
+
+	result, preAnnotationErr := d.preAnnotationHandler.PreAnnotateDataset(uint(datasetId), user.ID, model)
+	if preAnnotationErr != nil {
+		handlePreAnnotationErrors(preAnnotationErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
+// handlePreAnnotationErrors reports a failing model as a bad gateway
+func handlePreAnnotationErrors(err error, w http.ResponseWriter) {
+	if errors.Is(err, preannotate.ErrPreAnnotationFailed) {
+		w.WriteHeader(http.StatusBadGateway)
+		utils.WriteError(err, w)
+		return
+	}
+
+	utils.HandleCommonErrors(err, w)
+}
+
+// parseAppendOptions reads the dedup and on_duplicate query params
+func parseAppendOptions(r *http.Request) (*handlers.AppendOptions, error) {
+	params := r.URL.Query()
+	options := &handlers.AppendOptions{Dedup: handlers.DedupByContentHash}
+
+	switch dedup := handlers.DedupMode(params.Get("dedup")); dedup {
+	case "":
+	case handlers.DedupByContentHash, handlers.DedupByExternalID:
+		options.Dedup = dedup
+	default:
+		return nil, fmt.Errorf("Invalid dedup mode %q", dedup)
+	}
+
+	switch params.Get("on_duplicate") {
+	case "", "skip":
+	case "update":
+		options.UpdateDuplicates = true
+	default:
+		return nil, errors.New("Invalid on_duplicate value")
+	}
+
+	return options, nil
 }
 
 func (d *DatasetsController) getDataset(w http.ResponseWriter, r *http.Request) {
@@ -169,22 +380,108 @@ func (d *DatasetsController) getDataset(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(dataset)
 }
 
-func (d *DatasetsController) getSamples(w http.ResponseWriter, r *http.Request) {
+func (d *DatasetsController) patchDataset(w http.ResponseWriter, r *http.Request) {
 	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
 
-	samples, samplesErr := d.samplesHandler.GetSamples(uint(datasetId))
-	if samplesErr != nil {
-		utils.HandleCommonErrors(samplesErr, w)
+	updateData := &handlers.UpdateDatasetData{}
+	if err := json.NewDecoder(r.Body).Decode(updateData); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(err, w)
+		return
+	}
+
+	if updateData.AnnotationsPerSample.Valid && updateData.AnnotationsPerSample.Int64 < 1 {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(errors.New("annotations_per_sample must be at least 1"), w)
+		return
+	}
+
+	dataset, datasetErr := d.datasetsHandler.PatchDataset(uint(datasetId), updateData)
+	if errors.Is(datasetErr, handlers.ErrInvalidSamplingStrategy) {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(datasetErr, w)
+		return
+	} else if datasetErr != nil {
+		utils.HandleCommonErrors(datasetErr, w)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(samples)
+	json.NewEncoder(w).Encode(dataset)
+}
+
+func (d *DatasetsController) getAgreement(w http.ResponseWriter, r *http.Request) {
+	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+
+	report, reportErr := d.agreementHandler.GetAgreement(uint(datasetId))
+	if reportErr != nil {
+		utils.HandleCommonErrors(reportErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+func (d *DatasetsController) searchDatasets(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middlewares.UserContextKey).(*models.User)
+
+	d.writeSearchHits(w, r, func(query string, limit int) ([]*search.Hit, error) {
+		return d.searchHandler.SearchUserDatasets(user, query, limit)
+	})
+}
+
+func (d *DatasetsController) searchDataset(w http.ResponseWriter, r *http.Request) {
+	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+
+	d.writeSearchHits(w, r, func(query string, limit int) ([]*search.Hit, error) {
+		return d.searchHandler.SearchDataset(uint(datasetId), query, limit)
+	})
+}
+
+// writeSearchHits runs the search of the q and limit query parameters
+func (d *DatasetsController) writeSearchHits(w http.ResponseWriter, r *http.Request, runSearch func(query string, limit int) ([]*search.Hit, error)) {
+	limit := 0
+	if limitString := r.URL.Query().Get("limit"); limitString != "" {
+		var limitErr error
+		if limit, limitErr = strconv.Atoi(limitString); limitErr != nil || limit <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			utils.WriteError(errors.New("Invalid limit"), w)
+			return
+		}
+	}
+
+	hits, searchErr := runSearch(r.URL.Query().Get("q"), limit)
+	if errors.Is(searchErr, handlers.ErrEmptySearchQuery) {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(searchErr, w)
+		return
+	} else if searchErr != nil {
+		utils.HandleCommonErrors(searchErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(hits)
+}
+
+func (d *DatasetsController) getSamples(w http.ResponseWriter, r *http.Request) {
+	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+
+	query, queryErr := parseSampleQuery(r)
+	if queryErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(queryErr, w)
+		return
+	}
+
+	d.writeSamplePage(w, uint(datasetId), query)
 }
 
 func (d *DatasetsController) getSample(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+	user := r.Context().Value(middlewares.UserContextKey).(*models.User)
 
 	sampleIdString := vars["sampleId"]
 	sampleId, err := strconv.Atoi(sampleIdString)
@@ -194,12 +491,28 @@ func (d *DatasetsController) getSample(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sample, sampleErr := d.samplesHandler.GetSample(uint(datasetId), uint(sampleId))
+	sample, sampleErr := d.samplesHandler.GetSampleForUser(uint(datasetId), uint(sampleId), user.ID)
+	if sampleErr != nil {
+		utils.HandleCommonErrors(sampleErr, w)
+		return
+	}
+
+	w.Header().Set("ETag", sampleETag(sample))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(sample)
+}
+
+func (d *DatasetsController) getSampleByExternalId(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+
+	sample, sampleErr := d.samplesHandler.GetSampleByExternalID(uint(datasetId), vars["externalId"])
 	if sampleErr != nil {
 		utils.HandleCommonErrors(sampleErr, w)
 		return
 	}
 
+	w.Header().Set("ETag", sampleETag(sample))
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(sample)
 }
@@ -208,23 +521,73 @@ func (d *DatasetsController) getSamplesWithStatus(w http.ResponseWriter, r *http
 	vars := mux.Vars(r)
 	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
 
-	// parse sample status
-	statusString := vars["status"]
-	status := models.StatusType(statusString)
-	if statusErr := status.IsValid(); statusErr != nil {
+	query, queryErr := parseSampleQuery(r)
+	if queryErr != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		utils.WriteError(errors.New("Invalid status type"), w)
+		utils.WriteError(queryErr, w)
 		return
 	}
+	query.Status = vars["status"]
 
-	samples, samplesErr := d.samplesHandler.GetSamplesWithStatus(uint(datasetId), status)
-	if samplesErr != nil {
-		utils.HandleCommonErrors(samplesErr, w)
+	d.writeSamplePage(w, uint(datasetId), query)
+}
+
+func (d *DatasetsController) writeSamplePage(w http.ResponseWriter, datasetId uint, query *handlers.SampleQuery) {
+	page, pageErr := d.samplesHandler.ListSamples(datasetId, query)
+	if errors.Is(pageErr, handlers.ErrInvalidSampleQuery) {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(pageErr, w)
+		return
+	} else if pageErr != nil {
+		utils.HandleCommonErrors(pageErr, w)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(samples)
+	json.NewEncoder(w).Encode(page)
+}
+
+// parseSampleQuery reads the limit, cursor, sort, order, status, assigned_to, entity_tag, text,
+// metadata_key and metadata_value query parameters
+func parseSampleQuery(r *http.Request) (*handlers.SampleQuery, error) {
+	params := r.URL.Query()
+	query := &handlers.SampleQuery{
+		SampleFilter: handlers.SampleFilter{
+			Status:        params.Get("status"),
+			EntityTag:     params.Get("entity_tag"),
+			Text:          params.Get("text"),
+			MetadataKey:   params.Get("metadata_key"),
+			MetadataValue: params.Get("metadata_value"),
+		},
+		Cursor: params.Get("cursor"),
+		SortBy: params.Get("sort"),
+	}
+
+	if limitString := params.Get("limit"); limitString != "" {
+		limit, limitErr := strconv.Atoi(limitString)
+		if limitErr != nil || limit <= 0 {
+			return nil, errors.New("Invalid limit")
+		}
+		query.Limit = limit
+	}
+
+	switch params.Get("order") {
+	case "", "asc":
+	case "desc":
+		query.Descending = true
+	default:
+		return nil, errors.New("Invalid order")
+	}
+
+	if assignedTo := params.Get("assigned_to"); assignedTo != "" {
+		userId, userIdErr := strconv.Atoi(assignedTo)
+		if userIdErr != nil {
+			return nil, errors.New("Invalid assignee")
+		}
+		query.AssignedTo = null.IntFrom(int64(userId))
+	}
+
+	return query, nil
 }
 
 func (d *DatasetsController) assignNextSample(w http.ResponseWriter, r *http.Request) {
@@ -237,6 +600,36 @@ func (d *DatasetsController) assignNextSample(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	w.Header().Set("ETag", sampleETag(sample))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(sample)
+}
+
+func (d *DatasetsController) extendSampleLease(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+	user := r.Context().Value(middlewares.UserContextKey).(*models.User)
+
+	sampleIdString := vars["sampleId"]
+	sampleId, err := strconv.Atoi(sampleIdString)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(errors.New("Error converting sample id"), w)
+		return
+	}
+
+	sample, sampleErr := d.samplesHandler.ExtendLease(uint(datasetId), uint(sampleId), user.ID)
+	if sampleErr != nil {
+		if errors.Is(sampleErr, handlers.ErrLeaseNotHeld) {
+			w.WriteHeader(http.StatusConflict)
+			utils.WriteError(sampleErr, w)
+			return
+		}
+
+		utils.HandleCommonErrors(sampleErr, w)
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(sample)
 }
@@ -244,6 +637,7 @@ func (d *DatasetsController) assignNextSample(w http.ResponseWriter, r *http.Req
 func (d *DatasetsController) patchSample(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+	user := r.Context().Value(middlewares.UserContextKey).(*models.User)
 
 	sampleIdString := vars["sampleId"]
 	sampleId, err := strconv.Atoi(sampleIdString)
@@ -260,20 +654,703 @@ func (d *DatasetsController) patchSample(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	version, versionErr := parseIfMatch(r)
+	if versionErr != nil {
+		w.WriteHeader(versionErr.status)
+		utils.WriteError(versionErr, w)
+		return
+	}
+	updateData.Version = version
+
 	// check whether status is a valid value
-	if !updateData.Status.Valid {
+	if updateData.Status.Valid {
 		if statusErr := models.StatusType(updateData.Status.String).IsValid(); statusErr != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			utils.WriteError(statusErr, w)
+			return
 		}
 	}
 
-	sample, sampleErr := d.samplesHandler.PatchSample(uint(datasetId), uint(sampleId), updateData)
+	sample, sampleErr := d.samplesHandler.PatchSample(uint(datasetId), uint(sampleId), user, updateData)
 	if sampleErr != nil {
+		var validationErrs dataset_utils.ValidationErrors
+		if errors.As(sampleErr, &validationErrs) {
+			w.WriteHeader(http.StatusBadRequest)
+			utils.WriteValidationErrors(validationErrs, w)
+			return
+		}
+
+		if errors.Is(sampleErr, handlers.ErrVersionConflict) {
+			d.writeSampleConflict(w, uint(datasetId), uint(sampleId), user.ID, sampleErr)
+			return
+		}
+
+		if errors.Is(sampleErr, handlers.ErrSampleUnderReview) {
+			w.WriteHeader(http.StatusForbidden)
+			utils.WriteError(sampleErr, w)
+			return
+		}
+
 		utils.HandleCommonErrors(sampleErr, w)
 		return
 	}
 
+	w.Header().Set("ETag", sampleETag(sample))
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(sample)
 }
+
+func (d *DatasetsController) bulkUpdateSamples(w http.ResponseWriter, r *http.Request) {
+	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+	user := r.Context().Value(middlewares.UserContextKey).(*models.User)
+
+	bulkData := &handlers.BulkSampleData{}
+	if err := json.NewDecoder(r.Body).Decode(bulkData); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(err, w)
+		return
+	}
+
+	result, bulkErr := d.samplesHandler.BulkUpdateSamples(uint(datasetId), user.ID, bulkData)
+	if errors.Is(bulkErr, handlers.ErrInvalidBulkOperation) || errors.Is(bulkErr, handlers.ErrInvalidSampleQuery) {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(bulkErr, w)
+		return
+	} else if bulkErr != nil {
+		utils.HandleCommonErrors(bulkErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
+func (d *DatasetsController) updateSamplePriorities(w http.ResponseWriter, r *http.Request) {
+	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+
+	var updates []*handlers.PriorityUpdate
+	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(err, w)
+		return
+	}
+
+	result, updateErr := d.samplesHandler.UpdatePriorities(uint(datasetId), updates)
+	if errors.Is(updateErr, handlers.ErrInvalidPriorityUpdate) {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(updateErr, w)
+		return
+	} else if updateErr != nil {
+		utils.HandleCommonErrors(updateErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
+func (d *DatasetsController) getTags(w http.ResponseWriter, r *http.Request) {
+	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+
+	tags, tagsErr := d.tagsHandler.GetTags(uint(datasetId))
+	if tagsErr != nil {
+		utils.HandleCommonErrors(tagsErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tags)
+}
+
+func (d *DatasetsController) postTag(w http.ResponseWriter, r *http.Request) {
+	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+
+	tagData := &dataset_utils.Tag{}
+	if err := json.NewDecoder(r.Body).Decode(tagData); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(err, w)
+		return
+	}
+
+	tag, tagErr := d.tagsHandler.CreateTag(uint(datasetId), handlers.TagKind(mux.Vars(r)["kind"]), tagData)
+	if tagErr != nil {
+		handleTagErrors(tagErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tag)
+}
+
+func (d *DatasetsController) putTag(w http.ResponseWriter, r *http.Request) {
+	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+	user := r.Context().Value(middlewares.UserContextKey).(*models.User)
+	vars := mux.Vars(r)
+
+	updateData := &handlers.UpdateTagData{}
+	if err := json.NewDecoder(r.Body).Decode(updateData); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(err, w)
+		return
+	}
+
+	result, tagErr := d.tagsHandler.UpdateTag(uint(datasetId), handlers.TagKind(vars["kind"]), vars["name"], user.ID, updateData)
+	if tagErr != nil {
+		handleTagErrors(tagErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
+func (d *DatasetsController) mergeTag(w http.ResponseWriter, r *http.Request) {
+	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+	user := r.Context().Value(middlewares.UserContextKey).(*models.User)
+	vars := mux.Vars(r)
+
+	mergeData := &handlers.MergeTagData{}
+	if err := json.NewDecoder(r.Body).Decode(mergeData); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(err, w)
+		return
+	}
+
+	result, tagErr := d.tagsHandler.MergeTag(uint(datasetId), handlers.TagKind(vars["kind"]), vars["name"], user.ID, mergeData)
+	if tagErr != nil {
+		handleTagErrors(tagErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
+func (d *DatasetsController) deleteTag(w http.ResponseWriter, r *http.Request) {
+	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+	vars := mux.Vars(r)
+
+	if tagErr := d.tagsHandler.DeleteTag(uint(datasetId), handlers.TagKind(vars["kind"]), vars["name"]); tagErr != nil {
+		handleTagErrors(tagErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleTagErrors(err error, w http.ResponseWriter) {
+	switch {
+	case errors.Is(err, handlers.ErrInvalidTag):
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(err, w)
+	case errors.Is(err, handlers.ErrTagExists), errors.Is(err, handlers.ErrTagInUse):
+		w.WriteHeader(http.StatusConflict)
+		utils.WriteError(err, w)
+	default:
+		utils.HandleCommonErrors(err, w)
+	}
+}
+
+func (d *DatasetsController) getLabelingRules(w http.ResponseWriter, r *http.Request) {
+	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+
+	rules, rulesErr := d.labelingRulesHandler.GetRules(uint(datasetId))
+	if rulesErr != nil {
+		utils.HandleCommonErrors(rulesErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(rules)
+}
+
+func (d *DatasetsController) postLabelingRule(w http.ResponseWriter, r *http.Request) {
+	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+
+	ruleData := &handlers.LabelingRuleData{}
+	if err := json.NewDecoder(r.Body).Decode(ruleData); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(err, w)
+		return
+	}
+
+	rule, ruleErr := d.labelingRulesHandler.CreateRule(uint(datasetId), ruleData)
+	if ruleErr != nil {
+		handleLabelingRuleErrors(ruleErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+}
+
+func (d *DatasetsController) putLabelingRule(w http.ResponseWriter, r *http.Request) {
+	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+
+	ruleId, err := strconv.Atoi(mux.Vars(r)["ruleId"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(errors.New("Error converting rule id"), w)
+		return
+	}
+
+	ruleData := &handlers.LabelingRuleData{}
+	if err := json.NewDecoder(r.Body).Decode(ruleData); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(err, w)
+		return
+	}
+
+	rule, ruleErr := d.labelingRulesHandler.UpdateRule(uint(datasetId), uint(ruleId), ruleData)
+	if ruleErr != nil {
+		handleLabelingRuleErrors(ruleErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(rule)
+}
+
+func (d *DatasetsController) deleteLabelingRule(w http.ResponseWriter, r *http.Request) {
+	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+
+	ruleId, err := strconv.Atoi(mux.Vars(r)["ruleId"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(errors.New("Error converting rule id"), w)
+		return
+	}
+
+	if ruleErr := d.labelingRulesHandler.DeleteRule(uint(datasetId), uint(ruleId)); ruleErr != nil {
+		utils.HandleCommonErrors(ruleErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// applyLabelingRules only reports the spans the rules would add when the dry_run query param is true
+func (d *DatasetsController) applyLabelingRules(w http.ResponseWriter, r *http.Request) {
+	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+	user := r.Context().Value(middlewares.UserContextKey).(*models.User)
+
+	dryRun := false
+	if dryRunParam := r.URL.Query().Get("dry_run"); dryRunParam != "" {
+		var parseErr error
+		if dryRun, parseErr = strconv.ParseBool(dryRunParam); parseErr != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			utils.WriteError(errors.New("Invalid dry_run value"), w)
+			return
+		}
+	}
+
+	result, applyErr := d.labelingRulesHandler.ApplyRules(uint(datasetId), user.ID, dryRun)
+	if applyErr != nil {
+		utils.HandleCommonErrors(applyErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
+func handleLabelingRuleErrors(err error, w http.ResponseWriter) {
+	if errors.Is(err, handlers.ErrInvalidLabelingRule) {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(err, w)
+		return
+	}
+
+	utils.HandleCommonErrors(err, w)
+}
+
+func (d *DatasetsController) getSampleHistory(w http.ResponseWriter, r *http.Request) {
+	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+
+	sampleId, err := strconv.Atoi(mux.Vars(r)["sampleId"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(errors.New("Error converting sample id"), w)
+		return
+	}
+
+	revisions, historyErr := d.samplesHandler.GetSampleHistory(uint(datasetId), uint(sampleId))
+	if historyErr != nil {
+		utils.HandleCommonErrors(historyErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(revisions)
+}
+
+func (d *DatasetsController) restoreSampleRevision(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+	user := r.Context().Value(middlewares.UserContextKey).(*models.User)
+
+	sampleId, err := strconv.Atoi(vars["sampleId"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(errors.New("Error converting sample id"), w)
+		return
+	}
+
+	revisionId, err := strconv.Atoi(vars["revisionId"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(errors.New("Error converting revision id"), w)
+		return
+	}
+
+	sample, restoreErr := d.samplesHandler.RestoreRevision(uint(datasetId), uint(sampleId), uint(revisionId), user.ID)
+	if restoreErr != nil {
+		var validationErrs dataset_utils.ValidationErrors
+		if errors.As(restoreErr, &validationErrs) {
+			w.WriteHeader(http.StatusBadRequest)
+			utils.WriteValidationErrors(validationErrs, w)
+			return
+		}
+
+		if errors.Is(restoreErr, handlers.ErrInvalidRestore) {
+			w.WriteHeader(http.StatusBadRequest)
+			utils.WriteError(restoreErr, w)
+			return
+		}
+
+		utils.HandleCommonErrors(restoreErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(sample)
+}
+
+type sampleConflictResponse struct {
+	ErrorMessage string         `json:"error"`
+	Sample       *models.Sample `json:"sample"`
+}
+
+type ifMatchError struct {
+	status  int
+	message string
+}
+
+func (e *ifMatchError) Error() string {
+	return e.message
+}
+
+// sampleETag is the version of the annotation of the user when the sample carries one, annotators
+// of a sample update their own annotation and do not conflict with each other
+func sampleETag(sample *models.Sample) string {
+	if len(sample.UserAnnotations) == 1 {
+		return fmt.Sprintf("\"%d\"", sample.UserAnnotations[0].Version)
+	}
+
+	return fmt.Sprintf("\"%d\"", sample.Version)
+}
+
+// parseIfMatch returns the version of the required If-Match header, "*" matches any version
+func parseIfMatch(r *http.Request) (null.Int, *ifMatchError) {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if ifMatch == "" {
+		return null.Int{}, &ifMatchError{status: http.StatusPreconditionRequired, message: "If-Match header is required"}
+	}
+
+	if ifMatch == "*" {
+		return null.Int{}, nil
+	}
+
+	version, err := strconv.ParseInt(strings.Trim(ifMatch, "\""), 10, 64)
+	if err != nil {
+		return null.Int{}, &ifMatchError{status: http.StatusBadRequest, message: "invalid If-Match header"}
+	}
+
+	return null.IntFrom(version), nil
+}
+
+// writeSampleConflict responds with the current state of the sample and of the annotation of the user,
+// so that the client can merge its changes
+func (d *DatasetsController) writeSampleConflict(w http.ResponseWriter, datasetId uint, sampleId uint, userId uint, conflictErr error) {
+	sample, sampleErr := d.samplesHandler.GetSampleForUser(datasetId, sampleId, userId)
+	if sampleErr != nil {
+		utils.HandleCommonErrors(sampleErr, w)
+		return
+	}
+
+	w.Header().Set("ETag", sampleETag(sample))
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(&sampleConflictResponse{ErrorMessage: conflictErr.Error(), Sample: sample})
+}
+
+// diffSample compares the annotations selected by the from_revision or from_user
+// and the to_revision or to_user query params, a missing side is the current sample
+func (d *DatasetsController) diffSample(w http.ResponseWriter, r *http.Request) {
+	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+
+	sampleId, err := strconv.Atoi(mux.Vars(r)["sampleId"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(errors.New("Error converting sample id"), w)
+		return
+	}
+
+	from, fromErr := parseDiffSource(r, "from")
+	if fromErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(fromErr, w)
+		return
+	}
+
+	to, toErr := parseDiffSource(r, "to")
+	if toErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(toErr, w)
+		return
+	}
+
+	diff, diffErr := d.samplesHandler.DiffSample(uint(datasetId), uint(sampleId), from, to)
+	if diffErr != nil {
+		utils.HandleCommonErrors(diffErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(diff)
+}
+
+func parseDiffSource(r *http.Request, side string) (handlers.DiffSource, error) {
+	source := handlers.DiffSource{}
+	query := r.URL.Query()
+
+	if revisionParam := query.Get(side + "_revision"); revisionParam != "" {
+		revisionId, err := strconv.ParseInt(revisionParam, 10, 64)
+		if err != nil {
+			return source, fmt.Errorf("invalid %s_revision", side)
+		}
+		source.RevisionID = null.IntFrom(revisionId)
+	}
+
+	if userParam := query.Get(side + "_user"); userParam != "" {
+		if source.RevisionID.Valid {
+			return source, fmt.Errorf("%s_revision and %s_user cannot be used together", side, side)
+		}
+
+		userId, err := strconv.ParseInt(userParam, 10, 64)
+		if err != nil {
+			return source, fmt.Errorf("invalid %s_user", side)
+		}
+		source.UserID = null.IntFrom(userId)
+	}
+
+	return source, nil
+}
+
+type returnSampleData struct {
+	Comment string `json:"comment"`
+}
+
+func (d *DatasetsController) getReviewQueue(w http.ResponseWriter, r *http.Request) {
+	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+
+	samples, samplesErr := d.samplesHandler.GetReviewQueue(uint(datasetId))
+	if samplesErr != nil {
+		utils.HandleCommonErrors(samplesErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(samples)
+}
+
+func (d *DatasetsController) getSampleForReview(w http.ResponseWriter, r *http.Request) {
+	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+
+	sampleId, err := strconv.Atoi(mux.Vars(r)["sampleId"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(errors.New("Error converting sample id"), w)
+		return
+	}
+
+	sample, sampleErr := d.samplesHandler.GetSampleForReview(uint(datasetId), uint(sampleId))
+	if sampleErr != nil {
+		utils.HandleCommonErrors(sampleErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(sample)
+}
+
+func (d *DatasetsController) acceptSample(w http.ResponseWriter, r *http.Request) {
+	d.reviewSample(w, r, func(datasetId uint, sampleId uint, reviewerId uint) (*models.Sample, error) {
+		return d.samplesHandler.AcceptSample(datasetId, sampleId, reviewerId)
+	})
+}
+
+func (d *DatasetsController) returnSample(w http.ResponseWriter, r *http.Request) {
+	returnData := &returnSampleData{}
+	if err := json.NewDecoder(r.Body).Decode(returnData); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(err, w)
+		return
+	}
+
+	if strings.TrimSpace(returnData.Comment) == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(errors.New("comment is required"), w)
+		return
+	}
+
+	d.reviewSample(w, r, func(datasetId uint, sampleId uint, reviewerId uint) (*models.Sample, error) {
+		return d.samplesHandler.ReturnSample(datasetId, sampleId, reviewerId, returnData.Comment)
+	})
+}
+
+func (d *DatasetsController) mergeSample(w http.ResponseWriter, r *http.Request) {
+	mergeData := &handlers.MergeSampleData{}
+	if err := json.NewDecoder(r.Body).Decode(mergeData); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(err, w)
+		return
+	}
+
+	if len(mergeData.Annotations) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(errors.New("annotations are required"), w)
+		return
+	}
+
+	if mergeData.Status.Valid {
+		if statusErr := models.StatusType(mergeData.Status.String).IsValid(); statusErr != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			utils.WriteError(statusErr, w)
+			return
+		}
+	}
+
+	d.reviewSample(w, r, func(datasetId uint, sampleId uint, reviewerId uint) (*models.Sample, error) {
+		return d.samplesHandler.MergeSample(datasetId, sampleId, reviewerId, mergeData)
+	})
+}
+
+// reviewSample runs a review action and maps its errors to responses
+func (d *DatasetsController) reviewSample(w http.ResponseWriter, r *http.Request, review func(datasetId uint, sampleId uint, reviewerId uint) (*models.Sample, error)) {
+	datasetId := r.Context().Value(middlewares.DatasetIdContextKey).(int)
+	user := r.Context().Value(middlewares.UserContextKey).(*models.User)
+
+	sampleId, err := strconv.Atoi(mux.Vars(r)["sampleId"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(errors.New("Error converting sample id"), w)
+		return
+	}
+
+	sample, reviewErr := review(uint(datasetId), uint(sampleId), user.ID)
+	if reviewErr != nil {
+		var validationErrs dataset_utils.ValidationErrors
+		if errors.As(reviewErr, &validationErrs) {
+			w.WriteHeader(http.StatusBadRequest)
+			utils.WriteValidationErrors(validationErrs, w)
+			return
+		}
+
+		if errors.Is(reviewErr, handlers.ErrInvalidReviewTransition) {
+			w.WriteHeader(http.StatusConflict)
+			utils.WriteError(reviewErr, w)
+			return
+		}
+
+		utils.HandleCommonErrors(reviewErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(sample)
+}
+
+// parseImportFormat selects the format by the format query param, the content type or the extension of the uploaded file
+func parseImportFormat(r *http.Request, fileHeader *multipart.FileHeader) (dataset_utils.Format, error) {
+	if formatParam := r.URL.Query().Get("format"); formatParam != "" {
+		format := dataset_utils.Format(formatParam)
+		return format, format.IsValid()
+	}
+
+	if format, ok := dataset_utils.FormatFromContentType(fileHeader.Header.Get("Content-Type")); ok {
+		return format, nil
+	}
+
+	if format, ok := dataset_utils.FormatFromFileName(fileHeader.Filename); ok {
+		return format, nil
+	}
+
+	return dataset_utils.JsonFormat, nil
+}
+
+// parseExportFormat selects the format by the format query param or the Accept header
+func parseExportFormat(r *http.Request) (dataset_utils.Format, error) {
+	if formatParam := r.URL.Query().Get("format"); formatParam != "" {
+		format := dataset_utils.Format(formatParam)
+		return format, format.IsValid()
+	}
+
+	for _, contentType := range strings.Split(r.Header.Get("Accept"), ",") {
+		if format, ok := dataset_utils.FormatFromContentType(strings.TrimSpace(contentType)); ok {
+			return format, nil
+		}
+	}
+
+	return dataset_utils.JsonFormat, nil
+}
+
+// openUploadedDataset opens the dataset file of the multipart form, the caller closes the returned file
+func openUploadedDataset(r *http.Request) (dataset_import.DatasetReader, multipart.File, error) {
+	r.ParseMultipartForm(32 << 20)
+	file, fileHeader, err := r.FormFile("file")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	format, formatErr := parseImportFormat(r, fileHeader)
+	if formatErr != nil {
+		file.Close()
+		return nil, nil, formatErr
+	}
+
+	reader, readerErr := newDatasetReader(r, format, file, fileHeader)
+	if readerErr != nil {
+		file.Close()
+		return nil, nil, readerErr
+	}
+
+	return reader, file, nil
+}
+
+func newDatasetReader(r *http.Request, format dataset_utils.Format, file multipart.File, fileHeader *multipart.FileHeader) (dataset_import.DatasetReader, error) {
+	if format == dataset_utils.JsonFormat {
+		return dataset_import.NewJsonDatasetReader(file)
+	}
+
+	// the other formats take the name and metadata from separate form fields
+	var metadata *dataset_utils.Metadata
+	if metadataField := r.FormValue("metadata"); metadataField != "" {
+		metadata = &dataset_utils.Metadata{}
+		if parsingErr := json.Unmarshal([]byte(metadataField), metadata); parsingErr != nil {
+			return nil, parsingErr
+		}
+	}
+
+	switch format {
+	case dataset_utils.JsonlFormat:
+		return dataset_import.NewJsonlDatasetReader(file, r.FormValue("name"), metadata)
+	case dataset_utils.ConllFormat:
+		return dataset_import.NewConllDatasetReader(file, r.FormValue("name"), metadata)
+	case dataset_utils.SpacyFormat:
+		return dataset_import.NewSpacyDatasetReader(file, r.FormValue("name"), metadata)
+	case dataset_utils.BratFormat:
+		return dataset_import.NewBratDatasetReader(file, fileHeader.Size, r.FormValue("name"), metadata)
+	default:
+		return nil, dataset_utils.ErrUnknownFormat
+	}
+}
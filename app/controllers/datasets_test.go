@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"backend/app/auth"
+	"backend/app/handlers"
+	"backend/app/models"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/matryer/is"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupDBForDatasetsControllerTests(t *testing.T) (*gorm.DB, func() error) {
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+
+	if err != nil {
+		t.Fatalf("failed to open sqlite connection: %v", err)
+	}
+
+	if migrationErr := db.AutoMigrate(&models.User{}, &models.AuthToken{}, &models.RefreshToken{}, &models.APIKey{}); migrationErr != nil {
+		t.Fatalf("failed to migrate users: %v", migrationErr)
+	}
+
+	if migrationErr := db.AutoMigrate(&models.Dataset{}, &models.Sample{}, &models.SampleAnnotation{}, &models.SampleRevision{}, &models.UserDataset{}); migrationErr != nil {
+		t.Fatalf("failed to migrate datasets: %v", migrationErr)
+	}
+
+	sqlDB, sqlErr := db.DB()
+	if sqlErr != nil {
+		t.Fatalf("failed to obtain SQL DB: %v", sqlErr)
+	}
+	return db, sqlDB.Close
+}
+
+func setupDatasetsController(t *testing.T) (*gorm.DB, func() error, *mux.Router) {
+	db, cleanup := setupDBForDatasetsControllerTests(t)
+	tokenAuth := auth.NewTokenAuth(db)
+	router := mux.NewRouter()
+	datasetsController := NewDatasetsController(tokenAuth, handlers.NewDatasetsHandler(db), handlers.NewSamplesHandler(db), handlers.NewUserDatasetPermsHandler(db), handlers.NewDatasetImportHandler(db), nil, nil, nil, handlers.NewPreAnnotationHandler(db), nil)
+	datasetsController.Init(router)
+	return db, cleanup, router
+}
+
+func TestPostDatasetWithFailingPreAnnotator(t *testing.T) {
+	db, cleanup := setupDBForDatasetsControllerTests(t)
+	defer cleanup()
+	is := is.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	tokenAuth := auth.NewTokenAuth(db)
+	preAnnotationHandler := handlers.NewPreAnnotationHandler(db)
+	preAnnotationHandler.WebhookURLs = []string{server.URL}
+	router := mux.NewRouter()
+	NewDatasetsController(tokenAuth, nil, nil, nil, handlers.NewDatasetImportHandler(db), nil, nil, nil, preAnnotationHandler, nil).Init(router)
+
+	admin := models.User{
+		Email: "admin1",
+		Role:  models.AdminRole,
+	}
+	is.NoErr(db.Create(&admin).Error)
+	authToken, tokenErr := tokenAuth.CreateAuthToken(&admin)
+	is.NoErr(tokenErr)
+	authCookie, _ := tokenAuth.CreateAuthCookies(authToken)
+
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	file, fileErr := form.CreateFormFile("file", "dataset.json")
+	is.NoErr(fileErr)
+	file.Write([]byte(`{"name": "pre-annotated", "metadata": {"entityTags": [{"name": "PER"}]}, "samples": [{"text": "John"}]}`))
+	is.NoErr(form.WriteField("preannotator", fmt.Sprintf(`{"backend": "webhook", "url": %q}`, server.URL)))
+	is.NoErr(form.Close())
+
+	req := httptest.NewRequest("POST", "/", body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.AddCookie(authCookie)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	// the dataset is created even though the model failed
+	is.Equal(rr.Code, http.StatusCreated)
+	report := struct {
+		Dataset            models.Dataset `json:"dataset"`
+		ImportedSamples    int            `json:"imported_samples"`
+		PreAnnotationError *string        `json:"pre_annotation_error"`
+	}{}
+	is.NoErr(json.NewDecoder(rr.Body).Decode(&report))
+	is.True(report.Dataset.ID != 0)
+	is.Equal(report.ImportedSamples, 1)
+	is.True(report.PreAnnotationError != nil)
+
+	var samplesCount int64
+	is.NoErr(db.Model(&models.Sample{}).Where("dataset_id = ?", report.Dataset.ID).Count(&samplesCount).Error)
+	is.Equal(samplesCount, int64(1))
+}
+
+func TestPatchApprovedSampleAsAnnotator(t *testing.T) {
+	db, cleanup, router := setupDatasetsController(t)
+	defer cleanup()
+	is := is.New(t)
+
+	annotator := models.User{
+		Email: "user1",
+		Role:  models.AnnotatorRole,
+	}
+	is.NoErr(db.Create(&annotator).Error)
+
+	dataset := &models.Dataset{
+		Name:    "dataset1",
+		Type:    models.EntityAnnotation,
+		Samples: []models.Sample{{Text: "John", Status: models.Accepted.ToNullString(), ReviewStatus: models.Approved.ToNullString()}},
+	}
+	is.NoErr(db.Create(dataset).Error)
+	is.NoErr(db.Create(&models.UserDataset{UserID: annotator.ID, DatasetID: dataset.ID}).Error)
+
+	tokenAuth := auth.NewTokenAuth(db)
+	authToken, tokenErr := tokenAuth.CreateAuthToken(&annotator)
+	is.NoErr(tokenErr)
+	authCookie, _ := tokenAuth.CreateAuthCookies(authToken)
+
+	url := fmt.Sprintf("/%v/samples/%v/", dataset.ID, dataset.Samples[0].ID)
+	req := httptest.NewRequest("PATCH", url, bytes.NewBufferString(`{"status": "rejected"}`))
+	req.Header.Set("If-Match", `"1"`)
+	req.AddCookie(authCookie)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	is.Equal(rr.Code, http.StatusForbidden)
+
+	refreshedSample := &models.Sample{}
+	is.NoErr(db.First(refreshedSample, dataset.Samples[0].ID).Error)
+	is.Equal(refreshedSample.Status, models.Accepted.ToNullString())
+}
@@ -2,10 +2,13 @@ package controllers
 
 import (
 	"backend/app/auth"
+	utils "backend/app/controllers/utils"
 	"backend/app/middlewares"
 	"backend/app/models"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 )
@@ -24,6 +27,18 @@ func (u *UsersController) Init(router *mux.Router) {
 	authTokenMiddleware := middlewares.AuthTokenMiddleware(u.tokenAuth)
 	router.Use(authTokenMiddleware)
 	router.HandleFunc("/", u.getUser).Methods("GET", "OPTIONS")
+	router.HandleFunc("/sessions/", u.getSessions).Methods("GET", "OPTIONS")
+
+	apiKeysRouter := router.PathPrefix("/api-keys").Subrouter()
+	apiKeysRouter.Use(middlewares.SessionOnlyMiddleware)
+	apiKeysRouter.HandleFunc("/", u.getAPIKeys).Methods("GET", "OPTIONS")
+	apiKeysRouter.HandleFunc("/", u.postAPIKey).Methods("POST", "OPTIONS")
+	apiKeysRouter.HandleFunc("/{apiKeyId:[0-9]+}/", u.deleteAPIKey).Methods("DELETE", "OPTIONS")
+}
+
+type createdAPIKeyResponse struct {
+	*models.APIKey
+	Key string `json:"key"`
 }
 
 func (u *UsersController) getUser(w http.ResponseWriter, r *http.Request) {
@@ -31,3 +46,77 @@ func (u *UsersController) getUser(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(user)
 }
+
+func (u *UsersController) getSessions(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middlewares.UserContextKey).(*models.User)
+
+	currentToken := ""
+	if cookie, err := r.Cookie(auth.AuthTokenCookieName); err == nil {
+		currentToken = cookie.Value
+	}
+
+	sessions, sessionsErr := u.tokenAuth.GetSessions(user.ID, currentToken)
+	if sessionsErr != nil {
+		utils.HandleCommonErrors(sessionsErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(sessions)
+}
+
+func (u *UsersController) getAPIKeys(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middlewares.UserContextKey).(*models.User)
+
+	apiKeys, keysErr := u.tokenAuth.GetAPIKeys(user.ID)
+	if keysErr != nil {
+		utils.HandleCommonErrors(keysErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(apiKeys)
+}
+
+// postAPIKey returns the plain key, it is not stored and cannot be shown again
+func (u *UsersController) postAPIKey(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middlewares.UserContextKey).(*models.User)
+
+	keyData := &auth.CreateAPIKeyData{}
+	if err := json.NewDecoder(r.Body).Decode(keyData); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(err, w)
+		return
+	}
+
+	apiKey, plainKey, keyErr := u.tokenAuth.CreateAPIKey(user, keyData)
+	if errors.Is(keyErr, auth.ErrInvalidAPIKey) {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(keyErr, w)
+		return
+	} else if keyErr != nil {
+		utils.HandleCommonErrors(keyErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(&createdAPIKeyResponse{APIKey: apiKey, Key: plainKey})
+}
+
+func (u *UsersController) deleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middlewares.UserContextKey).(*models.User)
+
+	apiKeyId, err := strconv.Atoi(mux.Vars(r)["apiKeyId"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.WriteError(errors.New("Error converting api key id"), w)
+		return
+	}
+
+	if revokeErr := u.tokenAuth.RevokeAPIKey(user.ID, uint(apiKeyId)); revokeErr != nil {
+		utils.HandleCommonErrors(revokeErr, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
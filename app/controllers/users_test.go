@@ -4,8 +4,10 @@ import (
 	"backend/app/auth"
 	"backend/app/models"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gorilla/mux"
@@ -36,6 +38,10 @@ func setupDBForUsersControllerTests(t *testing.T) (*gorm.DB, func() error) {
 		t.Fatalf("failed to migrate refresh token: %v", migrationErr)
 	}
 
+	if migrationErr := db.AutoMigrate(&models.APIKey{}); migrationErr != nil {
+		t.Fatalf("failed to migrate api key: %v", migrationErr)
+	}
+
 	sqlDB, sqlErr := db.DB()
 	if sqlErr != nil {
 		t.Fatalf("failed to obtain SQL DB: %v", sqlErr)
@@ -88,3 +94,99 @@ func TestGetUser(t *testing.T) {
 	is.Equal(user.ID, responseUser.ID)
 	is.Equal(responseUser.Email, email)
 }
+
+func TestAPIKeys(t *testing.T) {
+	db, cleanup, router := setupUsersController(t)
+	defer cleanup()
+	is := is.New(t)
+
+	user := models.User{Email: "user@email.com", Role: models.AnnotatorRole}
+	is.NoErr(db.Create(&user).Error)
+
+	tokenAuth := auth.NewTokenAuth(db)
+	authToken, tokenErr := tokenAuth.CreateAuthToken(&user)
+	is.NoErr(tokenErr)
+	authCookie, _ := tokenAuth.CreateAuthCookies(authToken)
+
+	req := httptest.NewRequest("POST", "/api-keys/", strings.NewReader(`{"name": "ci", "scope": "admin"}`))
+	req.AddCookie(authCookie)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	is.Equal(rr.Code, http.StatusBadRequest)
+
+	req = httptest.NewRequest("POST", "/api-keys/", strings.NewReader(`{"name": "ci", "scope": "annotate"}`))
+	req.AddCookie(authCookie)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	is.Equal(rr.Code, http.StatusCreated)
+
+	created := &struct {
+		ID    uint   `json:"ID"`
+		Key   string `json:"key"`
+		Scope string `json:"scope"`
+	}{}
+	is.NoErr(json.NewDecoder(rr.Body).Decode(created))
+	is.Equal(created.Scope, "annotate")
+
+	// the key authenticates requests but cannot manage keys
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+created.Key)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	is.Equal(rr.Code, http.StatusOK)
+
+	req = httptest.NewRequest("GET", "/api-keys/", nil)
+	req.Header.Set("Authorization", "Bearer "+created.Key)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	is.Equal(rr.Code, http.StatusForbidden)
+
+	req = httptest.NewRequest("GET", "/api-keys/", nil)
+	req.AddCookie(authCookie)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	is.Equal(rr.Code, http.StatusOK)
+	is.True(!strings.Contains(rr.Body.String(), created.Key))
+
+	req = httptest.NewRequest("DELETE", fmt.Sprintf("/api-keys/%d/", created.ID), nil)
+	req.AddCookie(authCookie)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	is.Equal(rr.Code, http.StatusNoContent)
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+created.Key)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	is.Equal(rr.Code, http.StatusUnauthorized)
+}
+
+func TestGetSessions(t *testing.T) {
+	db, cleanup, router := setupUsersController(t)
+	defer cleanup()
+	is := is.New(t)
+
+	user := models.User{Email: "user@email.com", Role: models.AnnotatorRole}
+	is.NoErr(db.Create(&user).Error)
+
+	tokenAuth := auth.NewTokenAuth(db)
+	authToken, tokenErr := tokenAuth.CreateAuthToken(&user)
+	is.NoErr(tokenErr)
+	authCookie, _ := tokenAuth.CreateAuthCookies(authToken)
+	_, tokenErr = tokenAuth.CreateAuthToken(&user)
+	is.NoErr(tokenErr)
+
+	req := httptest.NewRequest("GET", "/sessions/", nil)
+	req.AddCookie(authCookie)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	is.Equal(rr.Code, http.StatusOK)
+	is.True(!strings.Contains(rr.Body.String(), authToken.Token))
+
+	var sessions []*auth.Session
+	is.NoErr(json.NewDecoder(rr.Body).Decode(&sessions))
+	is.Equal(len(sessions), 2)
+	for _, session := range sessions {
+		is.Equal(session.Current, session.ID == authToken.ID)
+	}
+}
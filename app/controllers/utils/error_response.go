@@ -1,5 +1,14 @@
 package controllers_utils
 
+import (
+	dataset "backend/app/utils/dataset"
+)
+
 type ErrorResponse struct {
 	ErrorMessage string `json:"error"`
 }
+
+type ValidationErrorResponse struct {
+	ErrorMessage string                   `json:"error"`
+	Fields       dataset.ValidationErrors `json:"fields"`
+}
@@ -1,6 +1,7 @@
 package controllers_utils
 
 import (
+	dataset "backend/app/utils/dataset"
 	"encoding/json"
 	"errors"
 	"log"
@@ -30,3 +31,12 @@ func WriteError(err error, w http.ResponseWriter) {
 
 	json.NewEncoder(w).Encode(errResponse)
 }
+
+func WriteValidationErrors(errs dataset.ValidationErrors, w http.ResponseWriter) {
+	errResponse := &ValidationErrorResponse{
+		ErrorMessage: "Validation failed",
+		Fields:       errs,
+	}
+
+	json.NewEncoder(w).Encode(errResponse)
+}
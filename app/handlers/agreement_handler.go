@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"backend/app/models"
+	dataset "backend/app/utils/dataset"
+
+	"gorm.io/gorm"
+)
+
+type AgreementHandler struct {
+	DB *gorm.DB
+}
+
+func NewAgreementHandler(db *gorm.DB) *AgreementHandler {
+	return &AgreementHandler{
+		DB: db,
+	}
+}
+
+// GetAgreement compares the completed annotations of the users that annotated the same samples
+func (a *AgreementHandler) GetAgreement(datasetId uint) (*dataset.AgreementReport, error) {
+	sampleDataset := &models.Dataset{}
+	if dbErr := a.DB.Select("id", "metadata").First(sampleDataset, datasetId).Error; dbErr != nil {
+		return nil, dbErr
+	}
+
+	metadata, metadataErr := dataset.ParseMetadata(sampleDataset.Metadata)
+	if metadataErr != nil {
+		return nil, metadataErr
+	}
+
+	var sampleAnnotations []models.SampleAnnotation
+	dbErr := a.DB.
+		Joins("JOIN samples ON samples.id = sample_annotations.sample_id").
+		Where("samples.dataset_id = ? AND samples.deleted_at IS NULL AND sample_annotations.status IS NOT NULL", datasetId).
+		Order("sample_annotations.sample_id, sample_annotations.user_id").
+		Find(&sampleAnnotations).Error
+	if dbErr != nil {
+		return nil, dbErr
+	}
+
+	var samples [][]dataset.UserAnnotationData
+	var previousSampleId uint
+	for i, sampleAnnotation := range sampleAnnotations {
+		annotations, annotationsErr := dataset.ParseAnnotations(sampleAnnotation.Annotations)
+		if annotationsErr != nil {
+			return nil, annotationsErr
+		}
+
+		if i == 0 || sampleAnnotation.SampleID != previousSampleId {
+			samples = append(samples, []dataset.UserAnnotationData{})
+			previousSampleId = sampleAnnotation.SampleID
+		}
+
+		last := len(samples) - 1
+		samples[last] = append(samples[last], dataset.UserAnnotationData{
+			UserID:      sampleAnnotation.UserID,
+			Status:      sampleAnnotation.Status.String,
+			Annotations: annotations,
+		})
+	}
+
+	return dataset.ComputeAgreement(samples, metadata), nil
+}
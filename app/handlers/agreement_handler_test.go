@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"backend/app/models"
+	"testing"
+
+	"github.com/matryer/is"
+	"gorm.io/datatypes"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupDBForAgreementHandlerTests(t *testing.T) (*gorm.DB, func() error) {
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+
+	if err != nil {
+		t.Fatalf("failed to open sqlite connection: %v", err)
+	}
+
+	if migrationErr := db.AutoMigrate(&models.Dataset{}, &models.Sample{}, &models.SampleAnnotation{}); migrationErr != nil {
+		t.Fatalf("failed to migrate: %v", migrationErr)
+	}
+
+	sqlDB, sqlErr := db.DB()
+	if sqlErr != nil {
+		t.Fatalf("failed to obtain SQL DB: %v", sqlErr)
+	}
+	return db, sqlDB.Close
+}
+
+func TestGetAgreement(t *testing.T) {
+	db, cleanup := setupDBForAgreementHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewAgreementHandler(db)
+
+	annotations := datatypes.JSON(`{"entities": [{"id": 1, "start": 0, "end": 4, "tag": "PER"}], "relationships": []}`)
+	accepted := models.Accepted.ToNullString()
+	rejected := models.Rejected.ToNullString()
+
+	dataset := &models.Dataset{
+		Name:                 "dataset1",
+		Type:                 models.EntityAnnotation,
+		AnnotationsPerSample: 2,
+		Metadata:             datatypes.JSON(`{"entityTags": [{"name": "PER"}], "relationshipTags": []}`),
+		Samples: []models.Sample{
+			{Text: "John knows Jane", UserAnnotations: []models.SampleAnnotation{
+				{UserID: 1, Slot: 0, Status: accepted, Annotations: annotations},
+				{UserID: 2, Slot: 1, Status: accepted, Annotations: annotations},
+			}},
+			{Text: "Jane knows John", UserAnnotations: []models.SampleAnnotation{
+				{UserID: 1, Slot: 0, Status: rejected},
+				{UserID: 2, Slot: 1, Status: rejected, Annotations: annotations},
+			}},
+			{Text: "John and Jane", UserAnnotations: []models.SampleAnnotation{
+				{UserID: 1, Slot: 0, Status: accepted},
+				{UserID: 3, Slot: 1},
+			}},
+		},
+	}
+
+	is.NoErr(db.Create(&dataset).Error)
+	report, reportErr := handler.GetAgreement(dataset.ID)
+	is.NoErr(reportErr)
+
+	// the unfinished annotation of the third sample is ignored
+	is.Equal(report.Samples, 2)
+	is.True(report.StatusFleissKappa.Valid)
+	is.Equal(len(report.Pairs), 1)
+
+	pair := report.Pairs[0]
+	is.Equal(pair.Samples, 2)
+	is.Equal(pair.StatusKappa.Float64, 1.0)
+	is.Equal(pair.Entities.Exact.Matches, 1)
+	is.Equal(pair.Entities.Exact.Spans1, 1)
+	is.Equal(pair.Entities.Exact.Spans2, 2)
+	is.Equal(pair.EntitiesByTag["PER"].Exact.Matches, 1)
+}
@@ -0,0 +1,446 @@
+package handlers
+
+import (
+	"backend/app/models"
+	dataset "backend/app/utils/dataset"
+	dataset_import "backend/app/utils/dataset/import"
+	"backend/app/utils/preannotate"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"gopkg.in/guregu/null.v4"
+	"gorm.io/gorm"
+)
+
+const importBatchSize = 100
+
+type DedupMode string
+
+const (
+	DedupByContentHash DedupMode = "hash"
+	DedupByExternalID  DedupMode = "external_id"
+)
+
+// AppendOptions choose how appended samples are matched with the existing ones,
+// matched samples are skipped unless UpdateDuplicates is set. Added samples are pre-annotated by the PreAnnotator if any,
+// after the samples are committed.
+type AppendOptions struct {
+	Dedup            DedupMode
+	UpdateDuplicates bool
+	PreAnnotator     *preannotate.Model
+}
+
+// sampleKey is the dedup key of an existing sample
+type sampleKey struct {
+	ID        uint
+	SampleKey null.String
+}
+
+// deferredTagCheck keeps the tags of a sample that was read before the dataset metadata
+type deferredTagCheck struct {
+	index       int
+	sample      *models.Sample
+	sampleId    uint
+	annotations dataset.AnnotationData
+}
+
+type DatasetImportHandler struct {
+	DB *gorm.DB
+}
+
+func NewDatasetImportHandler(db *gorm.DB) *DatasetImportHandler {
+	return &DatasetImportHandler{
+		DB: db,
+	}
+}
+
+// ImportDataset creates a dataset with the samples of the reader, samples without human annotations
+// are pre-annotated by the user once the import is committed when a pre-annotator is given.
+// A failing pre-annotation is reported in the report and leaves the imported samples as they are.
+func (d *DatasetImportHandler) ImportDataset(reader dataset_import.DatasetReader, userId uint, preAnnotator *preannotate.Model) (*dataset_import.ImportReport, error) {
+	var report *dataset_import.ImportReport
+	var metadata *dataset.Metadata
+	var sampleIds []uint
+	txErr := d.DB.Transaction(func(tx *gorm.DB) error {
+		newDataset := &models.Dataset{Name: reader.Name()}
+		if createErr := tx.Create(newDataset).Error; createErr != nil {
+			return createErr
+		}
+
+		report = dataset_import.NewImportReport(newDataset)
+		if importErr := d.importSamples(tx, newDataset.ID, reader, report); importErr != nil {
+			return importErr
+		}
+
+		// name and metadata might have been read after the samples
+		metadata = reader.Metadata()
+		if metadata == nil {
+			metadata = &dataset.Metadata{}
+		}
+
+		metadataJson, metadataErr := dataset_import.MarshalDatasetMetadata(*metadata)
+		if metadataErr != nil {
+			return metadataErr
+		}
+
+		newDataset.Name = reader.Name()
+		newDataset.Metadata = metadataJson
+		if saveErr := tx.Save(newDataset).Error; saveErr != nil || preAnnotator == nil {
+			return saveErr
+		}
+
+		return tx.Model(&models.Sample{}).Where("dataset_id = ?", newDataset.ID).Order("id").Pluck("id", &sampleIds).Error
+	})
+
+	if txErr != nil {
+		return nil, txErr
+	}
+
+	// the samples are committed, so a failing model is reported instead of failing the import
+	if preAnnotator != nil {
+		if _, preAnnotationErr := NewPreAnnotationHandler(d.DB).preAnnotateSamples(metadata, sampleIds, userId, preAnnotator); preAnnotationErr != nil {
+			report.PreAnnotationError = null.StringFrom(preAnnotationErr.Error())
+		}
+	}
+
+	return report, nil
+}
+
+func (d *DatasetImportHandler) importSamples(tx *gorm.DB, datasetId uint, reader dataset_import.DatasetReader, report *dataset_import.ImportReport) error {
+	batch := make([]*models.Sample, 0, importBatchSize)
+	var deferredChecks []*deferredTagCheck
+	externalIds := map[string]bool{}
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if createErr := tx.Create(&batch).Error; createErr != nil {
+			return createErr
+		}
+
+		// only keep the ids of the deferred samples so that the batch can be released
+		for _, check := range deferredChecks {
+			if check.sample != nil {
+				check.sampleId = check.sample.ID
+				check.sample = nil
+			}
+		}
+
+		report.ImportedSamples += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	for index := 0; ; index++ {
+		sampleData, readErr := readSample(reader, index, report.Reject)
+		if errors.Is(readErr, io.EOF) {
+			break
+		} else if readErr != nil {
+			return readErr
+		} else if sampleData == nil {
+			continue
+		}
+
+		metadata := reader.Metadata()
+		if validationErrs := dataset_import.ValidateSampleData(sampleData, metadata); len(validationErrs) > 0 {
+			report.Reject(index, validationErrs)
+			continue
+		}
+
+		if sampleData.ExternalID.Valid {
+			if externalIds[sampleData.ExternalID.String] {
+				report.Reject(index, duplicateExternalIdErrors())
+				continue
+			}
+			externalIds[sampleData.ExternalID.String] = true
+		}
+
+		sample, mapErr := dataset_import.MapSingleSampleDataToSample(sampleData, datasetId)
+		if mapErr != nil {
+			return mapErr
+		}
+
+		batch = append(batch, sample)
+		if metadata == nil {
+			deferredChecks = append(deferredChecks, &deferredTagCheck{index: index, sample: sample, annotations: tagsOnly(&sampleData.Annotations)})
+		}
+
+		if len(batch) == importBatchSize {
+			if flushErr := flush(); flushErr != nil {
+				return flushErr
+			}
+		}
+	}
+
+	if flushErr := flush(); flushErr != nil {
+		return flushErr
+	}
+
+	return d.runDeferredTagChecks(tx, reader.Metadata(), deferredChecks, report)
+}
+
+// readSample reads the next sample of the reader, samples that cannot be decoded are rejected and returned as nil
+func readSample(reader dataset_import.DatasetReader, index int, reject func(int, dataset.ValidationErrors)) (*dataset.SampleData, error) {
+	sampleData, readErr := reader.Next()
+	if readErr == nil || errors.Is(readErr, io.EOF) {
+		return sampleData, readErr
+	}
+
+	var decodeErr *dataset_import.SampleDecodeError
+	if errors.As(readErr, &decodeErr) {
+		reject(index, dataset.ValidationErrors{{Field: "sample", Reason: decodeErr.Error()}})
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("%w: %v", dataset_import.ErrInvalidDataset, readErr)
+}
+
+// AppendSamples adds the samples of the reader to an existing dataset, they are validated against the tags of the dataset
+func (d *DatasetImportHandler) AppendSamples(datasetId uint, userId uint, reader dataset_import.DatasetReader, options *AppendOptions) (*dataset_import.AppendReport, error) {
+	var report *dataset_import.AppendReport
+	var metadata *dataset.Metadata
+	var addedIds []uint
+	txErr := d.DB.Transaction(func(tx *gorm.DB) error {
+		targetDataset := &models.Dataset{}
+		if dbErr := tx.First(targetDataset, datasetId).Error; dbErr != nil {
+			return dbErr
+		}
+
+		var metadataErr error
+		metadata, metadataErr = dataset.ParseMetadata(targetDataset.Metadata)
+		if metadataErr != nil {
+			return metadataErr
+		}
+
+		existingIds, keysErr := d.getSampleKeys(tx, datasetId, options)
+		if keysErr != nil {
+			return keysErr
+		}
+
+		// the external ids are checked with any dedup mode, so that updated duplicates can take new ones
+		externalIds, externalIdsErr := d.getSampleKeys(tx, datasetId, &AppendOptions{Dedup: DedupByExternalID})
+		if externalIdsErr != nil {
+			return externalIdsErr
+		}
+
+		report = dataset_import.NewAppendReport(targetDataset)
+		batch := make([]*models.Sample, 0, importBatchSize)
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+
+			if createErr := tx.Create(&batch).Error; createErr != nil {
+				return createErr
+			}
+
+			for _, sample := range batch {
+				addedIds = append(addedIds, sample.ID)
+			}
+
+			report.AddedSamples += len(batch)
+			batch = batch[:0]
+			return nil
+		}
+
+		for index := 0; ; index++ {
+			sampleData, readErr := readSample(reader, index, report.Reject)
+			if errors.Is(readErr, io.EOF) {
+				break
+			} else if readErr != nil {
+				return readErr
+			} else if sampleData == nil {
+				continue
+			}
+
+			if validationErrs := dataset_import.ValidateSampleData(sampleData, metadata); len(validationErrs) > 0 {
+				report.Reject(index, validationErrs)
+				continue
+			}
+
+			sample, mapErr := dataset_import.MapSingleSampleDataToSample(sampleData, datasetId)
+			if mapErr != nil {
+				return mapErr
+			}
+
+			key := sample.ContentHash
+			if options.Dedup == DedupByExternalID {
+				if !sample.ExternalID.Valid {
+					report.Reject(index, dataset.ValidationErrors{{Field: "external_id", Reason: "missing external id"}})
+					continue
+				}
+				key = sample.ExternalID.String
+			}
+
+			existingId, duplicate := existingIds[key]
+			if sample.ExternalID.Valid {
+				// an updated duplicate may keep its own external id, but not take the one of another sample
+				ownerId, taken := externalIds[sample.ExternalID.String]
+				updated := duplicate && existingId != 0 && options.UpdateDuplicates
+				if taken && (!duplicate || updated && ownerId != existingId) {
+					report.Reject(index, duplicateExternalIdErrors())
+					continue
+				}
+			}
+
+			// a zero id marks samples added by this import, their duplicates are always skipped
+			existingIds[key] = 0
+
+			switch {
+			case !duplicate:
+				if sample.ExternalID.Valid {
+					externalIds[sample.ExternalID.String] = 0
+				}
+				batch = append(batch, sample)
+				if len(batch) == importBatchSize {
+					if flushErr := flush(); flushErr != nil {
+						return flushErr
+					}
+				}
+			case existingId != 0 && options.UpdateDuplicates:
+				if updateErr := d.updateDuplicate(tx, existingId, userId, sample); updateErr != nil {
+					return updateErr
+				}
+				if sample.ExternalID.Valid {
+					externalIds[sample.ExternalID.String] = existingId
+				}
+				report.UpdatedSamples++
+			default:
+				report.SkippedSamples++
+			}
+		}
+
+		return flush()
+	})
+
+	if txErr != nil {
+		return nil, txErr
+	}
+
+	if options.PreAnnotator != nil {
+		if _, preAnnotationErr := NewPreAnnotationHandler(d.DB).preAnnotateSamples(metadata, addedIds, userId, options.PreAnnotator); preAnnotationErr != nil {
+			report.PreAnnotationError = null.StringFrom(preAnnotationErr.Error())
+		}
+	}
+
+	return report, nil
+}
+
+// getSampleKeys maps the dedup keys of the samples of the dataset to their ids
+func (d *DatasetImportHandler) getSampleKeys(tx *gorm.DB, datasetId uint, options *AppendOptions) (map[string]uint, error) {
+	query := tx.Model(&models.Sample{}).Where("dataset_id = ?", datasetId)
+	if options.Dedup == DedupByExternalID {
+		query = query.Select("id, external_id AS sample_key")
+	} else {
+		if backfillErr := d.backfillContentHashes(tx, datasetId); backfillErr != nil {
+			return nil, backfillErr
+		}
+		query = query.Select("id, content_hash AS sample_key")
+	}
+
+	var keys []sampleKey
+	if dbErr := query.Scan(&keys).Error; dbErr != nil {
+		return nil, dbErr
+	}
+
+	ids := make(map[string]uint, len(keys))
+	for _, key := range keys {
+		if key.SampleKey.Valid {
+			ids[key.SampleKey.String] = key.ID
+		}
+	}
+
+	return ids, nil
+}
+
+// backfillContentHashes hashes the samples that were created without a content hash
+func (d *DatasetImportHandler) backfillContentHashes(tx *gorm.DB, datasetId uint) error {
+	var samples []*models.Sample
+	return tx.Select("id", "text").
+		Where("dataset_id = ? AND (content_hash IS NULL OR content_hash = '')", datasetId).
+		FindInBatches(&samples, importBatchSize, func(batchTx *gorm.DB, batch int) error {
+			for _, sample := range samples {
+				if dbErr := tx.Model(sample).UpdateColumn("content_hash", dataset_import.ContentHash(sample.Text)).Error; dbErr != nil {
+					return dbErr
+				}
+			}
+
+			return nil
+		}).Error
+}
+
+func duplicateExternalIdErrors() dataset.ValidationErrors {
+	return dataset.ValidationErrors{{Field: "external_id", Reason: "duplicate external id"}}
+}
+
+// updateDuplicate overwrites an existing sample with the appended one and records the change as a revision,
+// the external id of the existing sample is only replaced when the appended one has one
+func (d *DatasetImportHandler) updateDuplicate(tx *gorm.DB, sampleId uint, userId uint, sample *models.Sample) error {
+	samplesHandler := &SamplesHandler{DB: tx}
+	existing := &models.Sample{}
+	existing.ID = sampleId
+
+	if versionErr := samplesHandler.bumpVersion(tx, existing, null.Int{}); versionErr != nil {
+		return versionErr
+	}
+
+	return samplesHandler.updateSample(tx, existing, &models.SampleRevision{UserID: userId, Action: models.ImportUpdateAction}, func(tx *gorm.DB) error {
+		updates := map[string]interface{}{
+			"text":         sample.Text,
+			"content_hash": sample.ContentHash,
+			"annotations":  sample.Annotations,
+			"metadata":     sample.Metadata,
+			"status":       sample.Status,
+		}
+		if sample.ExternalID.Valid {
+			updates["external_id"] = sample.ExternalID
+		}
+
+		return tx.Model(&models.Sample{}).Where("id = ?", sampleId).Updates(updates).Error
+	})
+}
+
+func (d *DatasetImportHandler) runDeferredTagChecks(tx *gorm.DB, metadata *dataset.Metadata, checks []*deferredTagCheck, report *dataset_import.ImportReport) error {
+	if metadata == nil || len(checks) == 0 {
+		return nil
+	}
+
+	for _, check := range checks {
+		if validationErrs := dataset.ValidateAnnotationTags(&check.annotations, metadata); len(validationErrs) > 0 {
+			if deleteErr := tx.Unscoped().Delete(&models.Sample{}, check.sampleId).Error; deleteErr != nil {
+				return deleteErr
+			}
+
+			report.ImportedSamples--
+			report.Reject(check.index, validationErrs)
+		}
+	}
+
+	sort.SliceStable(report.RejectedSamples, func(i, j int) bool {
+		return report.RejectedSamples[i].Index < report.RejectedSamples[j].Index
+	})
+
+	return nil
+}
+
+// tagsOnly copies only the parts of the annotations needed for the tag validation
+func tagsOnly(annotations *dataset.AnnotationData) dataset.AnnotationData {
+	result := dataset.AnnotationData{
+		Entities:      make([]dataset.Entity, len(annotations.Entities)),
+		Relationships: make([]dataset.Relationship, len(annotations.Relationships)),
+	}
+
+	for i, entity := range annotations.Entities {
+		result.Entities[i] = dataset.Entity{Tag: entity.Tag}
+	}
+
+	for i, relationship := range annotations.Relationships {
+		result.Relationships[i] = dataset.Relationship{Name: relationship.Name}
+	}
+
+	return result
+}
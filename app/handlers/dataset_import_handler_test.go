@@ -0,0 +1,588 @@
+package handlers
+
+import (
+	"archive/zip"
+	"backend/app/models"
+	dataset "backend/app/utils/dataset"
+	dataset_import "backend/app/utils/dataset/import"
+	"backend/app/utils/preannotate"
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+	"gopkg.in/guregu/null.v4"
+	"gorm.io/datatypes"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupDBForDatasetImportHandlerTests(t *testing.T) (*gorm.DB, func() error) {
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+
+	if err != nil {
+		t.Fatalf("failed to open sqlite connection: %v", err)
+	}
+
+	if migrationErr := db.AutoMigrate(&models.Sample{}); migrationErr != nil {
+		t.Fatalf("failed to migrate sample: %v", migrationErr)
+	}
+
+	if migrationErr := db.AutoMigrate(&models.Dataset{}); migrationErr != nil {
+		t.Fatalf("failed to migrate dataset: %v", migrationErr)
+	}
+
+	if migrationErr := db.AutoMigrate(&models.SampleRevision{}); migrationErr != nil {
+		t.Fatalf("failed to migrate sample revision: %v", migrationErr)
+	}
+
+	sqlDB, sqlErr := db.DB()
+	if sqlErr != nil {
+		t.Fatalf("failed to obtain SQL DB: %v", sqlErr)
+	}
+	return db, sqlDB.Close
+}
+
+func TestImportDataset(t *testing.T) {
+	db, cleanup := setupDBForDatasetImportHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewDatasetImportHandler(db)
+
+	data := `{
+		"name": "imported",
+		"metadata": {"entityTags": [{"name": "PER"}], "relationshipTags": [{"name": "knows"}]},
+		"samples": [
+			{"text": "John knows Jane", "annotations": {"entities": [{"id": 1, "start": 0, "end": 4, "tag": "PER"}, {"id": 2, "start": 11, "end": 15, "tag": "PER"}], "relationships": [{"id": 1, "entity1": 1, "entity2": 2, "name": "knows"}]}},
+			{"text": "short", "annotations": {"entities": [{"id": 1, "start": 0, "end": 10, "tag": "PER"}]}},
+			{"text": "John", "annotations": {"entities": [{"id": 1, "start": 0, "end": 4, "tag": "ORG"}]}},
+			{"text": "John", "status": "unknown"},
+			{"text": "John", "status": "accepted"}
+		]
+	}`
+
+	reader, readerErr := dataset_import.NewJsonDatasetReader(strings.NewReader(data))
+	is.NoErr(readerErr)
+
+	report, importErr := handler.ImportDataset(reader, 1, nil)
+	is.NoErr(importErr)
+	is.Equal(report.Dataset.Name, "imported")
+	is.Equal(report.ImportedSamples, 2)
+	is.Equal(len(report.RejectedSamples), 3)
+	is.Equal(report.RejectedSamples[0].Index, 1)
+	is.Equal(report.RejectedSamples[0].Errors[0].Field, "annotations.entities[0].end")
+	is.Equal(report.RejectedSamples[1].Index, 2)
+	is.Equal(report.RejectedSamples[1].Errors[0].Field, "annotations.entities[0].tag")
+	is.Equal(report.RejectedSamples[2].Index, 3)
+	is.Equal(report.RejectedSamples[2].Errors[0].Field, "status")
+
+	var samplesCount int64
+	is.NoErr(db.Model(&models.Sample{}).Where("dataset_id = ?", report.Dataset.ID).Count(&samplesCount).Error)
+	is.Equal(samplesCount, int64(2))
+}
+
+func TestImportDatasetWithMetadataAfterSamples(t *testing.T) {
+	db, cleanup := setupDBForDatasetImportHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewDatasetImportHandler(db)
+
+	data := `{
+		"samples": [
+			{"text": "John", "annotations": {"entities": [{"id": 1, "start": 0, "end": 4, "tag": "ORG"}]}},
+			{"text": "John", "annotations": {"entities": [{"id": 1, "start": 0, "end": 4, "tag": "PER"}]}}
+		],
+		"name": "late metadata",
+		"metadata": {"entityTags": [{"name": "PER"}]}
+	}`
+
+	reader, readerErr := dataset_import.NewJsonDatasetReader(strings.NewReader(data))
+	is.NoErr(readerErr)
+
+	report, importErr := handler.ImportDataset(reader, 1, nil)
+	is.NoErr(importErr)
+	is.Equal(report.ImportedSamples, 1)
+	is.Equal(len(report.RejectedSamples), 1)
+	is.Equal(report.RejectedSamples[0].Index, 0)
+
+	importedDataset := &models.Dataset{}
+	is.NoErr(db.Preload("Samples").First(importedDataset, report.Dataset.ID).Error)
+	is.Equal(importedDataset.Name, "late metadata")
+	is.Equal(len(importedDataset.Samples), 1)
+}
+
+func TestImportDatasetWithUndecodableSample(t *testing.T) {
+	db, cleanup := setupDBForDatasetImportHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewDatasetImportHandler(db)
+
+	data := `{"name": "dataset", "samples": [{"text": 1}, {"text": "ok"}]}`
+	reader, readerErr := dataset_import.NewJsonDatasetReader(strings.NewReader(data))
+	is.NoErr(readerErr)
+
+	report, importErr := handler.ImportDataset(reader, 1, nil)
+	is.NoErr(importErr)
+	is.Equal(report.ImportedSamples, 1)
+	is.Equal(len(report.RejectedSamples), 1)
+	is.Equal(report.RejectedSamples[0].Index, 0)
+}
+
+func TestImportMalformedDatasetRollsBack(t *testing.T) {
+	db, cleanup := setupDBForDatasetImportHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewDatasetImportHandler(db)
+
+	data := `{"name": "broken", "samples": [{"text": "ok"}, {"text": `
+	reader, readerErr := dataset_import.NewJsonDatasetReader(strings.NewReader(data))
+	is.NoErr(readerErr)
+
+	_, importErr := handler.ImportDataset(reader, 1, nil)
+	is.True(errors.Is(importErr, dataset_import.ErrInvalidDataset))
+
+	var datasetsCount int64
+	is.NoErr(db.Model(&models.Dataset{}).Count(&datasetsCount).Error)
+	is.Equal(datasetsCount, int64(0))
+
+	var samplesCount int64
+	is.NoErr(db.Model(&models.Sample{}).Count(&samplesCount).Error)
+	is.Equal(samplesCount, int64(0))
+}
+
+func TestImportJsonlDataset(t *testing.T) {
+	db, cleanup := setupDBForDatasetImportHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewDatasetImportHandler(db)
+
+	data := `{"name": "jsonl dataset", "metadata": {"entityTags": [{"name": "PER"}]}}
+{"text": "John", "annotations": {"entities": [{"id": 1, "start": 0, "end": 4, "tag": "PER"}]}}
+
+{"text": "John", "annotations": {"entities": [{"id": 1, "start": 0, "end": 4, "tag": "ORG"}]}}
+not json
+{"text": "Jane"}`
+
+	reader, readerErr := dataset_import.NewJsonlDatasetReader(strings.NewReader(data), "", nil)
+	is.NoErr(readerErr)
+
+	report, importErr := handler.ImportDataset(reader, 1, nil)
+	is.NoErr(importErr)
+	is.Equal(report.Dataset.Name, "jsonl dataset")
+	is.Equal(report.ImportedSamples, 2)
+	is.Equal(len(report.RejectedSamples), 2)
+	is.Equal(report.RejectedSamples[0].Index, 1)
+	is.Equal(report.RejectedSamples[1].Index, 2)
+}
+
+func TestImportDatasetWithDuplicateExternalIds(t *testing.T) {
+	db, cleanup := setupDBForDatasetImportHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewDatasetImportHandler(db)
+
+	data := `{"name": "external ids", "samples": [
+		{"external_id": "doc-1", "text": "John"},
+		{"external_id": "doc-1", "text": "Jane"},
+		{"text": "Jim"}
+	]}`
+
+	reader, readerErr := dataset_import.NewJsonDatasetReader(strings.NewReader(data))
+	is.NoErr(readerErr)
+
+	report, importErr := handler.ImportDataset(reader, 1, nil)
+	is.NoErr(importErr)
+	is.Equal(report.ImportedSamples, 2)
+	is.Equal(len(report.RejectedSamples), 1)
+	is.Equal(report.RejectedSamples[0].Index, 1)
+	is.Equal(report.RejectedSamples[0].Errors[0].Field, "external_id")
+}
+
+func TestImportDatasetWithPreAnnotator(t *testing.T) {
+	db, cleanup := setupDBForDatasetImportHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewDatasetImportHandler(db)
+
+	// the metadata is only known after the samples
+	data := `{"name": "pre-annotated", "samples": [
+		{"text": "John knows Acme"},
+		{"text": "Jane", "annotations": {"entities": [{"id": 1, "start": 0, "end": 4, "tag": "ORG"}]}}
+	], "metadata": {"entityTags": [{"name": "PER"}, {"name": "ORG"}]}}`
+
+	reader, readerErr := dataset_import.NewJsonDatasetReader(strings.NewReader(data))
+	is.NoErr(readerErr)
+
+	model, modelErr := preannotate.NewModel(&preannotate.Config{Backend: preannotate.DictionaryBackend, Rules: []preannotate.DictionaryRule{
+		{Tag: "PER", Terms: []string{"John", "Jane"}},
+		{Tag: "LOC", Terms: []string{"Acme"}},
+	}}, nil)
+	is.NoErr(modelErr)
+
+	report, importErr := handler.ImportDataset(reader, 1, model)
+	is.NoErr(importErr)
+	is.Equal(report.ImportedSamples, 2)
+
+	var samples []models.Sample
+	is.NoErr(db.Where("dataset_id = ?", report.Dataset.ID).Order("id").Find(&samples).Error)
+	is.Equal(len(samples), 2)
+
+	annotations, parsingErr := dataset.ParseAnnotations(samples[0].Annotations)
+	is.NoErr(parsingErr)
+	is.Equal(len(annotations.Entities), 1)
+	is.Equal(annotations.Entities[0].Tag.String, "PER")
+	is.Equal(annotations.Entities[0].Model, "dictionary")
+	is.Equal(samples[0].Version, uint(2))
+
+	// the pre-annotation is recorded after the import is committed
+	revision := &models.SampleRevision{}
+	is.NoErr(db.Where("sample_id = ?", samples[0].ID).First(revision).Error)
+	is.Equal(revision.Action, models.PreAnnotationAction)
+	is.Equal(revision.UserID, uint(1))
+
+	annotations, parsingErr = dataset.ParseAnnotations(samples[1].Annotations)
+	is.NoErr(parsingErr)
+	is.Equal(annotations.Entities[0].Tag.String, "ORG")
+	is.Equal(annotations.Entities[0].Model, "")
+	is.Equal(samples[1].Version, uint(1))
+}
+
+func TestImportDatasetWithFailingPreAnnotator(t *testing.T) {
+	db, cleanup := setupDBForDatasetImportHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewDatasetImportHandler(db)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	model, modelErr := preannotate.NewModel(&preannotate.Config{Backend: preannotate.WebhookBackend, URL: server.URL}, []string{server.URL})
+	is.NoErr(modelErr)
+
+	data := `{"name": "pre-annotated", "metadata": {"entityTags": [{"name": "PER"}]}, "samples": [{"text": "John"}]}`
+	reader, readerErr := dataset_import.NewJsonDatasetReader(strings.NewReader(data))
+	is.NoErr(readerErr)
+
+	// the committed dataset is reported along with the failure
+	report, importErr := handler.ImportDataset(reader, 1, model)
+	is.NoErr(importErr)
+	is.True(report.Dataset.ID != 0)
+	is.Equal(report.ImportedSamples, 1)
+	is.True(report.PreAnnotationError.Valid)
+
+	var samples []models.Sample
+	is.NoErr(db.Where("dataset_id = ?", report.Dataset.ID).Find(&samples).Error)
+	is.Equal(len(samples), 1)
+	is.Equal(samples[0].Version, uint(1))
+
+	reader, readerErr = dataset_import.NewJsonDatasetReader(strings.NewReader(`{"samples": [{"text": "Jane"}]}`))
+	is.NoErr(readerErr)
+
+	appendReport, appendErr := handler.AppendSamples(report.Dataset.ID, 1, reader, &AppendOptions{Dedup: DedupByContentHash, PreAnnotator: model})
+	is.NoErr(appendErr)
+	is.Equal(appendReport.AddedSamples, 1)
+	is.True(appendReport.PreAnnotationError.Valid)
+}
+
+func TestImportJsonlDatasetWithoutHeader(t *testing.T) {
+	db, cleanup := setupDBForDatasetImportHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewDatasetImportHandler(db)
+
+	data := `{"text": "John", "annotations": {"entities": [{"id": 1, "start": 0, "end": 4, "tag": "ORG"}]}}`
+	metadata := &dataset.Metadata{EntityTags: []dataset.Tag{{Name: "PER"}}}
+
+	reader, readerErr := dataset_import.NewJsonlDatasetReader(strings.NewReader(data), "from form", metadata)
+	is.NoErr(readerErr)
+
+	report, importErr := handler.ImportDataset(reader, 1, nil)
+	is.NoErr(importErr)
+	is.Equal(report.Dataset.Name, "from form")
+	is.Equal(report.ImportedSamples, 0)
+	is.Equal(len(report.RejectedSamples), 1)
+}
+
+func TestImportConllDataset(t *testing.T) {
+	db, cleanup := setupDBForDatasetImportHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewDatasetImportHandler(db)
+
+	data := `-DOCSTART- -X- -X- O
+
+John NNP B-NP B-PER
+Smith NNP I-NP I-PER
+visited VBD B-VP O
+Paris NNP B-NP B-LOC
+
+Broken NNP B-NP X-PER
+`
+
+	reader, readerErr := dataset_import.NewConllDatasetReader(strings.NewReader(data), "conll dataset", nil)
+	is.NoErr(readerErr)
+
+	report, importErr := handler.ImportDataset(reader, 1, nil)
+	is.NoErr(importErr)
+	is.Equal(report.ImportedSamples, 1)
+	is.Equal(len(report.RejectedSamples), 1)
+	is.Equal(report.RejectedSamples[0].Index, 1)
+
+	sample := &models.Sample{}
+	is.NoErr(db.Where("dataset_id = ?", report.Dataset.ID).First(sample).Error)
+	is.Equal(sample.Text, "John Smith visited Paris")
+
+	annotations, annotationsErr := dataset.ParseAnnotations(sample.Annotations)
+	is.NoErr(annotationsErr)
+	is.Equal(len(annotations.Entities), 2)
+	is.Equal(annotations.Entities[0].Start, uint(0))
+	is.Equal(annotations.Entities[0].End, uint(10))
+	is.Equal(annotations.Entities[1].Tag.String, "LOC")
+
+	metadata, metadataErr := dataset.ParseMetadata(report.Dataset.Metadata)
+	is.NoErr(metadataErr)
+	is.Equal(len(metadata.EntityTags), 2)
+}
+
+func TestImportSpacyDataset(t *testing.T) {
+	db, cleanup := setupDBForDatasetImportHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewDatasetImportHandler(db)
+
+	data := `[
+		{"text": "John lives in Paris", "ents": [{"start": 0, "end": 4, "label": "PER"}, {"start": 14, "end": 19, "label": "LOC"}], "tokens": []},
+		{"text": "Out of range", "ents": [{"start": 0, "end": 40, "label": "PER"}]}
+	]`
+
+	reader, readerErr := dataset_import.NewSpacyDatasetReader(strings.NewReader(data), "spacy dataset", nil)
+	is.NoErr(readerErr)
+
+	report, importErr := handler.ImportDataset(reader, 1, nil)
+	is.NoErr(importErr)
+	is.Equal(report.ImportedSamples, 1)
+	is.Equal(len(report.RejectedSamples), 1)
+	is.Equal(report.RejectedSamples[0].Index, 1)
+}
+
+func TestImportBratDataset(t *testing.T) {
+	db, cleanup := setupDBForDatasetImportHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewDatasetImportHandler(db)
+
+	var archive bytes.Buffer
+	zipWriter := zip.NewWriter(&archive)
+	files := map[string]string{
+		"annotation.conf": "[entities]\nPER\nORG\n[relations]\nworks_for\tArg1:PER, Arg2:ORG\n",
+		"doc1.txt":        "John works for Acme",
+		"doc1.ann":        "T4\tORG 15 19\tAcme\nT2\tPER 0 4\tJohn\nR9\tworks_for Arg1:T2 Arg2:T4\n",
+		"doc2.txt":        "No annotations here",
+	}
+
+	for name, content := range files {
+		fileWriter, createErr := zipWriter.Create(name)
+		is.NoErr(createErr)
+		_, writeErr := fileWriter.Write([]byte(content))
+		is.NoErr(writeErr)
+	}
+	is.NoErr(zipWriter.Close())
+
+	reader, readerErr := dataset_import.NewBratDatasetReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()), "brat dataset", nil)
+	is.NoErr(readerErr)
+
+	report, importErr := handler.ImportDataset(reader, 1, nil)
+	is.NoErr(importErr)
+	is.Equal(report.ImportedSamples, 2)
+	is.Equal(len(report.RejectedSamples), 0)
+
+	sample := &models.Sample{}
+	is.NoErr(db.Where("dataset_id = ? AND text = ?", report.Dataset.ID, "John works for Acme").First(sample).Error)
+
+	annotations, annotationsErr := dataset.ParseAnnotations(sample.Annotations)
+	is.NoErr(annotationsErr)
+	is.Equal(len(annotations.Relationships), 1)
+	is.Equal(annotations.Entities[annotations.Relationships[0].Entity1-1].Tag.String, "PER")
+	is.Equal(annotations.Entities[annotations.Relationships[0].Entity2-1].Tag.String, "ORG")
+}
+
+func TestAppendSamplesByContentHash(t *testing.T) {
+	db, cleanup := setupDBForDatasetImportHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewDatasetImportHandler(db)
+
+	// the existing sample has no content hash yet
+	existingDataset := &models.Dataset{
+		Name:     "dataset1",
+		Type:     models.EntityAnnotation,
+		Metadata: datatypes.JSON(`{"entityTags": [{"name": "PER"}], "relationshipTags": []}`),
+		Samples:  []models.Sample{{Text: "John knows Jane"}},
+	}
+	is.NoErr(db.Create(existingDataset).Error)
+
+	data := `{"samples": [
+		{"text": "John  knows\tJane"},
+		{"text": "Jane knows John"},
+		{"text": "Jane knows John"},
+		{"text": "John", "annotations": {"entities": [{"id": 1, "start": 0, "end": 4, "tag": "ORG"}]}}
+	]}`
+
+	reader, readerErr := dataset_import.NewJsonDatasetReader(strings.NewReader(data))
+	is.NoErr(readerErr)
+
+	report, appendErr := handler.AppendSamples(existingDataset.ID, 1, reader, &AppendOptions{Dedup: DedupByContentHash})
+	is.NoErr(appendErr)
+	is.Equal(report.Dataset.ID, existingDataset.ID)
+	is.Equal(report.AddedSamples, 1)
+	is.Equal(report.SkippedSamples, 2)
+	is.Equal(report.UpdatedSamples, 0)
+	is.Equal(len(report.RejectedSamples), 1)
+	is.Equal(report.RejectedSamples[0].Index, 3)
+
+	var samplesCount int64
+	is.NoErr(db.Model(&models.Sample{}).Where("dataset_id = ?", existingDataset.ID).Count(&samplesCount).Error)
+	is.Equal(samplesCount, int64(2))
+}
+
+func TestAppendSamplesByExternalId(t *testing.T) {
+	db, cleanup := setupDBForDatasetImportHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewDatasetImportHandler(db)
+
+	existingDataset := &models.Dataset{
+		Name:    "dataset1",
+		Type:    models.EntityAnnotation,
+		Samples: []models.Sample{{Text: "Old text", ExternalID: null.StringFrom("doc-1")}},
+	}
+	is.NoErr(db.Create(existingDataset).Error)
+
+	data := `{"samples": [
+		{"external_id": "doc-1", "text": "New text", "status": "accepted"},
+		{"external_id": "doc-2", "text": "Another text"},
+		{"external_id": "doc-2", "text": "Same id"},
+		{"text": "Without id"}
+	]}`
+
+	reader, readerErr := dataset_import.NewJsonDatasetReader(strings.NewReader(data))
+	is.NoErr(readerErr)
+
+	options := &AppendOptions{Dedup: DedupByExternalID, UpdateDuplicates: true}
+	report, appendErr := handler.AppendSamples(existingDataset.ID, 1, reader, options)
+	is.NoErr(appendErr)
+	is.Equal(report.AddedSamples, 1)
+	is.Equal(report.SkippedSamples, 1)
+	is.Equal(report.UpdatedSamples, 1)
+	is.Equal(len(report.RejectedSamples), 1)
+	is.Equal(report.RejectedSamples[0].Errors[0].Field, "external_id")
+
+	updated := &models.Sample{}
+	is.NoErr(db.First(updated, existingDataset.Samples[0].ID).Error)
+	is.Equal(updated.Text, "New text")
+	is.Equal(updated.ExternalID, null.StringFrom("doc-1"))
+	is.Equal(updated.Status, models.Accepted.ToNullString())
+	is.Equal(updated.Version, uint(2))
+
+	revision := &models.SampleRevision{}
+	is.NoErr(db.Where("sample_id = ?", updated.ID).First(revision).Error)
+	is.Equal(revision.Action, models.ImportUpdateAction)
+
+	added, addedErr := NewSamplesHandler(db).GetSampleByExternalID(existingDataset.ID, "doc-2")
+	is.NoErr(addedErr)
+	is.Equal(added.Text, "Another text")
+}
+
+func TestAppendSamplesWithUsedExternalId(t *testing.T) {
+	db, cleanup := setupDBForDatasetImportHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewDatasetImportHandler(db)
+
+	existingDataset := &models.Dataset{
+		Name:    "dataset1",
+		Type:    models.EntityAnnotation,
+		Samples: []models.Sample{{Text: "Old text", ExternalID: null.StringFrom("doc-1")}},
+	}
+	is.NoErr(db.Create(existingDataset).Error)
+
+	data := `{"samples": [
+		{"external_id": "doc-1", "text": "New text"},
+		{"external_id": "doc-2", "text": "Another text"}
+	]}`
+
+	reader, readerErr := dataset_import.NewJsonDatasetReader(strings.NewReader(data))
+	is.NoErr(readerErr)
+
+	report, appendErr := handler.AppendSamples(existingDataset.ID, 1, reader, &AppendOptions{Dedup: DedupByContentHash})
+	is.NoErr(appendErr)
+	is.Equal(report.AddedSamples, 1)
+	is.Equal(len(report.RejectedSamples), 1)
+	is.Equal(report.RejectedSamples[0].Index, 0)
+	is.Equal(report.RejectedSamples[0].Errors[0].Reason, "duplicate external id")
+}
+
+func TestAppendSamplesByContentHashUpdatesExternalIds(t *testing.T) {
+	db, cleanup := setupDBForDatasetImportHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewDatasetImportHandler(db)
+
+	existingDataset := &models.Dataset{
+		Name: "dataset1",
+		Type: models.EntityAnnotation,
+		Samples: []models.Sample{
+			{Text: "John knows Jane"},
+			{Text: "Jane knows John", ExternalID: null.StringFrom("doc-2")},
+		},
+	}
+	is.NoErr(db.Create(existingDataset).Error)
+
+	// the first duplicate gets the upstream id, the second one cannot take the id of another sample
+	data := `{"samples": [
+		{"external_id": "doc-1", "text": "John knows Jane"},
+		{"external_id": "doc-1", "text": "Jane knows John"}
+	]}`
+
+	reader, readerErr := dataset_import.NewJsonDatasetReader(strings.NewReader(data))
+	is.NoErr(readerErr)
+
+	options := &AppendOptions{Dedup: DedupByContentHash, UpdateDuplicates: true}
+	report, appendErr := handler.AppendSamples(existingDataset.ID, 1, reader, options)
+	is.NoErr(appendErr)
+	is.Equal(report.UpdatedSamples, 1)
+	is.Equal(len(report.RejectedSamples), 1)
+	is.Equal(report.RejectedSamples[0].Index, 1)
+
+	updated, updatedErr := NewSamplesHandler(db).GetSampleByExternalID(existingDataset.ID, "doc-1")
+	is.NoErr(updatedErr)
+	is.Equal(updated.ID, existingDataset.Samples[0].ID)
+
+	kept := &models.Sample{}
+	is.NoErr(db.First(kept, existingDataset.Samples[1].ID).Error)
+	is.Equal(kept.ExternalID, null.StringFrom("doc-2"))
+}
@@ -4,6 +4,7 @@ import (
 	"backend/app/models"
 	"time"
 
+	"gopkg.in/guregu/null.v4"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
@@ -12,15 +13,26 @@ type DatasetStats struct {
 	TotalSamples     int64 `json:"total_samples"`
 	CompletedSamples int64 `json:"completed_samples"`
 	PendingSamples   int64 `json:"pending_samples"`
+	AssignedSamples  int64 `json:"assigned_samples"`
 }
 
 type DatasetData struct {
-	ID        uint
-	Name      string             `json:"name"`
-	Type      models.DatasetType `json:"type"`
-	CreatedAt time.Time          `json:"created_at"`
-	Metadata  datatypes.JSON     `json:"metadata"`
-	Stats     *DatasetStats      `json:"stats"`
+	ID                   uint
+	Name                 string                  `json:"name"`
+	Type                 models.DatasetType      `json:"type"`
+	CreatedAt            time.Time               `json:"created_at"`
+	Metadata             datatypes.JSON          `json:"metadata"`
+	AnnotationsPerSample uint                    `json:"annotations_per_sample"`
+	SamplingStrategy     models.SamplingStrategy `json:"sampling_strategy"`
+	SamplingKey          null.String             `json:"sampling_key"`
+	Stats                *DatasetStats           `json:"stats"`
+}
+
+// UpdateDatasetData changes the fields that are set, an empty sampling key removes it
+type UpdateDatasetData struct {
+	AnnotationsPerSample null.Int    `json:"annotations_per_sample"`
+	SamplingStrategy     null.String `json:"sampling_strategy"`
+	SamplingKey          null.String `json:"sampling_key"`
 }
 
 type DatasetsHandler struct {
@@ -78,12 +90,15 @@ func (s *DatasetsHandler) GetDatasetData(id uint) (*DatasetData, error) {
 
 func (s *DatasetsHandler) mapDatasetToDatasetData(dataset *models.Dataset) *DatasetData {
 	return &DatasetData{
-		ID:        dataset.ID,
-		Name:      dataset.Name,
-		Type:      dataset.Type,
-		CreatedAt: dataset.CreatedAt,
-		Metadata:  dataset.Metadata,
-		Stats:     s.getDatasetsStats(dataset),
+		ID:                   dataset.ID,
+		Name:                 dataset.Name,
+		Type:                 dataset.Type,
+		CreatedAt:            dataset.CreatedAt,
+		Metadata:             dataset.Metadata,
+		AnnotationsPerSample: dataset.AnnotationsPerSample,
+		SamplingStrategy:     dataset.SamplingStrategy,
+		SamplingKey:          dataset.SamplingKey,
+		Stats:                s.getDatasetsStats(dataset),
 	}
 }
 
@@ -92,17 +107,56 @@ func (s *DatasetsHandler) getDatasetsStats(dataset *models.Dataset) *DatasetStat
 		TotalSamples:     0,
 		CompletedSamples: 0,
 		PendingSamples:   0,
+		AssignedSamples:  0,
 	}
 
 	completed := []models.StatusType{models.Accepted, models.Rejected, models.Uncertain}
 
 	stats.TotalSamples = s.DB.Model(dataset).Association("Samples").Count()
 	stats.CompletedSamples = s.DB.Model(dataset).Where("status IN ?", completed).Association("Samples").Count()
-	stats.PendingSamples = s.DB.Model(dataset).Where("status IS NULL AND assigned_to IS NULL").Association("Samples").Count()
+	// samples with unfinished annotations are assigned, other samples without status are pending
+	assignedSamples := s.DB.Model(&models.SampleAnnotation{}).Select("sample_id").Where("status IS NULL")
+	stats.PendingSamples = s.DB.Model(dataset).Where("status IS NULL AND id NOT IN (?)", assignedSamples).Association("Samples").Count()
+	stats.AssignedSamples = s.DB.Model(dataset).Where("status IS NULL AND id IN (?)", assignedSamples).Association("Samples").Count()
 
 	return stats
 }
 
+func (s *DatasetsHandler) PatchDataset(id uint, data *UpdateDatasetData) (*DatasetData, error) {
+	dataset, err := s.GetDataset(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.AnnotationsPerSample.Valid {
+		if dbErr := s.DB.Model(dataset).Update("annotations_per_sample", data.AnnotationsPerSample.Int64).Error; dbErr != nil {
+			return nil, dbErr
+		}
+	}
+
+	if data.SamplingStrategy.Valid || data.SamplingKey.Valid {
+		strategy, key := dataset.SamplingStrategy, dataset.SamplingKey
+		if data.SamplingStrategy.Valid {
+			strategy = models.SamplingStrategy(data.SamplingStrategy.String)
+		}
+		if data.SamplingKey.Valid {
+			key = null.NewString(data.SamplingKey.String, data.SamplingKey.String != "")
+		}
+
+		if validationErr := validateSampling(strategy, key); validationErr != nil {
+			return nil, validationErr
+		}
+
+		updates := map[string]interface{}{"sampling_strategy": strategy, "sampling_key": key}
+		if dbErr := s.DB.Model(dataset).Updates(updates).Error; dbErr != nil {
+			return nil, dbErr
+		}
+		dataset.SamplingStrategy, dataset.SamplingKey = strategy, key
+	}
+
+	return s.mapDatasetToDatasetData(dataset), nil
+}
+
 func (s *DatasetsHandler) DeleteDataset(id uint) error {
 	return s.DB.Delete(&models.Dataset{}, id).Error
 }
@@ -34,6 +34,10 @@ func setupDBForDatasetsHandlerTests(t *testing.T) (*gorm.DB, func() error) {
 		t.Fatalf("failed to migrate dataset: %v", migrationErr)
 	}
 
+	if migrationErr := db.AutoMigrate(&models.SampleAnnotation{}); migrationErr != nil {
+		t.Fatalf("failed to migrate sample annotation: %v", migrationErr)
+	}
+
 	if migrationErr := db.AutoMigrate(&models.UserDataset{}); migrationErr != nil {
 		t.Fatalf("failed to create user dataset pivot table: %v", migrationErr)
 	}
@@ -92,7 +96,7 @@ func TestDatasetStats(t *testing.T) {
 
 	samples := []models.Sample{
 		{DatasetID: dataset.ID, Status: models.Accepted.ToNullString()},
-		{DatasetID: dataset.ID, AssignedTo: null.IntFrom(1)},
+		{DatasetID: dataset.ID},
 		{DatasetID: dataset.ID},
 	}
 
@@ -100,6 +104,11 @@ func TestDatasetStats(t *testing.T) {
 		t.Fatalf("failed to create samples: %v", result.Error)
 	}
 
+	sampleAnnotation := &models.SampleAnnotation{SampleID: samples[1].ID, UserID: 1}
+	if result := db.Create(&sampleAnnotation); result.Error != nil {
+		t.Fatalf("failed to create sample annotation: %v", result.Error)
+	}
+
 	returnedDatasets := NewDatasetsHandler(db).GetDatasets()
 	if len(returnedDatasets) != 1 {
 		t.Fatalf("number of returned datasets should be 1: got %v", len(returnedDatasets))
@@ -118,6 +127,10 @@ func TestDatasetStats(t *testing.T) {
 	if stats.PendingSamples != 1 {
 		t.Fatalf("number of pending samples should be 1: %v", stats.PendingSamples)
 	}
+
+	if stats.AssignedSamples != 1 {
+		t.Fatalf("number of assigned samples should be 1: %v", stats.AssignedSamples)
+	}
 }
 
 func TestGetDataset(t *testing.T) {
@@ -197,6 +210,58 @@ func TestGetDatasetData(t *testing.T) {
 	}
 }
 
+func TestPatchDatasetSampling(t *testing.T) {
+	db, cleanup := setupDBForDatasetsHandlerTests(t)
+	defer cleanup()
+
+	dataset := &models.Dataset{
+		Name: "dataset1",
+		Type: models.EntityAnnotation,
+	}
+
+	if result := db.Create(&dataset); result.Error != nil {
+		t.Fatalf("failed to create dataset: %v", result.Error)
+	}
+
+	handler := NewDatasetsHandler(db)
+	invalidUpdates := []*UpdateDatasetData{
+		{SamplingStrategy: null.StringFrom("oldest")},
+		{SamplingStrategy: null.StringFrom(string(models.StratifiedSampling))},
+		{SamplingStrategy: null.StringFrom(string(models.UncertaintySampling)), SamplingKey: null.StringFrom("$.score")},
+	}
+
+	for _, update := range invalidUpdates {
+		if _, err := handler.PatchDataset(dataset.ID, update); !errors.Is(err, ErrInvalidSamplingStrategy) {
+			t.Fatalf("expected an invalid sampling strategy error, got %v", err)
+		}
+	}
+
+	data, err := handler.PatchDataset(dataset.ID, &UpdateDatasetData{
+		SamplingStrategy: null.StringFrom(string(models.StratifiedSampling)),
+		SamplingKey:      null.StringFrom("source_document"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error patching dataset: %v", err)
+	}
+
+	if data.SamplingStrategy != models.StratifiedSampling || data.SamplingKey.String != "source_document" {
+		t.Fatalf("sampling was not updated: got %v %v", data.SamplingStrategy, data.SamplingKey)
+	}
+
+	if _, err := handler.PatchDataset(dataset.ID, &UpdateDatasetData{SamplingKey: null.StringFrom("")}); !errors.Is(err, ErrInvalidSamplingStrategy) {
+		t.Fatalf("expected the stratified strategy to need a sampling key, got %v", err)
+	}
+
+	stored := &models.Dataset{}
+	if result := db.First(stored, dataset.ID); result.Error != nil {
+		t.Fatalf("failed to fetch dataset: %v", result.Error)
+	}
+
+	if stored.SamplingStrategy != models.StratifiedSampling || stored.SamplingKey.String != "source_document" {
+		t.Fatalf("sampling was not stored: got %v %v", stored.SamplingStrategy, stored.SamplingKey)
+	}
+}
+
 func TestGetDatasetForUser(t *testing.T) {
 	db, cleanup := setupDBForDatasetsHandlerTests(t)
 	defer cleanup()
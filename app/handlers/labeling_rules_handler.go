@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"backend/app/models"
+	dataset "backend/app/utils/dataset"
+	"backend/app/utils/preannotate"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"gopkg.in/guregu/null.v4"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// LabelingRulesModel marks the entities added by the labeling rules
+const LabelingRulesModel = "labeling_rules"
+
+var ErrInvalidLabelingRule = errors.New("invalid labeling rule")
+
+type LabelingRuleData struct {
+	Tag           string   `json:"tag"`
+	Terms         []string `json:"terms"`
+	Pattern       string   `json:"pattern"`
+	CaseSensitive bool     `json:"case_sensitive"`
+}
+
+type LabelingRuleReport struct {
+	RuleID     uint   `json:"rule_id"`
+	Tag        string `json:"tag"`
+	AddedSpans int    `json:"added_spans"`
+}
+
+type LabelingRulesResult struct {
+	DryRun           bool                  `json:"dry_run"`
+	MatchedSamples   int                   `json:"matched_samples"`
+	AnnotatedSamples int                   `json:"annotated_samples"`
+	AddedSpans       int                   `json:"added_spans"`
+	Rules            []*LabelingRuleReport `json:"rules"`
+}
+
+type LabelingRulesHandler struct {
+	DB *gorm.DB
+}
+
+func NewLabelingRulesHandler(db *gorm.DB) *LabelingRulesHandler {
+	return &LabelingRulesHandler{
+		DB: db,
+	}
+}
+
+func (l *LabelingRulesHandler) GetRules(datasetId uint) ([]*models.LabelingRule, error) {
+	rules := []*models.LabelingRule{}
+	if dbErr := l.DB.Where("dataset_id = ?", datasetId).Order("id").Find(&rules).Error; dbErr != nil {
+		return nil, dbErr
+	}
+
+	return rules, nil
+}
+
+func (l *LabelingRulesHandler) CreateRule(datasetId uint, data *LabelingRuleData) (*models.LabelingRule, error) {
+	rule := &models.LabelingRule{DatasetID: datasetId}
+	if validationErr := l.setRuleData(rule, data); validationErr != nil {
+		return nil, validationErr
+	}
+
+	if dbErr := l.DB.Create(rule).Error; dbErr != nil {
+		return nil, dbErr
+	}
+
+	return rule, nil
+}
+
+func (l *LabelingRulesHandler) UpdateRule(datasetId uint, ruleId uint, data *LabelingRuleData) (*models.LabelingRule, error) {
+	rule := &models.LabelingRule{}
+	if dbErr := l.DB.Where("dataset_id = ?", datasetId).First(rule, ruleId).Error; dbErr != nil {
+		return nil, dbErr
+	}
+
+	if validationErr := l.setRuleData(rule, data); validationErr != nil {
+		return nil, validationErr
+	}
+
+	if dbErr := l.DB.Select("tag", "terms", "pattern", "case_sensitive").Save(rule).Error; dbErr != nil {
+		return nil, dbErr
+	}
+
+	return rule, nil
+}
+
+func (l *LabelingRulesHandler) DeleteRule(datasetId uint, ruleId uint) error {
+	result := l.DB.Where("dataset_id = ?", datasetId).Delete(&models.LabelingRule{}, ruleId)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// setRuleData validates the data against the entity tags of the dataset and copies it to the rule
+func (l *LabelingRulesHandler) setRuleData(rule *models.LabelingRule, data *LabelingRuleData) error {
+	metadata, metadataErr := getDatasetMetadata(l.DB, rule.DatasetID)
+	if metadataErr != nil {
+		return metadataErr
+	}
+
+	if !metadata.HasEntityTag(data.Tag) {
+		return fmt.Errorf("%w: unknown entity tag %q", ErrInvalidLabelingRule, data.Tag)
+	}
+
+	if _, compileErr := preannotate.NewDictionaryPreAnnotator([]preannotate.DictionaryRule{dictionaryRule(data)}); compileErr != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidLabelingRule, compileErr)
+	}
+
+	terms, marshalErr := json.Marshal(data.Terms)
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	rule.Tag = data.Tag
+	rule.Terms = terms
+	rule.Pattern = data.Pattern
+	rule.CaseSensitive = data.CaseSensitive
+	return nil
+}
+
+func dictionaryRule(data *LabelingRuleData) preannotate.DictionaryRule {
+	return preannotate.DictionaryRule{Tag: data.Tag, Terms: data.Terms, Pattern: data.Pattern, CaseSensitive: data.CaseSensitive}
+}
+
+// ApplyRules adds the spans matched by the rules to the annotations of the pending samples. Matches that overlap
+// an existing entity are left out, so that spans created by humans are never changed. A dry run only counts the spans.
+func (l *LabelingRulesHandler) ApplyRules(datasetId uint, userId uint, dryRun bool) (*LabelingRulesResult, error) {
+	rules, rulesErr := l.GetRules(datasetId)
+	if rulesErr != nil {
+		return nil, rulesErr
+	}
+
+	result := &LabelingRulesResult{DryRun: dryRun, Rules: make([]*LabelingRuleReport, len(rules))}
+	dictionaryRules := make([]preannotate.DictionaryRule, len(rules))
+	for i, rule := range rules {
+		result.Rules[i] = &LabelingRuleReport{RuleID: rule.ID, Tag: rule.Tag}
+
+		data := &LabelingRuleData{Tag: rule.Tag, Pattern: rule.Pattern, CaseSensitive: rule.CaseSensitive}
+		if len(rule.Terms) > 0 {
+			if parsingErr := json.Unmarshal(rule.Terms, &data.Terms); parsingErr != nil {
+				return nil, parsingErr
+			}
+		}
+		dictionaryRules[i] = dictionaryRule(data)
+	}
+
+	if len(rules) == 0 {
+		return result, nil
+	}
+
+	dictionary, dictionaryErr := preannotate.NewDictionaryPreAnnotator(dictionaryRules)
+	if dictionaryErr != nil {
+		return nil, dictionaryErr
+	}
+
+	samplesHandler := NewSamplesHandler(l.DB)
+	pending, filterErr := samplesHandler.filterSamples(l.DB.Model(&models.Sample{}).Where("dataset_id = ?", datasetId), &SampleFilter{Status: PendingSampleFilter})
+	if filterErr != nil {
+		return nil, filterErr
+	}
+
+	var sampleIds []uint
+	if dbErr := pending.Order("id").Pluck("id", &sampleIds).Error; dbErr != nil {
+		return nil, dbErr
+	}
+	result.MatchedSamples = len(sampleIds)
+
+	txErr := l.DB.Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < len(sampleIds); start += bulkChunkSize {
+			end := start + bulkChunkSize
+			if end > len(sampleIds) {
+				end = len(sampleIds)
+			}
+
+			var samples []*models.Sample
+			if dbErr := tx.Where("id IN ?", sampleIds[start:end]).Order("id").Find(&samples).Error; dbErr != nil {
+				return dbErr
+			}
+
+			for _, sample := range samples {
+				annotations, added, labelErr := labelSample(sample, dictionary, result)
+				if labelErr != nil {
+					return labelErr
+				} else if added == 0 {
+					continue
+				}
+
+				result.AnnotatedSamples++
+				result.AddedSpans += added
+				if dryRun {
+					continue
+				}
+
+				if versionErr := samplesHandler.bumpVersion(tx, sample, null.Int{}); versionErr != nil {
+					return versionErr
+				}
+
+				revision := &models.SampleRevision{UserID: userId, Action: models.LabelingRulesAction}
+				updateErr := samplesHandler.updateSample(tx, sample, revision, func(tx *gorm.DB) error {
+					return tx.Model(&models.Sample{}).Where("id = ?", sample.ID).UpdateColumn("annotations", annotations).Error
+				})
+				if updateErr != nil {
+					return updateErr
+				}
+			}
+		}
+
+		return nil
+	})
+
+	if txErr != nil {
+		return nil, txErr
+	}
+
+	return result, nil
+}
+
+// labelSample adds the matches that do not overlap the entities of the sample and counts them per rule
+func labelSample(sample *models.Sample, dictionary *preannotate.DictionaryPreAnnotator, result *LabelingRulesResult) (datatypes.JSON, int, error) {
+	annotations, parsingErr := dataset.ParseAnnotations(sample.Annotations)
+	if parsingErr != nil {
+		return nil, 0, parsingErr
+	}
+
+	nextId := uint(1)
+	for _, entity := range annotations.Entities {
+		if entity.Id >= nextId {
+			nextId = entity.Id + 1
+		}
+	}
+
+	existing := len(annotations.Entities)
+	added := 0
+	for _, match := range dictionary.Match(sample.Text) {
+		overlaps := false
+		for _, entity := range annotations.Entities[:existing] {
+			if match.Start < entity.End && entity.Start < match.End {
+				overlaps = true
+				break
+			}
+		}
+
+		if overlaps {
+			continue
+		}
+
+		rule := result.Rules[match.Rule]
+		annotations.Entities = append(annotations.Entities, dataset.Entity{
+			Id:    nextId,
+			Start: match.Start,
+			End:   match.End,
+			Tag:   null.StringFrom(rule.Tag),
+			Model: LabelingRulesModel,
+		})
+		nextId++
+		rule.AddedSpans++
+		added++
+	}
+
+	if added == 0 {
+		return nil, 0, nil
+	}
+
+	if annotations.Relationships == nil {
+		annotations.Relationships = []dataset.Relationship{}
+	}
+
+	annotationsJson, marshalErr := json.Marshal(annotations)
+	return annotationsJson, added, marshalErr
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"backend/app/models"
+	dataset_utils "backend/app/utils/dataset"
+	"errors"
+	"testing"
+
+	"github.com/matryer/is"
+	"gopkg.in/guregu/null.v4"
+	"gorm.io/datatypes"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupDBForLabelingRulesHandlerTests(t *testing.T) (*gorm.DB, func() error) {
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+
+	if err != nil {
+		t.Fatalf("failed to open sqlite connection: %v", err)
+	}
+
+	if migrationErr := db.AutoMigrate(&models.Dataset{}, &models.Sample{}, &models.SampleAnnotation{}, &models.SampleRevision{}, &models.LabelingRule{}); migrationErr != nil {
+		t.Fatalf("failed to migrate: %v", migrationErr)
+	}
+
+	sqlDB, sqlErr := db.DB()
+	if sqlErr != nil {
+		t.Fatalf("failed to obtain SQL DB: %v", sqlErr)
+	}
+	return db, sqlDB.Close
+}
+
+func TestLabelingRules(t *testing.T) {
+	db, cleanup := setupDBForLabelingRulesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewLabelingRulesHandler(db)
+
+	dataset := &models.Dataset{
+		Name:     "dataset1",
+		Type:     models.EntityAnnotation,
+		Metadata: datatypes.JSON(`{"entityTags": [{"name": "PER"}, {"name": "ORG"}], "relationshipTags": []}`),
+	}
+	is.NoErr(db.Create(dataset).Error)
+
+	_, ruleErr := handler.CreateRule(dataset.ID, &LabelingRuleData{Tag: "LOC", Terms: []string{"Paris"}})
+	is.True(errors.Is(ruleErr, ErrInvalidLabelingRule))
+	_, ruleErr = handler.CreateRule(dataset.ID, &LabelingRuleData{Tag: "ORG", Pattern: "[A-Z"})
+	is.True(errors.Is(ruleErr, ErrInvalidLabelingRule))
+	_, ruleErr = handler.CreateRule(dataset.ID, &LabelingRuleData{Tag: "ORG"})
+	is.True(errors.Is(ruleErr, ErrInvalidLabelingRule))
+
+	names, ruleErr := handler.CreateRule(dataset.ID, &LabelingRuleData{Tag: "PER", Terms: []string{"Jon"}})
+	is.NoErr(ruleErr)
+	names, ruleErr = handler.UpdateRule(dataset.ID, names.ID, &LabelingRuleData{Tag: "PER", Terms: []string{"John", "Jane"}})
+	is.NoErr(ruleErr)
+	is.Equal(names.Terms, datatypes.JSON(`["John","Jane"]`))
+	companies, ruleErr := handler.CreateRule(dataset.ID, &LabelingRuleData{Tag: "ORG", Pattern: `[A-Z][a-z]+ Inc`, CaseSensitive: true})
+	is.NoErr(ruleErr)
+	unused, ruleErr := handler.CreateRule(dataset.ID, &LabelingRuleData{Tag: "ORG", Terms: []string{"Initech"}})
+	is.NoErr(ruleErr)
+	is.NoErr(handler.DeleteRule(dataset.ID, unused.ID))
+	is.True(errors.Is(handler.DeleteRule(dataset.ID, unused.ID), gorm.ErrRecordNotFound))
+
+	rules, rulesErr := handler.GetRules(dataset.ID)
+	is.NoErr(rulesErr)
+	is.Equal(len(rules), 2)
+
+	human := datatypes.JSON(`{"entities": [{"id": 3, "start": 0, "end": 4, "tag": "ORG"}], "relationships": []}`)
+	samples := []models.Sample{
+		{DatasetID: dataset.ID, Text: "John works for Acme Inc"},
+		{DatasetID: dataset.ID, Text: "John knows Jane", Annotations: human},
+		{DatasetID: dataset.ID, Text: "Nothing to see"},
+		{DatasetID: dataset.ID, Text: "Jane works for Acme Inc", Status: models.Accepted.ToNullString()},
+	}
+	is.NoErr(db.Create(&samples).Error)
+
+	expected := LabelingRulesResult{
+		MatchedSamples:   3,
+		AnnotatedSamples: 2,
+		AddedSpans:       3,
+		Rules: []*LabelingRuleReport{
+			{RuleID: names.ID, Tag: "PER", AddedSpans: 2},
+			{RuleID: companies.ID, Tag: "ORG", AddedSpans: 1},
+		},
+	}
+
+	preview, applyErr := handler.ApplyRules(dataset.ID, 1, true)
+	is.NoErr(applyErr)
+	expected.DryRun = true
+	is.Equal(*preview, expected)
+
+	for _, sample := range samples {
+		stored := &models.Sample{}
+		is.NoErr(db.First(stored, sample.ID).Error)
+		is.Equal(stored.Annotations, sample.Annotations)
+	}
+
+	result, applyErr := handler.ApplyRules(dataset.ID, 1, false)
+	is.NoErr(applyErr)
+	expected.DryRun = false
+	is.Equal(*result, expected)
+
+	stored := &models.Sample{}
+	is.NoErr(db.First(stored, samples[0].ID).Error)
+	is.Equal(stored.Version, uint(2))
+	annotations, parsingErr := dataset_utils.ParseAnnotations(stored.Annotations)
+	is.NoErr(parsingErr)
+	is.Equal(annotations.Entities, []dataset_utils.Entity{
+		{Id: 1, Start: 0, End: 4, Tag: null.StringFrom("PER"), Model: LabelingRulesModel},
+		{Id: 2, Start: 15, End: 23, Tag: null.StringFrom("ORG"), Model: LabelingRulesModel},
+	})
+
+	// the human span is kept and the overlapping match is left out
+	stored = &models.Sample{}
+	is.NoErr(db.First(stored, samples[1].ID).Error)
+	annotations, parsingErr = dataset_utils.ParseAnnotations(stored.Annotations)
+	is.NoErr(parsingErr)
+	is.Equal(annotations.Entities, []dataset_utils.Entity{
+		{Id: 3, Start: 0, End: 4, Tag: null.StringFrom("ORG")},
+		{Id: 4, Start: 11, End: 15, Tag: null.StringFrom("PER"), Model: LabelingRulesModel},
+	})
+
+	revision := &models.SampleRevision{}
+	is.NoErr(db.Where("sample_id = ?", samples[1].ID).First(revision).Error)
+	is.Equal(revision.Action, models.LabelingRulesAction)
+	is.Equal(revision.OldAnnotations, human)
+
+	stored = &models.Sample{}
+	is.NoErr(db.First(stored, samples[3].ID).Error)
+	is.Equal(stored.Annotations, samples[3].Annotations)
+
+	// applying again adds nothing
+	result, applyErr = handler.ApplyRules(dataset.ID, 1, false)
+	is.NoErr(applyErr)
+	is.Equal(result.AddedSpans, 0)
+}
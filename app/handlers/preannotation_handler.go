@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"backend/app/models"
+	dataset "backend/app/utils/dataset"
+	"backend/app/utils/preannotate"
+	"encoding/json"
+	"errors"
+
+	"gopkg.in/guregu/null.v4"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+type PreAnnotationResult struct {
+	MatchedSamples   int `json:"matched_samples"`
+	AnnotatedSamples int `json:"annotated_samples"`
+	SkippedSamples   int `json:"skipped_samples"`
+}
+
+type PreAnnotationHandler struct {
+	DB *gorm.DB
+	// WebhookURLs are the model servers that webhook pre-annotators may post to
+	WebhookURLs []string
+}
+
+func NewPreAnnotationHandler(db *gorm.DB) *PreAnnotationHandler {
+	return &PreAnnotationHandler{
+		DB: db,
+	}
+}
+
+// NewModel builds the pre-annotator of the config, webhooks must post to one of the WebhookURLs
+func (p *PreAnnotationHandler) NewModel(config *preannotate.Config) (*preannotate.Model, error) {
+	return preannotate.NewModel(config, p.WebhookURLs)
+}
+
+// PreAnnotateDataset replaces the annotations of the samples that nobody has worked on with the ones of the model.
+// Samples with a status, with users or with human annotations are left alone, so that it can be run again with a new model.
+func (p *PreAnnotationHandler) PreAnnotateDataset(datasetId uint, userId uint, model *preannotate.Model) (*PreAnnotationResult, error) {
+	metadata, metadataErr := getDatasetMetadata(p.DB, datasetId)
+	if metadataErr != nil {
+		return nil, metadataErr
+	}
+
+	var sampleIds []uint
+	dbErr := p.DB.Model(&models.Sample{}).
+		Where("dataset_id = ? AND status IS NULL AND review_status IS NULL", datasetId).
+		Where("NOT EXISTS (SELECT 1 FROM sample_annotations WHERE sample_annotations.sample_id = samples.id AND sample_annotations.deleted_at IS NULL)").
+		Order("id").
+		Pluck("id", &sampleIds).Error
+	if dbErr != nil {
+		return nil, dbErr
+	}
+
+	return p.preAnnotateSamples(metadata, sampleIds, userId, model)
+}
+
+// preAnnotateSamples sets the annotations of the model on the samples without human annotations, each sample
+// is written in its own transaction with a revision so that the model never runs inside of a transaction
+func (p *PreAnnotationHandler) preAnnotateSamples(metadata *dataset.Metadata, sampleIds []uint, userId uint, model *preannotate.Model) (*PreAnnotationResult, error) {
+	result := &PreAnnotationResult{MatchedSamples: len(sampleIds)}
+	samplesHandler := NewSamplesHandler(p.DB)
+	annotateErr := forEachPreAnnotation(p.DB, model, metadata, sampleIds, func(sample *models.Sample, annotations datatypes.JSON) error {
+		if annotations == nil {
+			result.SkippedSamples++
+			return nil
+		}
+
+		// the model runs outside of a transaction, samples changed in the meantime are skipped
+		txErr := p.DB.Transaction(func(tx *gorm.DB) error {
+			if versionErr := samplesHandler.bumpVersion(tx, sample, null.IntFrom(int64(sample.Version))); versionErr != nil {
+				return versionErr
+			}
+
+			revision := &models.SampleRevision{UserID: userId, Action: models.PreAnnotationAction}
+			return samplesHandler.updateSample(tx, sample, revision, func(tx *gorm.DB) error {
+				return tx.Model(&models.Sample{}).Where("id = ?", sample.ID).UpdateColumn("annotations", annotations).Error
+			})
+		})
+
+		if errors.Is(txErr, ErrVersionConflict) {
+			result.SkippedSamples++
+			return nil
+		} else if txErr != nil {
+			return txErr
+		}
+
+		result.AnnotatedSamples++
+		return nil
+	})
+
+	if annotateErr != nil {
+		return nil, annotateErr
+	}
+
+	return result, nil
+}
+
+// forEachPreAnnotation runs the model on the samples, the annotations passed to apply are nil
+// when the sample already has human annotations
+func forEachPreAnnotation(db *gorm.DB, model *preannotate.Model, metadata *dataset.Metadata, sampleIds []uint, apply func(sample *models.Sample, annotations datatypes.JSON) error) error {
+	for start := 0; start < len(sampleIds); start += bulkChunkSize {
+		end := start + bulkChunkSize
+		if end > len(sampleIds) {
+			end = len(sampleIds)
+		}
+
+		var samples []*models.Sample
+		if dbErr := db.Select("id", "text", "annotations", "version").Where("id IN ?", sampleIds[start:end]).Order("id").Find(&samples).Error; dbErr != nil {
+			return dbErr
+		}
+
+		for _, sample := range samples {
+			existing, parsingErr := dataset.ParseAnnotations(sample.Annotations)
+			if parsingErr != nil {
+				return parsingErr
+			}
+
+			if existing.HasHumanAnnotations() {
+				if applyErr := apply(sample, nil); applyErr != nil {
+					return applyErr
+				}
+				continue
+			}
+
+			annotations, annotateErr := model.Annotate(sample.Text, metadata)
+			if annotateErr != nil {
+				return annotateErr
+			}
+
+			annotationsJson, marshalErr := json.Marshal(annotations)
+			if marshalErr != nil {
+				return marshalErr
+			}
+
+			if applyErr := apply(sample, annotationsJson); applyErr != nil {
+				return applyErr
+			}
+		}
+	}
+
+	return nil
+}
+
+func getDatasetMetadata(db *gorm.DB, datasetId uint) (*dataset.Metadata, error) {
+	targetDataset := &models.Dataset{}
+	if dbErr := db.Select("id", "metadata").First(targetDataset, datasetId).Error; dbErr != nil {
+		return nil, dbErr
+	}
+
+	return dataset.ParseMetadata(targetDataset.Metadata)
+}
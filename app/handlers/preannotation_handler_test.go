@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"backend/app/models"
+	dataset_utils "backend/app/utils/dataset"
+	"backend/app/utils/preannotate"
+	"testing"
+
+	"github.com/matryer/is"
+	"gopkg.in/guregu/null.v4"
+	"gorm.io/datatypes"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupDBForPreAnnotationHandlerTests(t *testing.T) (*gorm.DB, func() error) {
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+
+	if err != nil {
+		t.Fatalf("failed to open sqlite connection: %v", err)
+	}
+
+	if migrationErr := db.AutoMigrate(&models.Dataset{}, &models.Sample{}, &models.SampleAnnotation{}, &models.SampleRevision{}); migrationErr != nil {
+		t.Fatalf("failed to migrate: %v", migrationErr)
+	}
+
+	sqlDB, sqlErr := db.DB()
+	if sqlErr != nil {
+		t.Fatalf("failed to obtain SQL DB: %v", sqlErr)
+	}
+	return db, sqlDB.Close
+}
+
+func newTestDictionaryModel(is *is.I, name string) *preannotate.Model {
+	model, modelErr := preannotate.NewModel(&preannotate.Config{
+		Backend: preannotate.DictionaryBackend,
+		Name:    name,
+		Rules:   []preannotate.DictionaryRule{{Tag: "PER", Terms: []string{"John", "Jane"}}},
+	}, nil)
+	is.NoErr(modelErr)
+
+	return model
+}
+
+func TestPreAnnotateDataset(t *testing.T) {
+	db, cleanup := setupDBForPreAnnotationHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewPreAnnotationHandler(db)
+
+	human := datatypes.JSON(`{"entities": [{"id": 1, "start": 0, "end": 4, "tag": "PER"}], "relationships": []}`)
+	predicted := datatypes.JSON(`{"entities": [{"id": 1, "start": 0, "end": 4, "tag": "PER", "model": "old"}], "relationships": []}`)
+	dataset := &models.Dataset{
+		Name:     "dataset1",
+		Type:     models.EntityAnnotation,
+		Metadata: datatypes.JSON(`{"entityTags": [{"name": "PER"}], "relationshipTags": []}`),
+		Samples: []models.Sample{
+			{Text: "John knows Jane"},
+			{Text: "John knows Jane", Annotations: predicted},
+			{Text: "John knows Jane", Annotations: human},
+			{Text: "John knows Jane", Status: models.Accepted.ToNullString()},
+			{Text: "John knows Jane", UserAnnotations: []models.SampleAnnotation{{UserID: 1}}},
+		},
+	}
+	is.NoErr(db.Create(dataset).Error)
+
+	result, preAnnotationErr := handler.PreAnnotateDataset(dataset.ID, 2, newTestDictionaryModel(is, "names"))
+	is.NoErr(preAnnotationErr)
+	is.Equal(*result, PreAnnotationResult{MatchedSamples: 3, AnnotatedSamples: 2, SkippedSamples: 1})
+
+	for _, index := range []int{0, 1} {
+		sample := &models.Sample{}
+		is.NoErr(db.First(sample, dataset.Samples[index].ID).Error)
+		is.Equal(sample.Version, uint(2))
+
+		annotations, parsingErr := dataset_utils.ParseAnnotations(sample.Annotations)
+		is.NoErr(parsingErr)
+		is.Equal(annotations.Entities, []dataset_utils.Entity{
+			{Id: 1, Start: 0, End: 4, Tag: null.StringFrom("PER"), Model: "names"},
+			{Id: 2, Start: 11, End: 15, Tag: null.StringFrom("PER"), Model: "names"},
+		})
+	}
+
+	revision := &models.SampleRevision{}
+	is.NoErr(db.Where("sample_id = ?", dataset.Samples[1].ID).First(revision).Error)
+	is.Equal(revision.Action, models.PreAnnotationAction)
+	is.Equal(revision.OldAnnotations, predicted)
+
+	for _, index := range []int{2, 3, 4} {
+		sample := &models.Sample{}
+		is.NoErr(db.First(sample, dataset.Samples[index].ID).Error)
+		is.Equal(sample.Annotations, dataset.Samples[index].Annotations)
+	}
+}
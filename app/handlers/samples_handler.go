@@ -2,31 +2,167 @@ package handlers
 
 import (
 	"backend/app/models"
+	dataset "backend/app/utils/dataset"
+	dataset_diff "backend/app/utils/dataset/diff"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
+
 	"gopkg.in/guregu/null.v4"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
+const DefaultLeaseTTL = time.Hour * 2
+
+const DefaultSamplesPageSize = 50
+const MaxSamplesPageSize = 500
+
+// bulkChunkSize keeps the number of ids in a single query below the limits of the databases
+const bulkChunkSize = 500
+
+const (
+	PendingSampleFilter  = "pending"
+	AssignedSampleFilter = "assigned"
+)
+
+var ErrLeaseNotHeld = errors.New("sample is not assigned to the user")
+
+var ErrVersionConflict = errors.New("sample has been changed by someone else")
+
+var ErrInvalidReviewTransition = errors.New("sample is not in review")
+
+var ErrInvalidSampleQuery = errors.New("invalid sample query")
+
+var ErrInvalidBulkOperation = errors.New("invalid bulk operation")
+
+var ErrInvalidPriorityUpdate = errors.New("invalid priority update")
+
+var ErrInvalidRestore = errors.New("revision cannot be restored")
+
+var ErrSampleUnderReview = errors.New("sample is under review, only reviewers can change it")
+
+// errSampleTaken is returned when a sample is filled up by other users while it is being assigned
+var errSampleTaken = errors.New("sample has been taken")
+
 type UpdateSampleData struct {
 	Status      null.String    `json:"status"`
 	Annotations datatypes.JSON `json:"annotations"`
 	Metadata    datatypes.JSON `json:"metadata"`
+	// Version is the version of the sample the update is based on, the update fails with ErrVersionConflict
+	// when the sample has changed since. Updates without a version are not checked.
+	Version null.Int `json:"-"`
+}
+
+type MergeSampleData struct {
+	Status      null.String    `json:"status"`
+	Annotations datatypes.JSON `json:"annotations"`
+}
+
+// DiffSource selects the annotations of a revision or of a user, the current annotations of the sample otherwise
+type DiffSource struct {
+	RevisionID null.Int
+	UserID     null.Int
+}
+
+// SampleFilter selects samples of a dataset. Status is a status type, pending or assigned.
+type SampleFilter struct {
+	Status        string   `json:"status"`
+	AssignedTo    null.Int `json:"assigned_to"`
+	EntityTag     string   `json:"entity_tag"`
+	Text          string   `json:"text"`
+	MetadataKey   string   `json:"metadata_key"`
+	MetadataValue string   `json:"metadata_value"`
+}
+
+// SampleQuery sorts and pages the filtered samples, pages are continued with the cursor returned with the previous page
+type SampleQuery struct {
+	SampleFilter
+	Limit      int
+	Cursor     string
+	SortBy     string
+	Descending bool
+}
+
+type SamplePage struct {
+	Samples    []*models.Sample `json:"samples"`
+	NextCursor null.String      `json:"next_cursor"`
+}
+
+// sampleCursor holds the sort value and the id of the last sample of a page
+type sampleCursor struct {
+	Value string `json:"v"`
+	ID    uint   `json:"id"`
+}
+
+var sampleSortColumns = map[string]string{
+	"id":         "id",
+	"updated_at": "updated_at",
+	"status":     "COALESCE(status, '')",
+}
+
+type BulkOperation string
+
+const (
+	BulkResetStatus BulkOperation = "reset_status"
+	BulkReassign    BulkOperation = "reassign"
+	BulkUnassign    BulkOperation = "unassign"
+	BulkDelete      BulkOperation = "delete"
+	BulkRenameTag   BulkOperation = "rename_tag"
+)
+
+// BulkSampleData selects samples by their ids, a filter or both. Reassign moves the unfinished annotations
+// of FromUserID to ToUserID, unassign removes the unfinished annotations of FromUserID or of everyone.
+type BulkSampleData struct {
+	SampleIDs  []uint        `json:"sample_ids"`
+	Filter     *SampleFilter `json:"filter"`
+	Operation  BulkOperation `json:"operation"`
+	FromUserID null.Int      `json:"from_user_id"`
+	ToUserID   null.Int      `json:"to_user_id"`
+	OldTag     string        `json:"old_tag"`
+	NewTag     string        `json:"new_tag"`
+}
+
+type BulkSampleResult struct {
+	MatchedSamples      int64 `json:"matched_samples"`
+	AffectedSamples     int64 `json:"affected_samples"`
+	AffectedAnnotations int64 `json:"affected_annotations"`
+}
+
+// PriorityUpdate sets the priority of the sample with the given id or external id, a null priority removes it
+type PriorityUpdate struct {
+	SampleID   null.Int    `json:"sample_id"`
+	ExternalID null.String `json:"external_id"`
+	Priority   null.Float  `json:"priority"`
+}
+
+type PriorityUpdateResult struct {
+	UpdatedSamples int64 `json:"updated_samples"`
+	MissingSamples int64 `json:"missing_samples"`
 }
 
 type SamplesHandler struct {
-	DB *gorm.DB
+	DB       *gorm.DB
+	LeaseTTL time.Duration
 }
 
 func NewSamplesHandler(db *gorm.DB) *SamplesHandler {
 	return &SamplesHandler{
-		DB: db,
+		DB:       db,
+		LeaseTTL: DefaultLeaseTTL,
 	}
 }
 
+// GetSamples returns the samples of the dataset with their completed per-user annotations
 func (s *SamplesHandler) GetSamples(datasetId uint) ([]*models.Sample, error) {
 	var samples []*models.Sample
-	if dbErr := s.DB.Where("dataset_id = ?", datasetId).Find(&samples).Error; dbErr != nil {
+	dbErr := s.DB.Where("dataset_id = ?", datasetId).
+		Preload("UserAnnotations", "status IS NOT NULL").
+		Find(&samples).Error
+	if dbErr != nil {
 		return nil, dbErr
 	}
 
@@ -42,6 +178,154 @@ func (s *SamplesHandler) GetSamplesWithStatus(datasetId uint, status models.Stat
 	return samples, nil
 }
 
+func (s *SamplesHandler) ListSamples(datasetId uint, query *SampleQuery) (*SamplePage, error) {
+	sortBy := query.SortBy
+	if sortBy == "" {
+		sortBy = "id"
+	}
+
+	sortColumn, ok := sampleSortColumns[sortBy]
+	if !ok {
+		return nil, fmt.Errorf("%w: cannot sort by %q", ErrInvalidSampleQuery, sortBy)
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultSamplesPageSize
+	} else if limit > MaxSamplesPageSize {
+		limit = MaxSamplesPageSize
+	}
+
+	db, filterErr := s.filterSamples(s.DB.Where("dataset_id = ?", datasetId), &query.SampleFilter)
+	if filterErr != nil {
+		return nil, filterErr
+	}
+
+	direction, comparison := "ASC", ">"
+	if query.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	if query.Cursor != "" {
+		cursor, cursorErr := decodeSampleCursor(query.Cursor)
+		if cursorErr != nil {
+			return nil, cursorErr
+		}
+
+		if sortBy == "id" {
+			db = db.Where("id "+comparison+" ?", cursor.ID)
+		} else {
+			var value interface{} = cursor.Value
+			if sortBy == "updated_at" {
+				updatedAt, parseErr := time.Parse(time.RFC3339Nano, cursor.Value)
+				if parseErr != nil {
+					return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidSampleQuery)
+				}
+				value = updatedAt
+			}
+
+			db = db.Where(
+				fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))", sortColumn, comparison, sortColumn, comparison),
+				value, value, cursor.ID,
+			)
+		}
+	}
+
+	var samples []*models.Sample
+	orderBy := fmt.Sprintf("%s %s, id %s", sortColumn, direction, direction)
+	if sortBy == "id" {
+		orderBy = "id " + direction
+	}
+
+	if dbErr := db.Order(orderBy).Limit(limit + 1).Find(&samples).Error; dbErr != nil {
+		return nil, dbErr
+	}
+
+	page := &SamplePage{Samples: samples}
+	if len(samples) > limit {
+		page.Samples = samples[:limit]
+		page.NextCursor = null.StringFrom(encodeSampleCursor(page.Samples[limit-1], sortBy))
+	}
+
+	return page, nil
+}
+
+func (s *SamplesHandler) filterSamples(db *gorm.DB, filter *SampleFilter) (*gorm.DB, error) {
+	assignedSamples := s.DB.Model(&models.SampleAnnotation{}).Select("sample_id").Where("status IS NULL")
+
+	switch filter.Status {
+	case "":
+	case PendingSampleFilter:
+		db = db.Where("status IS NULL AND id NOT IN (?)", assignedSamples)
+	case AssignedSampleFilter:
+		db = db.Where("status IS NULL AND id IN (?)", assignedSamples)
+	default:
+		if statusErr := models.StatusType(filter.Status).IsValid(); statusErr != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSampleQuery, statusErr)
+		}
+		db = db.Where("status = ?", filter.Status)
+	}
+
+	if filter.AssignedTo.Valid {
+		userSamples := s.DB.Model(&models.SampleAnnotation{}).Select("sample_id").Where("user_id = ?", filter.AssignedTo.Int64)
+		db = db.Where("id IN (?)", userSamples)
+	}
+
+	if filter.EntityTag != "" {
+		db = db.Where(entityTagCondition(s.DB.Dialector.Name()), filter.EntityTag)
+	}
+
+	if filter.Text != "" {
+		db = db.Where("text LIKE ? ESCAPE '!'", "%"+escapeLike(filter.Text)+"%")
+	}
+
+	if filter.MetadataKey != "" {
+		db = db.Where(datatypes.JSONQuery("metadata").Equals(filter.MetadataValue, filter.MetadataKey))
+	}
+
+	return db, nil
+}
+
+// entityTagCondition matches the samples with an entity of the given tag in their annotations
+func entityTagCondition(dialect string) string {
+	if dialect == "mysql" {
+		return "JSON_CONTAINS(JSON_EXTRACT(annotations, '$.entities[*].tag'), JSON_QUOTE(?))"
+	}
+
+	return "EXISTS (SELECT 1 FROM json_each(samples.annotations, '$.entities') WHERE json_extract(json_each.value, '$.tag') = ?)"
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(value)
+}
+
+func encodeSampleCursor(sample *models.Sample, sortBy string) string {
+	cursor := sampleCursor{ID: sample.ID}
+	switch sortBy {
+	case "updated_at":
+		cursor.Value = sample.UpdatedAt.Format(time.RFC3339Nano)
+	case "status":
+		cursor.Value = sample.Status.String
+	}
+
+	encoded, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodeSampleCursor(value string) (*sampleCursor, error) {
+	decoded, decodeErr := base64.RawURLEncoding.DecodeString(value)
+	if decodeErr != nil {
+		return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidSampleQuery)
+	}
+
+	cursor := &sampleCursor{}
+	if parsingErr := json.Unmarshal(decoded, cursor); parsingErr != nil {
+		return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidSampleQuery)
+	}
+
+	return cursor, nil
+}
+
 func (s *SamplesHandler) GetSample(datasetId uint, sampleId uint) (*models.Sample, error) {
 	sample := &models.Sample{}
 
@@ -52,59 +336,1150 @@ func (s *SamplesHandler) GetSample(datasetId uint, sampleId uint) (*models.Sampl
 	return sample, nil
 }
 
-func (s *SamplesHandler) PatchSample(datasetId uint, sampleId uint, data *UpdateSampleData) (*models.Sample, error) {
+// GetSampleForUser returns the sample together with the annotation of the user, if the user has one
+func (s *SamplesHandler) GetSampleForUser(datasetId uint, sampleId uint, userId uint) (*models.Sample, error) {
 	sample := &models.Sample{}
-	updateData := models.Sample{Annotations: data.Annotations, Metadata: data.Metadata, Status: data.Status}
-	if dbErr := s.DB.Where("dataset_id = ?", datasetId).First(&sample, sampleId).Updates(updateData).Error; dbErr != nil {
+	dbErr := s.DB.
+		Preload("UserAnnotations", "user_id = ?", userId).
+		Where("dataset_id = ?", datasetId).
+		First(&sample, sampleId).Error
+	if dbErr != nil {
 		return nil, dbErr
 	}
 
 	return sample, nil
 }
 
-func (s *SamplesHandler) findUnassignedSample(datasetId uint) (*models.Sample, error) {
+func (s *SamplesHandler) GetSampleByExternalID(datasetId uint, externalId string) (*models.Sample, error) {
 	sample := &models.Sample{}
-	if dbErr := s.DB.Where("status IS NULL AND dataset_id = ? AND assigned_to IS NULL", datasetId).First(&sample).Error; dbErr != nil {
+
+	if dbErr := s.DB.Where("dataset_id = ? AND external_id = ?", datasetId, externalId).First(&sample).Error; dbErr != nil {
 		return nil, dbErr
 	}
 
 	return sample, nil
 }
 
-func (s *SamplesHandler) findAssignedSample(datasetId uint, userId uint) (*models.Sample, error) {
+// PatchSample updates the annotations of the user when the sample is assigned to them,
+// other samples are updated directly unless they are under review and the user is no reviewer
+func (s *SamplesHandler) PatchSample(datasetId uint, sampleId uint, user *models.User, data *UpdateSampleData) (*models.Sample, error) {
+	userId := user.ID
 	sample := &models.Sample{}
-	if dbErr := s.DB.Where("status IS NULL AND dataset_id = ? AND assigned_to = ?", datasetId, userId).First(&sample).Error; dbErr != nil {
+	if dbErr := s.DB.Where("dataset_id = ?", datasetId).First(&sample, sampleId).Error; dbErr != nil {
 		return nil, dbErr
 	}
 
+	if validationErr := s.validateSampleUpdate(sample, data); validationErr != nil {
+		return nil, validationErr
+	}
+
+	sampleAnnotation, annotationErr := s.findSampleAnnotation(sample.ID, userId)
+	if annotationErr != nil && !errors.Is(annotationErr, gorm.ErrRecordNotFound) {
+		return nil, annotationErr
+	}
+
+	txErr := s.DB.Transaction(func(tx *gorm.DB) error {
+		// the annotation of the user is checked against its own version
+		if sampleAnnotation != nil {
+			if versionErr := s.bumpAnnotationVersion(tx, sampleAnnotation, data.Version); versionErr != nil {
+				return versionErr
+			}
+
+			return s.patchSampleAnnotation(tx, sample, sampleAnnotation, userId, data)
+		}
+
+		if versionErr := s.bumpVersion(tx, sample, data.Version); versionErr != nil {
+			return versionErr
+		}
+
+		// samples in review or approved are only changed through the review, returned samples are back with the annotators
+		reviewStatus := models.ReviewStatusType(sample.ReviewStatus.String)
+		if (reviewStatus == models.InReview || reviewStatus == models.Approved) && !user.Role.CanReview() {
+			return ErrSampleUnderReview
+		}
+
+		updateData := models.Sample{Annotations: data.Annotations, Metadata: data.Metadata, Status: data.Status}
+		if data.Status.Valid && models.ReviewStatusType(sample.ReviewStatus.String).CanTransitionTo(models.InReview) {
+			updateData.ReviewStatus = models.InReview.ToNullString()
+		}
+
+		return s.updateSample(tx, sample, &models.SampleRevision{UserID: userId, Action: models.SampleUpdateAction}, func(tx *gorm.DB) error {
+			return tx.Model(&models.Sample{}).Where("id = ?", sample.ID).Updates(updateData).Error
+		})
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+
 	return sample, nil
 }
 
+// bumpVersion increments the version of the sample, when the expected version is given the increment
+// only succeeds if the sample still has it. Every write to a sample bumps its version once.
+func (s *SamplesHandler) bumpVersion(tx *gorm.DB, sample *models.Sample, expected null.Int) error {
+	query := tx.Model(&models.Sample{}).Where("id = ?", sample.ID)
+	if expected.Valid {
+		query = query.Where("version = ?", expected.Int64)
+	}
+
+	result := query.UpdateColumn("version", gorm.Expr("version + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+
+	current := &models.Sample{}
+	if dbErr := tx.Select("id", "version").First(current, sample.ID).Error; dbErr != nil {
+		return dbErr
+	}
+
+	sample.Version = current.Version
+	return nil
+}
+
+// bumpAnnotationVersion increments the version of the user annotation like bumpVersion does for the sample
+func (s *SamplesHandler) bumpAnnotationVersion(tx *gorm.DB, sampleAnnotation *models.SampleAnnotation, expected null.Int) error {
+	query := tx.Model(&models.SampleAnnotation{}).Where("id = ?", sampleAnnotation.ID)
+	if expected.Valid {
+		query = query.Where("version = ?", expected.Int64)
+	}
+
+	result := query.UpdateColumn("version", gorm.Expr("version + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+
+	current := &models.SampleAnnotation{}
+	if dbErr := tx.Select("id", "version").First(current, sampleAnnotation.ID).Error; dbErr != nil {
+		return dbErr
+	}
+
+	sampleAnnotation.Version = current.Version
+	return nil
+}
+
+// updateSample runs the update and completes the revision with the state of the sample before and after it,
+// the sample is refreshed with its new state
+func (s *SamplesHandler) updateSample(tx *gorm.DB, sample *models.Sample, revision *models.SampleRevision, update func(tx *gorm.DB) error) error {
+	before := &models.Sample{}
+	if dbErr := tx.First(before, sample.ID).Error; dbErr != nil {
+		return dbErr
+	}
+
+	if updateErr := update(tx); updateErr != nil {
+		return updateErr
+	}
+
+	after := &models.Sample{}
+	if dbErr := tx.First(after, sample.ID).Error; dbErr != nil {
+		return dbErr
+	}
+
+	revision.SampleID = sample.ID
+	revision.OldAnnotations = before.Annotations
+	revision.NewAnnotations = after.Annotations
+	revision.OldMetadata = before.Metadata
+	revision.NewMetadata = after.Metadata
+	revision.OldStatus = before.Status
+	revision.NewStatus = after.Status
+	if dbErr := tx.Create(revision).Error; dbErr != nil {
+		return dbErr
+	}
+
+	*sample = *after
+	return nil
+}
+
+func (s *SamplesHandler) patchSampleAnnotation(tx *gorm.DB, sample *models.Sample, sampleAnnotation *models.SampleAnnotation, userId uint, data *UpdateSampleData) error {
+	revision := &models.SampleRevision{
+		SampleID:           sample.ID,
+		SampleAnnotationID: null.IntFrom(int64(sampleAnnotation.ID)),
+		UserID:             userId,
+		Action:             models.AnnotationUpdateAction,
+		OldAnnotations:     sampleAnnotation.Annotations,
+		OldMetadata:        sample.Metadata,
+		OldStatus:          sampleAnnotation.Status,
+	}
+
+	updateData := models.SampleAnnotation{Annotations: data.Annotations, Status: data.Status}
+	if dbErr := tx.Model(sampleAnnotation).Updates(updateData).Error; dbErr != nil {
+		return dbErr
+	}
+
+	if len(data.Metadata) > 0 {
+		if versionErr := s.bumpVersion(tx, sample, null.Int{}); versionErr != nil {
+			return versionErr
+		}
+
+		if dbErr := tx.Model(sample).Update("metadata", data.Metadata).Error; dbErr != nil {
+			return dbErr
+		}
+	}
+
+	revision.NewAnnotations = sampleAnnotation.Annotations
+	revision.NewMetadata = sample.Metadata
+	revision.NewStatus = sampleAnnotation.Status
+	if dbErr := tx.Create(revision).Error; dbErr != nil {
+		return dbErr
+	}
+
+	if sampleAnnotation.Status.Valid {
+		if completeErr := s.completeSample(tx, sample, userId); completeErr != nil {
+			return completeErr
+		}
+	}
+
+	sample.UserAnnotations = []models.SampleAnnotation{*sampleAnnotation}
+	return nil
+}
+
+// completeSample sets the status of the sample once it has the configured number of completed annotations
+// and moves it to review. The status is the one all annotators agree on, uncertain otherwise.
+// A single annotation is copied to the sample. Approved samples are left as they are.
+func (s *SamplesHandler) completeSample(tx *gorm.DB, sample *models.Sample, userId uint) error {
+	if sample.ReviewStatus.String == string(models.Approved) {
+		return nil
+	}
+
+	annotationsPerSample, datasetErr := s.getAnnotationsPerSample(tx, sample.DatasetID)
+	if datasetErr != nil {
+		return datasetErr
+	}
+
+	var completed []models.SampleAnnotation
+	if dbErr := tx.Where("sample_id = ? AND status IS NOT NULL", sample.ID).Order("id").Find(&completed).Error; dbErr != nil {
+		return dbErr
+	}
+
+	if uint(len(completed)) < annotationsPerSample {
+		return nil
+	}
+
+	status := completed[0].Status
+	for _, sampleAnnotation := range completed[1:] {
+		if sampleAnnotation.Status != status {
+			status = models.Uncertain.ToNullString()
+		}
+	}
+
+	updateData := models.Sample{Status: status}
+	if len(completed) == 1 {
+		updateData.Annotations = completed[0].Annotations
+	}
+
+	if models.ReviewStatusType(sample.ReviewStatus.String).CanTransitionTo(models.InReview) {
+		updateData.ReviewStatus = models.InReview.ToNullString()
+	}
+
+	if versionErr := s.bumpVersion(tx, sample, null.Int{}); versionErr != nil {
+		return versionErr
+	}
+
+	return s.updateSample(tx, sample, &models.SampleRevision{UserID: userId, Action: models.CompletionAction}, func(tx *gorm.DB) error {
+		return tx.Model(&models.Sample{}).Where("id = ?", sample.ID).Updates(updateData).Error
+	})
+}
+
+// validateSampleUpdate checks the annotations against the sample text and the dataset tags,
+// it returns dataset.ValidationErrors when the update is invalid
+func (s *SamplesHandler) validateSampleUpdate(sample *models.Sample, data *UpdateSampleData) error {
+	if len(data.Annotations) == 0 {
+		return nil
+	}
+
+	annotations, parsingErr := dataset.ParseAnnotations(data.Annotations)
+	if parsingErr != nil {
+		return dataset.ValidationErrors{{Field: "annotations", Reason: parsingErr.Error()}}
+	}
+
+	sampleDataset := &models.Dataset{}
+	if dbErr := s.DB.Select("id", "metadata").First(sampleDataset, sample.DatasetID).Error; dbErr != nil {
+		return dbErr
+	}
+
+	metadata, metadataErr := dataset.ParseMetadata(sampleDataset.Metadata)
+	if metadataErr != nil {
+		return metadataErr
+	}
+
+	if validationErrs := dataset.ValidateAnnotations(sample.Text, annotations, metadata); len(validationErrs) > 0 {
+		return validationErrs
+	}
+
+	return nil
+}
+
+func (s *SamplesHandler) getAnnotationsPerSample(db *gorm.DB, datasetId uint) (uint, error) {
+	sampleDataset := &models.Dataset{}
+	if dbErr := db.Select("id", "annotations_per_sample").First(sampleDataset, datasetId).Error; dbErr != nil {
+		return 0, dbErr
+	}
+
+	return annotationsPerSampleOf(sampleDataset), nil
+}
+
+func annotationsPerSampleOf(sampleDataset *models.Dataset) uint {
+	if sampleDataset.AnnotationsPerSample == 0 {
+		return 1
+	}
+
+	return sampleDataset.AnnotationsPerSample
+}
+
+func (s *SamplesHandler) findSampleAnnotation(sampleId uint, userId uint) (*models.SampleAnnotation, error) {
+	sampleAnnotation := &models.SampleAnnotation{}
+	if dbErr := s.DB.Where("sample_id = ? AND user_id = ?", sampleId, userId).First(sampleAnnotation).Error; dbErr != nil {
+		return nil, dbErr
+	}
+
+	return sampleAnnotation, nil
+}
+
+// findUnassignedSample finds a sample that still needs annotations and that the user has not annotated yet,
+// the sampling strategy of the dataset picks one when there are several
+func (s *SamplesHandler) findUnassignedSample(sampleDataset *models.Dataset, userId uint, annotationsPerSample uint) (*models.Sample, error) {
+	pickSample, samplerErr := getSampler(sampleDataset)
+	if samplerErr != nil {
+		return nil, samplerErr
+	}
+
+	candidates := func() *gorm.DB {
+		userSamples := s.DB.Unscoped().Model(&models.SampleAnnotation{}).Select("sample_id").Where("user_id = ?", userId)
+		return s.DB.Model(&models.Sample{}).
+			Where("samples.status IS NULL AND samples.dataset_id = ? AND samples.id NOT IN (?)", sampleDataset.ID, userSamples).
+			Where("(SELECT COUNT(*) FROM sample_annotations WHERE sample_annotations.sample_id = samples.id) < ?", annotationsPerSample)
+	}
+
+	return pickSample(s.DB, candidates, sampleDataset)
+}
+
+func (s *SamplesHandler) findAssignedSampleAnnotation(datasetId uint, userId uint) (*models.SampleAnnotation, error) {
+	sampleAnnotation := &models.SampleAnnotation{}
+	dbErr := s.DB.
+		Joins("JOIN samples ON samples.id = sample_annotations.sample_id").
+		Where("samples.dataset_id = ? AND samples.status IS NULL AND samples.deleted_at IS NULL", datasetId).
+		Where("sample_annotations.user_id = ? AND sample_annotations.status IS NULL", userId).
+		First(sampleAnnotation).Error
+	if dbErr != nil {
+		return nil, dbErr
+	}
+
+	return sampleAnnotation, nil
+}
+
+// assignSample creates the annotation of the user in the first free slot of the sample,
+// the unique indexes make the assignment atomic on both SQLite and MySQL
+func (s *SamplesHandler) assignSample(sample *models.Sample, userId uint, annotationsPerSample uint) (*models.SampleAnnotation, error) {
+	var takenSlots []uint
+	if dbErr := s.DB.Unscoped().Model(&models.SampleAnnotation{}).Where("sample_id = ?", sample.ID).Pluck("slot", &takenSlots).Error; dbErr != nil {
+		return nil, dbErr
+	}
+
+	taken := map[uint]bool{}
+	for _, slot := range takenSlots {
+		taken[slot] = true
+	}
+
+	var slot uint
+	for slot < annotationsPerSample && taken[slot] {
+		slot++
+	}
+
+	if slot == annotationsPerSample {
+		return nil, errSampleTaken
+	}
+
+	sampleAnnotation := &models.SampleAnnotation{
+		SampleID:       sample.ID,
+		UserID:         userId,
+		Slot:           slot,
+		LeaseExpiresAt: null.TimeFrom(s.newLeaseExpiration()),
+	}
+
+	if createErr := s.DB.Create(sampleAnnotation).Error; createErr != nil {
+		var conflicts int64
+		countErr := s.DB.Unscoped().Model(&models.SampleAnnotation{}).
+			Where("sample_id = ? AND (slot = ? OR user_id = ?)", sample.ID, slot, userId).
+			Count(&conflicts).Error
+		if countErr == nil && conflicts > 0 {
+			return nil, errSampleTaken
+		}
+
+		return nil, createErr
+	}
+
+	return sampleAnnotation, nil
+}
+
 func (s *SamplesHandler) findAndAssignSample(datasetId uint, userId uint) (*models.Sample, error) {
-	// find unassigned sample
-	unassignedSample, err := s.findUnassignedSample(datasetId)
-	if err != nil {
-		return nil, err
+	sampleDataset := &models.Dataset{}
+	if dbErr := s.DB.Select("id", "annotations_per_sample", "sampling_strategy", "sampling_key").First(sampleDataset, datasetId).Error; dbErr != nil {
+		return nil, dbErr
 	}
 
-	// assign the sample to the user
-	if updateErr := s.DB.Model(&unassignedSample).Updates(models.Sample{AssignedTo: null.IntFrom(int64(userId))}).Error; updateErr != nil {
-		return nil, updateErr
+	annotationsPerSample := annotationsPerSampleOf(sampleDataset)
+
+	for {
+		unassignedSample, err := s.findUnassignedSample(sampleDataset, userId, annotationsPerSample)
+		if err != nil {
+			return nil, err
+		}
+
+		sampleAnnotation, assignErr := s.assignSample(unassignedSample, userId, annotationsPerSample)
+		if assignErr != nil {
+			if errors.Is(assignErr, errSampleTaken) {
+				// somebody else has taken the sample in the meantime
+				continue
+			}
+			return nil, assignErr
+		}
+
+		unassignedSample.UserAnnotations = []models.SampleAnnotation{*sampleAnnotation}
+		return unassignedSample, nil
 	}
-	return unassignedSample, nil
 }
 
 func (s *SamplesHandler) AssignNextSample(datasetId uint, userId uint) (*models.Sample, error) {
 	// find already assigned sample
-	assignedSample, assignedSampleErr := s.findAssignedSample(datasetId, userId)
-	if assignedSampleErr != nil {
-		if errors.Is(assignedSampleErr, gorm.ErrRecordNotFound) {
+	sampleAnnotation, assignedErr := s.findAssignedSampleAnnotation(datasetId, userId)
+	if assignedErr != nil {
+		if errors.Is(assignedErr, gorm.ErrRecordNotFound) {
 			// if there isn't an already assigned sample then assign a new one
 			return s.findAndAssignSample(datasetId, userId)
 		} else {
-			return nil, assignedSampleErr
+			return nil, assignedErr
+		}
+	}
+
+	// returning the sample to the user renews the lease
+	if leaseErr := s.renewLease(sampleAnnotation); leaseErr != nil {
+		if errors.Is(leaseErr, ErrLeaseNotHeld) {
+			// the lease was released in the meantime
+			return s.findAndAssignSample(datasetId, userId)
 		}
+		return nil, leaseErr
 	}
 
+	assignedSample, sampleErr := s.GetSample(datasetId, sampleAnnotation.SampleID)
+	if sampleErr != nil {
+		return nil, sampleErr
+	}
+
+	assignedSample.UserAnnotations = []models.SampleAnnotation{*sampleAnnotation}
 	return assignedSample, nil
 }
+
+func (s *SamplesHandler) newLeaseExpiration() time.Time {
+	return time.Now().Add(s.LeaseTTL)
+}
+
+// renewLease extends the lease of an unfinished annotation, annotations returned by a reviewer have no lease
+func (s *SamplesHandler) renewLease(sampleAnnotation *models.SampleAnnotation) error {
+	if !sampleAnnotation.LeaseExpiresAt.Valid {
+		return nil
+	}
+
+	leaseExpiresAt := s.newLeaseExpiration()
+	result := s.DB.Model(&models.SampleAnnotation{}).
+		Where("id = ? AND status IS NULL", sampleAnnotation.ID).
+		Update("lease_expires_at", leaseExpiresAt)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrLeaseNotHeld
+	}
+
+	sampleAnnotation.LeaseExpiresAt = null.TimeFrom(leaseExpiresAt)
+	return nil
+}
+
+func (s *SamplesHandler) ExtendLease(datasetId uint, sampleId uint, userId uint) (*models.Sample, error) {
+	sample, sampleErr := s.GetSample(datasetId, sampleId)
+	if sampleErr != nil {
+		return nil, sampleErr
+	}
+
+	sampleAnnotation, annotationErr := s.findSampleAnnotation(sample.ID, userId)
+	if annotationErr != nil {
+		if errors.Is(annotationErr, gorm.ErrRecordNotFound) {
+			return nil, ErrLeaseNotHeld
+		}
+		return nil, annotationErr
+	}
+
+	if sampleAnnotation.Status.Valid || sample.Status.Valid {
+		return nil, ErrLeaseNotHeld
+	}
+
+	if leaseErr := s.renewLease(sampleAnnotation); leaseErr != nil {
+		return nil, leaseErr
+	}
+
+	sample.UserAnnotations = []models.SampleAnnotation{*sampleAnnotation}
+	return sample, nil
+}
+
+// ReleaseExpiredLeases removes the unfinished annotations with expired leases,
+// so that their samples can be assigned to other users. Returned annotations have no lease and are kept.
+func (s *SamplesHandler) ReleaseExpiredLeases() (int64, error) {
+	result := s.DB.Unscoped().
+		Where("status IS NULL AND lease_expires_at < ?", time.Now()).
+		Delete(&models.SampleAnnotation{})
+
+	return result.RowsAffected, result.Error
+}
+
+func (s *SamplesHandler) GetReviewQueue(datasetId uint) ([]*models.Sample, error) {
+	var samples []*models.Sample
+	dbErr := s.DB.
+		Preload("UserAnnotations", "status IS NOT NULL").
+		Where("dataset_id = ? AND review_status = ?", datasetId, models.InReview).
+		Find(&samples).Error
+	if dbErr != nil {
+		return nil, dbErr
+	}
+
+	return samples, nil
+}
+
+// GetSampleForReview returns the sample together with the completed annotations of all the users
+func (s *SamplesHandler) GetSampleForReview(datasetId uint, sampleId uint) (*models.Sample, error) {
+	sample := &models.Sample{}
+	dbErr := s.DB.
+		Preload("UserAnnotations", "status IS NOT NULL").
+		Where("dataset_id = ?", datasetId).
+		First(&sample, sampleId).Error
+	if dbErr != nil {
+		return nil, dbErr
+	}
+
+	return sample, nil
+}
+
+// reviewSample moves the sample from review to the given review status,
+// the conditional update makes sure that two reviewers cannot review the same sample
+func (s *SamplesHandler) reviewSample(tx *gorm.DB, sample *models.Sample, reviewStatus models.ReviewStatusType, reviewerId uint, action models.RevisionAction, updates map[string]interface{}) error {
+	if !models.ReviewStatusType(sample.ReviewStatus.String).CanTransitionTo(reviewStatus) {
+		return ErrInvalidReviewTransition
+	}
+
+	updates["review_status"] = reviewStatus
+	updates["reviewed_by"] = reviewerId
+	updates["reviewed_at"] = time.Now()
+
+	if versionErr := s.bumpVersion(tx, sample, null.Int{}); versionErr != nil {
+		return versionErr
+	}
+
+	return s.updateSample(tx, sample, &models.SampleRevision{UserID: reviewerId, Action: action}, func(tx *gorm.DB) error {
+		result := tx.Model(&models.Sample{}).
+			Where("id = ? AND review_status = ?", sample.ID, sample.ReviewStatus).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrInvalidReviewTransition
+		}
+
+		return nil
+	})
+}
+
+func (s *SamplesHandler) AcceptSample(datasetId uint, sampleId uint, reviewerId uint) (*models.Sample, error) {
+	sample, sampleErr := s.GetSample(datasetId, sampleId)
+	if sampleErr != nil {
+		return nil, sampleErr
+	}
+
+	txErr := s.DB.Transaction(func(tx *gorm.DB) error {
+		return s.reviewSample(tx, sample, models.Approved, reviewerId, models.ReviewAcceptAction, map[string]interface{}{"review_comment": nil})
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+
+	return s.GetSampleForReview(datasetId, sampleId)
+}
+
+// ReturnSample sends the sample back to its annotators with a comment of the reviewer
+func (s *SamplesHandler) ReturnSample(datasetId uint, sampleId uint, reviewerId uint, comment string) (*models.Sample, error) {
+	sample, sampleErr := s.GetSample(datasetId, sampleId)
+	if sampleErr != nil {
+		return nil, sampleErr
+	}
+
+	txErr := s.DB.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{"review_comment": comment, "status": nil}
+		if reviewErr := s.reviewSample(tx, sample, models.Returned, reviewerId, models.ReviewReturnAction, updates); reviewErr != nil {
+			return reviewErr
+		}
+
+		// the annotations are reopened without a lease, so that the sample is assigned to the same annotators
+		// again and the annotations are kept until they complete them
+		return tx.Model(&models.SampleAnnotation{}).
+			Where("sample_id = ?", sample.ID).
+			Updates(map[string]interface{}{"status": nil, "lease_expires_at": nil, "version": gorm.Expr("version + 1")}).Error
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+
+	return s.GetSampleForReview(datasetId, sampleId)
+}
+
+// MergeSample approves the sample with the gold annotations chosen by the reviewer
+func (s *SamplesHandler) MergeSample(datasetId uint, sampleId uint, reviewerId uint, data *MergeSampleData) (*models.Sample, error) {
+	sample, sampleErr := s.GetSample(datasetId, sampleId)
+	if sampleErr != nil {
+		return nil, sampleErr
+	}
+
+	if validationErr := s.validateSampleUpdate(sample, &UpdateSampleData{Annotations: data.Annotations}); validationErr != nil {
+		return nil, validationErr
+	}
+
+	updates := map[string]interface{}{"review_comment": nil, "annotations": data.Annotations}
+	if data.Status.Valid {
+		updates["status"] = data.Status
+	}
+
+	txErr := s.DB.Transaction(func(tx *gorm.DB) error {
+		return s.reviewSample(tx, sample, models.Approved, reviewerId, models.ReviewMergeAction, updates)
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+
+	return s.GetSampleForReview(datasetId, sampleId)
+}
+
+func (s *SamplesHandler) GetSampleHistory(datasetId uint, sampleId uint) ([]*models.SampleRevision, error) {
+	if _, sampleErr := s.GetSample(datasetId, sampleId); sampleErr != nil {
+		return nil, sampleErr
+	}
+
+	var revisions []*models.SampleRevision
+	if dbErr := s.DB.Where("sample_id = ?", sampleId).Order("id").Find(&revisions).Error; dbErr != nil {
+		return nil, dbErr
+	}
+
+	return revisions, nil
+}
+
+// RestoreRevision sets the sample to the annotations, metadata and status written by the revision, revisions of
+// a user annotation are restored onto that annotation. Metadata is only restored when the revision recorded it.
+// The restore is recorded as a new revision.
+func (s *SamplesHandler) RestoreRevision(datasetId uint, sampleId uint, revisionId uint, userId uint) (*models.Sample, error) {
+	sample, sampleErr := s.GetSample(datasetId, sampleId)
+	if sampleErr != nil {
+		return nil, sampleErr
+	}
+
+	revision := &models.SampleRevision{}
+	if dbErr := s.DB.Where("sample_id = ?", sample.ID).First(revision, revisionId).Error; dbErr != nil {
+		return nil, dbErr
+	}
+
+	if validationErr := s.validateSampleUpdate(sample, &UpdateSampleData{Annotations: revision.NewAnnotations}); validationErr != nil {
+		return nil, validationErr
+	}
+
+	txErr := s.DB.Transaction(func(tx *gorm.DB) error {
+		restore := &models.SampleRevision{UserID: userId, Action: models.RestoreAction, RestoredFrom: null.IntFrom(int64(revision.ID))}
+		if revision.SampleAnnotationID.Valid {
+			return s.restoreSampleAnnotation(tx, sample, revision, restore)
+		}
+
+		if versionErr := s.bumpVersion(tx, sample, null.Int{}); versionErr != nil {
+			return versionErr
+		}
+
+		updates := map[string]interface{}{"annotations": revision.NewAnnotations, "status": revision.NewStatus}
+		if len(revision.NewMetadata) > 0 {
+			updates["metadata"] = revision.NewMetadata
+		}
+
+		return s.updateSample(tx, sample, restore, func(tx *gorm.DB) error {
+			return tx.Model(&models.Sample{}).Where("id = ?", sample.ID).Updates(updates).Error
+		})
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+
+	return sample, nil
+}
+
+// restoreSampleAnnotation restores the annotations and status of the user annotation the revision was written to,
+// reopened annotations have no lease like the ones returned by a reviewer
+func (s *SamplesHandler) restoreSampleAnnotation(tx *gorm.DB, sample *models.Sample, revision *models.SampleRevision, restore *models.SampleRevision) error {
+	sampleAnnotation := &models.SampleAnnotation{}
+	if dbErr := tx.Where("sample_id = ?", sample.ID).First(sampleAnnotation, revision.SampleAnnotationID.Int64).Error; dbErr != nil {
+		if errors.Is(dbErr, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: the annotation of the revision no longer exists", ErrInvalidRestore)
+		}
+		return dbErr
+	}
+
+	if versionErr := s.bumpAnnotationVersion(tx, sampleAnnotation, null.Int{}); versionErr != nil {
+		return versionErr
+	}
+
+	restore.SampleID = sample.ID
+	restore.SampleAnnotationID = revision.SampleAnnotationID
+	restore.OldAnnotations = sampleAnnotation.Annotations
+	restore.NewAnnotations = revision.NewAnnotations
+	restore.OldMetadata = sample.Metadata
+	restore.NewMetadata = sample.Metadata
+	restore.OldStatus = sampleAnnotation.Status
+	restore.NewStatus = revision.NewStatus
+
+	updates := map[string]interface{}{"annotations": revision.NewAnnotations, "status": revision.NewStatus}
+	if !revision.NewStatus.Valid {
+		updates["lease_expires_at"] = nil
+		sampleAnnotation.LeaseExpiresAt = null.Time{}
+	}
+
+	if dbErr := tx.Model(sampleAnnotation).Updates(updates).Error; dbErr != nil {
+		return dbErr
+	}
+	sampleAnnotation.Annotations = revision.NewAnnotations
+	sampleAnnotation.Status = revision.NewStatus
+
+	if dbErr := tx.Create(restore).Error; dbErr != nil {
+		return dbErr
+	}
+
+	if sampleAnnotation.Status.Valid {
+		if completeErr := s.completeSample(tx, sample, restore.UserID); completeErr != nil {
+			return completeErr
+		}
+	}
+
+	sample.UserAnnotations = []models.SampleAnnotation{*sampleAnnotation}
+	return nil
+}
+
+func (s *SamplesHandler) DiffSample(datasetId uint, sampleId uint, from DiffSource, to DiffSource) (*dataset_diff.AnnotationDiff, error) {
+	sample, sampleErr := s.GetSample(datasetId, sampleId)
+	if sampleErr != nil {
+		return nil, sampleErr
+	}
+
+	fromAnnotations, fromErr := s.getDiffAnnotations(sample, from)
+	if fromErr != nil {
+		return nil, fromErr
+	}
+
+	toAnnotations, toErr := s.getDiffAnnotations(sample, to)
+	if toErr != nil {
+		return nil, toErr
+	}
+
+	return dataset_diff.DiffAnnotations(fromAnnotations, toAnnotations), nil
+}
+
+func (s *SamplesHandler) getDiffAnnotations(sample *models.Sample, source DiffSource) (*dataset.AnnotationData, error) {
+	annotations := sample.Annotations
+	if source.RevisionID.Valid {
+		revision := &models.SampleRevision{}
+		if dbErr := s.DB.Where("sample_id = ?", sample.ID).First(revision, source.RevisionID.Int64).Error; dbErr != nil {
+			return nil, dbErr
+		}
+		annotations = revision.NewAnnotations
+	} else if source.UserID.Valid {
+		sampleAnnotation, annotationErr := s.findSampleAnnotation(sample.ID, uint(source.UserID.Int64))
+		if annotationErr != nil {
+			return nil, annotationErr
+		}
+		annotations = sampleAnnotation.Annotations
+	}
+
+	return dataset.ParseAnnotations(annotations)
+}
+
+func (d *BulkSampleData) validate() error {
+	if d.SampleIDs == nil && d.Filter == nil {
+		return fmt.Errorf("%w: sample ids or a filter are required", ErrInvalidBulkOperation)
+	}
+
+	switch d.Operation {
+	case BulkResetStatus, BulkUnassign, BulkDelete:
+	case BulkReassign:
+		if !d.FromUserID.Valid || !d.ToUserID.Valid {
+			return fmt.Errorf("%w: reassigning requires the from and to users", ErrInvalidBulkOperation)
+		}
+	case BulkRenameTag:
+		if d.OldTag == "" || d.NewTag == "" {
+			return fmt.Errorf("%w: renaming requires the old and new tags", ErrInvalidBulkOperation)
+		}
+	default:
+		return fmt.Errorf("%w: unknown operation %q", ErrInvalidBulkOperation, d.Operation)
+	}
+
+	return nil
+}
+
+// BulkUpdateSamples runs the operation on the selected samples of the dataset in a single transaction
+func (s *SamplesHandler) BulkUpdateSamples(datasetId uint, userId uint, data *BulkSampleData) (*BulkSampleResult, error) {
+	if validationErr := data.validate(); validationErr != nil {
+		return nil, validationErr
+	}
+
+	result := &BulkSampleResult{}
+	txErr := s.DB.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&models.Sample{}).Where("dataset_id = ?", datasetId)
+		if data.SampleIDs != nil {
+			query = query.Where("id IN ?", data.SampleIDs)
+		}
+
+		if data.Filter != nil {
+			var filterErr error
+			if query, filterErr = s.filterSamples(query, data.Filter); filterErr != nil {
+				return filterErr
+			}
+		}
+
+		var sampleIds []uint
+		if dbErr := query.Order("id").Pluck("id", &sampleIds).Error; dbErr != nil {
+			return dbErr
+		}
+		result.MatchedSamples = int64(len(sampleIds))
+
+		for start := 0; start < len(sampleIds); start += bulkChunkSize {
+			end := start + bulkChunkSize
+			if end > len(sampleIds) {
+				end = len(sampleIds)
+			}
+
+			if operationErr := s.runBulkOperation(tx, sampleIds[start:end], userId, data, result); operationErr != nil {
+				return operationErr
+			}
+		}
+
+		return nil
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+
+	return result, nil
+}
+
+func (s *SamplesHandler) runBulkOperation(tx *gorm.DB, sampleIds []uint, userId uint, data *BulkSampleData, result *BulkSampleResult) error {
+	switch data.Operation {
+	case BulkResetStatus:
+		return s.bulkResetStatus(tx, sampleIds, userId, result)
+	case BulkReassign:
+		return s.bulkReassign(tx, sampleIds, userId, uint(data.FromUserID.Int64), uint(data.ToUserID.Int64), result)
+	case BulkUnassign:
+		query := tx.Where("sample_id IN ? AND status IS NULL", sampleIds)
+		if data.FromUserID.Valid {
+			query = query.Where("user_id = ?", data.FromUserID.Int64)
+		}
+
+		return s.bulkRemoveAnnotations(tx, query, userId, result)
+	case BulkDelete:
+		// pending annotations are released first, the samples record the deletion
+		if removeErr := s.bulkRemoveAnnotations(tx, tx.Where("sample_id IN ? AND status IS NULL", sampleIds), userId, result); removeErr != nil {
+			return removeErr
+		}
+
+		var samples []*models.Sample
+		if dbErr := tx.Where("id IN ?", sampleIds).Find(&samples).Error; dbErr != nil {
+			return dbErr
+		}
+
+		// deleted samples release their external ids so that they can be imported again
+		for _, sample := range samples {
+			if updateErr := s.bulkUpdateSample(tx, sample, userId, map[string]interface{}{"external_id": nil}); updateErr != nil {
+				return updateErr
+			}
+		}
+
+		deleted := tx.Where("id IN ?", sampleIds).Delete(&models.Sample{})
+		result.AffectedSamples += deleted.RowsAffected
+		return deleted.Error
+	case BulkRenameTag:
+		return s.rewriteAnnotations(tx, sampleIds, userId, func(annotations *dataset.AnnotationData) bool {
+			return annotations.RenameTag(data.OldTag, data.NewTag)
+		}, result)
+	}
+
+	return nil
+}
+
+// bulkUpdateSample writes the updates to the sample and records them as a bulk update revision
+func (s *SamplesHandler) bulkUpdateSample(tx *gorm.DB, sample *models.Sample, userId uint, updates map[string]interface{}) error {
+	if versionErr := s.bumpVersion(tx, sample, null.Int{}); versionErr != nil {
+		return versionErr
+	}
+
+	return s.updateSample(tx, sample, &models.SampleRevision{UserID: userId, Action: models.BulkUpdateAction}, func(tx *gorm.DB) error {
+		return tx.Model(&models.Sample{}).Where("id = ?", sample.ID).Updates(updates).Error
+	})
+}
+
+// bulkResetStatus clears the status and the review of the samples and reopens their completed annotations
+func (s *SamplesHandler) bulkResetStatus(tx *gorm.DB, sampleIds []uint, userId uint, result *BulkSampleResult) error {
+	var samples []*models.Sample
+	if dbErr := tx.Where("id IN ? AND (status IS NOT NULL OR review_status IS NOT NULL)", sampleIds).Find(&samples).Error; dbErr != nil {
+		return dbErr
+	}
+
+	updates := map[string]interface{}{"status": nil, "review_status": nil, "review_comment": nil, "reviewed_by": nil, "reviewed_at": nil}
+	for _, sample := range samples {
+		if updateErr := s.bulkUpdateSample(tx, sample, userId, updates); updateErr != nil {
+			return updateErr
+		}
+	}
+	result.AffectedSamples += int64(len(samples))
+
+	// the annotations are reopened without a lease like the ones returned by a reviewer
+	var sampleAnnotations []*models.SampleAnnotation
+	if dbErr := tx.Where("sample_id IN ? AND status IS NOT NULL", sampleIds).Find(&sampleAnnotations).Error; dbErr != nil {
+		return dbErr
+	}
+
+	for _, sampleAnnotation := range sampleAnnotations {
+		updateErr := s.bulkUpdateSampleAnnotation(tx, sampleAnnotation, userId, map[string]interface{}{"status": nil, "lease_expires_at": nil})
+		if updateErr != nil {
+			return updateErr
+		}
+	}
+	result.AffectedAnnotations += int64(len(sampleAnnotations))
+	return nil
+}
+
+// bulkReassign moves the unfinished annotations of a user to another one,
+// samples that the other user already annotates are skipped
+func (s *SamplesHandler) bulkReassign(tx *gorm.DB, sampleIds []uint, userId uint, fromUserId uint, toUserId uint, result *BulkSampleResult) error {
+	var takenIds []uint
+	if dbErr := tx.Unscoped().Model(&models.SampleAnnotation{}).Where("sample_id IN ? AND user_id = ?", sampleIds, toUserId).Pluck("sample_id", &takenIds).Error; dbErr != nil {
+		return dbErr
+	}
+
+	taken := map[uint]bool{}
+	for _, sampleId := range takenIds {
+		taken[sampleId] = true
+	}
+
+	var reassignable []uint
+	for _, sampleId := range sampleIds {
+		if !taken[sampleId] {
+			reassignable = append(reassignable, sampleId)
+		}
+	}
+
+	if len(reassignable) == 0 {
+		return nil
+	}
+
+	var sampleAnnotations []*models.SampleAnnotation
+	if dbErr := tx.Where("sample_id IN ? AND user_id = ? AND status IS NULL", reassignable, fromUserId).Find(&sampleAnnotations).Error; dbErr != nil {
+		return dbErr
+	}
+
+	for _, sampleAnnotation := range sampleAnnotations {
+		updateErr := s.bulkUpdateSampleAnnotation(tx, sampleAnnotation, userId, map[string]interface{}{"user_id": toUserId, "lease_expires_at": s.newLeaseExpiration()})
+		if updateErr != nil {
+			return updateErr
+		}
+	}
+	result.AffectedAnnotations += int64(len(sampleAnnotations))
+	return nil
+}
+
+// bulkUpdateSampleAnnotation writes the updates to the annotation of a user and records them as a bulk update revision
+func (s *SamplesHandler) bulkUpdateSampleAnnotation(tx *gorm.DB, sampleAnnotation *models.SampleAnnotation, userId uint, updates map[string]interface{}) error {
+	if versionErr := s.bumpAnnotationVersion(tx, sampleAnnotation, null.Int{}); versionErr != nil {
+		return versionErr
+	}
+
+	revision := &models.SampleRevision{
+		SampleID:           sampleAnnotation.SampleID,
+		SampleAnnotationID: null.IntFrom(int64(sampleAnnotation.ID)),
+		UserID:             userId,
+		Action:             models.BulkUpdateAction,
+		OldAnnotations:     sampleAnnotation.Annotations,
+		OldStatus:          sampleAnnotation.Status,
+	}
+
+	if dbErr := tx.Model(&models.SampleAnnotation{}).Where("id = ?", sampleAnnotation.ID).Updates(updates).Error; dbErr != nil {
+		return dbErr
+	}
+
+	if dbErr := tx.First(sampleAnnotation, sampleAnnotation.ID).Error; dbErr != nil {
+		return dbErr
+	}
+
+	revision.NewAnnotations = sampleAnnotation.Annotations
+	revision.NewStatus = sampleAnnotation.Status
+	return tx.Create(revision).Error
+}
+
+// bulkRemoveAnnotations deletes the selected annotations of the users, the removal is recorded
+// as a bulk update revision of each annotation and bumps the version of its sample
+func (s *SamplesHandler) bulkRemoveAnnotations(tx *gorm.DB, query *gorm.DB, userId uint, result *BulkSampleResult) error {
+	var sampleAnnotations []*models.SampleAnnotation
+	if dbErr := query.Order("id").Find(&sampleAnnotations).Error; dbErr != nil {
+		return dbErr
+	}
+
+	if len(sampleAnnotations) == 0 {
+		return nil
+	}
+
+	bumped := map[uint]bool{}
+	for _, sampleAnnotation := range sampleAnnotations {
+		if !bumped[sampleAnnotation.SampleID] {
+			sample := &models.Sample{}
+			sample.ID = sampleAnnotation.SampleID
+			if versionErr := s.bumpVersion(tx, sample, null.Int{}); versionErr != nil {
+				return versionErr
+			}
+			bumped[sampleAnnotation.SampleID] = true
+		}
+
+		revision := &models.SampleRevision{
+			SampleID:           sampleAnnotation.SampleID,
+			SampleAnnotationID: null.IntFrom(int64(sampleAnnotation.ID)),
+			UserID:             userId,
+			Action:             models.BulkUpdateAction,
+			OldAnnotations:     sampleAnnotation.Annotations,
+			OldStatus:          sampleAnnotation.Status,
+		}
+		if dbErr := tx.Create(revision).Error; dbErr != nil {
+			return dbErr
+		}
+	}
+
+	deleted := tx.Unscoped().Delete(&sampleAnnotations)
+	result.AffectedAnnotations += deleted.RowsAffected
+	return deleted.Error
+}
+
+// rewriteAnnotations applies the rewrite to the annotations of the samples and of their users,
+// the rewrite reports whether it changed the annotations
+func (s *SamplesHandler) rewriteAnnotations(tx *gorm.DB, sampleIds []uint, userId uint, rewrite func(*dataset.AnnotationData) bool, result *BulkSampleResult) error {
+	var samples []*models.Sample
+	if dbErr := tx.Where("id IN ? AND annotations IS NOT NULL", sampleIds).Find(&samples).Error; dbErr != nil {
+		return dbErr
+	}
+
+	for _, sample := range samples {
+		rewritten, rewriteErr := rewriteAnnotationsData(sample.Annotations, rewrite)
+		if rewriteErr != nil {
+			return rewriteErr
+		} else if rewritten == nil {
+			continue
+		}
+
+		if updateErr := s.bulkUpdateSample(tx, sample, userId, map[string]interface{}{"annotations": rewritten}); updateErr != nil {
+			return updateErr
+		}
+		result.AffectedSamples++
+	}
+
+	var sampleAnnotations []*models.SampleAnnotation
+	if dbErr := tx.Where("sample_id IN ? AND annotations IS NOT NULL", sampleIds).Find(&sampleAnnotations).Error; dbErr != nil {
+		return dbErr
+	}
+
+	for _, sampleAnnotation := range sampleAnnotations {
+		rewritten, rewriteErr := rewriteAnnotationsData(sampleAnnotation.Annotations, rewrite)
+		if rewriteErr != nil {
+			return rewriteErr
+		} else if rewritten == nil {
+			continue
+		}
+
+		revision := &models.SampleRevision{
+			SampleID:           sampleAnnotation.SampleID,
+			SampleAnnotationID: null.IntFrom(int64(sampleAnnotation.ID)),
+			UserID:             userId,
+			Action:             models.BulkUpdateAction,
+			OldAnnotations:     sampleAnnotation.Annotations,
+			NewAnnotations:     rewritten,
+			OldStatus:          sampleAnnotation.Status,
+			NewStatus:          sampleAnnotation.Status,
+		}
+
+		if dbErr := tx.Model(sampleAnnotation).Updates(map[string]interface{}{"annotations": rewritten, "version": gorm.Expr("version + 1")}).Error; dbErr != nil {
+			return dbErr
+		}
+
+		if dbErr := tx.Create(revision).Error; dbErr != nil {
+			return dbErr
+		}
+		result.AffectedAnnotations++
+	}
+
+	return nil
+}
+
+// rewriteAnnotationsData returns the rewritten annotations, or nil when the rewrite did not change them
+func rewriteAnnotationsData(data datatypes.JSON, rewrite func(*dataset.AnnotationData) bool) (datatypes.JSON, error) {
+	annotations, parsingErr := dataset.ParseAnnotations(data)
+	if parsingErr != nil {
+		return nil, parsingErr
+	}
+
+	if !rewrite(annotations) {
+		return nil, nil
+	}
+
+	return json.Marshal(annotations)
+}
+
+// UpdatePriorities sets the priorities pushed by an external process in a single transaction,
+// updates of samples that are not in the dataset are counted as missing
+func (s *SamplesHandler) UpdatePriorities(datasetId uint, updates []*PriorityUpdate) (*PriorityUpdateResult, error) {
+	for i, update := range updates {
+		if update.SampleID.Valid == update.ExternalID.Valid {
+			return nil, fmt.Errorf("%w: update %d needs either a sample id or an external id", ErrInvalidPriorityUpdate, i)
+		}
+	}
+
+	result := &PriorityUpdateResult{}
+	txErr := s.DB.Transaction(func(tx *gorm.DB) error {
+		for _, update := range updates {
+			query := tx.Model(&models.Sample{}).Where("dataset_id = ?", datasetId)
+			if update.SampleID.Valid {
+				query = query.Where("id = ?", update.SampleID.Int64)
+			} else {
+				query = query.Where("external_id = ?", update.ExternalID.String)
+			}
+
+			// priorities are not part of the annotations, so neither the version nor updated_at change
+			updateResult := query.UpdateColumn("priority", update.Priority)
+			if updateResult.Error != nil {
+				return updateResult.Error
+			}
+
+			if updateResult.RowsAffected == 0 {
+				result.MissingSamples++
+			} else {
+				result.UpdatedSamples++
+			}
+		}
+
+		return nil
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+
+	return result, nil
+}
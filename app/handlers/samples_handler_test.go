@@ -2,10 +2,16 @@ package handlers
 
 import (
 	"backend/app/models"
+	dataset_utils "backend/app/utils/dataset"
+	"errors"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/matryer/is"
 	"gopkg.in/guregu/null.v4"
+	"gorm.io/datatypes"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -28,6 +34,14 @@ func setupDBForSamplesHandlerTests(t *testing.T) (*gorm.DB, func() error) {
 		t.Fatalf("failed to migrate dataset: %v", migrationErr)
 	}
 
+	if migrationErr := db.AutoMigrate(&models.SampleAnnotation{}); migrationErr != nil {
+		t.Fatalf("failed to migrate sample annotation: %v", migrationErr)
+	}
+
+	if migrationErr := db.AutoMigrate(&models.SampleRevision{}); migrationErr != nil {
+		t.Fatalf("failed to migrate sample revision: %v", migrationErr)
+	}
+
 	sqlDB, sqlErr := db.DB()
 	if sqlErr != nil {
 		t.Fatalf("failed to obtain SQL DB: %v", sqlErr)
@@ -35,6 +49,10 @@ func setupDBForSamplesHandlerTests(t *testing.T) (*gorm.DB, func() error) {
 	return db, sqlDB.Close
 }
 
+func testAnnotator(userId uint) *models.User {
+	return &models.User{Model: gorm.Model{ID: userId}, Role: models.AnnotatorRole}
+}
+
 func TestGetSamples(t *testing.T) {
 	db, cleanup := setupDBForSamplesHandlerTests(t)
 	defer cleanup()
@@ -59,6 +77,10 @@ func TestGetSamples(t *testing.T) {
 	}
 
 	is.NoErr(db.Create(&datasets).Error)
+	is.NoErr(db.Create(&[]models.SampleAnnotation{
+		{SampleID: datasets[1].Samples[0].ID, UserID: 1, Slot: 0, Status: models.Accepted.ToNullString()},
+		{SampleID: datasets[1].Samples[0].ID, UserID: 2, Slot: 1},
+	}).Error)
 
 	samples, samplesErr := handler.GetSamples(datasets[1].ID)
 	is.NoErr(samplesErr)
@@ -66,6 +88,10 @@ func TestGetSamples(t *testing.T) {
 
 	is.Equal(samples[0].ID, datasets[1].Samples[0].ID)
 	is.Equal(samples[1].ID, datasets[1].Samples[1].ID)
+
+	// only the completed annotations are exported
+	is.Equal(len(samples[0].UserAnnotations), 1)
+	is.Equal(samples[0].UserAnnotations[0].UserID, uint(1))
 }
 
 func TestGetSamplesWithStatus(t *testing.T) {
@@ -104,6 +130,125 @@ func TestGetSamplesWithStatus(t *testing.T) {
 	is.Equal(len(samples), 0)
 }
 
+func TestListSamplesPagination(t *testing.T) {
+	db, cleanup := setupDBForSamplesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	dataset := models.Dataset{Name: "dataset", Type: models.EntityAnnotation, Samples: []models.Sample{
+		{Text: "Sample text", Status: models.Rejected.ToNullString()},
+		{Text: "Sample text"},
+		{Text: "Sample text", Status: models.Accepted.ToNullString()},
+		{Text: "Sample text", Status: models.Rejected.ToNullString()},
+		{Text: "Sample text"},
+	}}
+	is.NoErr(db.Create(&dataset).Error)
+
+	var ids []uint
+	query := &SampleQuery{Limit: 2}
+	for pages := 0; ; pages++ {
+		page, pageErr := handler.ListSamples(dataset.ID, query)
+		is.NoErr(pageErr)
+		is.True(len(page.Samples) <= 2)
+
+		for _, sample := range page.Samples {
+			ids = append(ids, sample.ID)
+		}
+
+		if !page.NextCursor.Valid {
+			is.Equal(pages, 2)
+			break
+		}
+		query.Cursor = page.NextCursor.String
+	}
+
+	is.Equal(len(ids), 5)
+	for i, sample := range dataset.Samples {
+		is.Equal(ids[i], sample.ID)
+	}
+
+	// status sorted descending, samples with the same status are ordered by id
+	var statusIds []uint
+	query = &SampleQuery{Limit: 2, SortBy: "status", Descending: true}
+	for {
+		page, pageErr := handler.ListSamples(dataset.ID, query)
+		is.NoErr(pageErr)
+
+		for _, sample := range page.Samples {
+			statusIds = append(statusIds, sample.ID)
+		}
+
+		if !page.NextCursor.Valid {
+			break
+		}
+		query.Cursor = page.NextCursor.String
+	}
+
+	is.Equal(statusIds, []uint{
+		dataset.Samples[3].ID, dataset.Samples[0].ID, dataset.Samples[2].ID, dataset.Samples[4].ID, dataset.Samples[1].ID,
+	})
+
+	_, pageErr := handler.ListSamples(dataset.ID, &SampleQuery{SortBy: "text"})
+	is.True(errors.Is(pageErr, ErrInvalidSampleQuery))
+
+	_, pageErr = handler.ListSamples(dataset.ID, &SampleQuery{Cursor: "invalid"})
+	is.True(errors.Is(pageErr, ErrInvalidSampleQuery))
+}
+
+func TestListSamplesWithFilters(t *testing.T) {
+	db, cleanup := setupDBForSamplesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	dataset := models.Dataset{Name: "dataset", Type: models.EntityAnnotation, Samples: []models.Sample{
+		{
+			Text:        "John works at 100% capacity",
+			Status:      models.Accepted.ToNullString(),
+			Annotations: datatypes.JSON(`{"entities":[{"id":1,"start":0,"end":4,"tag":"PER"}]}`),
+			Metadata:    datatypes.JSON(`{"source":"news"}`),
+		},
+		{
+			Text:        "Acme hired Jane",
+			Annotations: datatypes.JSON(`{"entities":[{"id":1,"start":0,"end":4,"tag":"ORG"}]}`),
+			Metadata:    datatypes.JSON(`{"source":"blog"}`),
+		},
+		{Text: "Nothing to annotate", Metadata: datatypes.JSON(`{"source":"news"}`)},
+	}}
+	is.NoErr(db.Create(&dataset).Error)
+
+	_, assignErr := handler.AssignNextSample(dataset.ID, 7)
+	is.NoErr(assignErr)
+
+	sampleIds := func(filter SampleFilter) []uint {
+		page, pageErr := handler.ListSamples(dataset.ID, &SampleQuery{SampleFilter: filter})
+		is.NoErr(pageErr)
+
+		ids := []uint{}
+		for _, sample := range page.Samples {
+			ids = append(ids, sample.ID)
+		}
+		return ids
+	}
+
+	is.Equal(sampleIds(SampleFilter{Status: "accepted"}), []uint{dataset.Samples[0].ID})
+	is.Equal(sampleIds(SampleFilter{Status: AssignedSampleFilter}), []uint{dataset.Samples[1].ID})
+	is.Equal(sampleIds(SampleFilter{Status: PendingSampleFilter}), []uint{dataset.Samples[2].ID})
+	is.Equal(sampleIds(SampleFilter{AssignedTo: null.IntFrom(7)}), []uint{dataset.Samples[1].ID})
+	is.Equal(sampleIds(SampleFilter{AssignedTo: null.IntFrom(8)}), []uint{})
+	is.Equal(sampleIds(SampleFilter{EntityTag: "ORG"}), []uint{dataset.Samples[1].ID})
+	is.Equal(sampleIds(SampleFilter{Text: "hired"}), []uint{dataset.Samples[1].ID})
+	is.Equal(sampleIds(SampleFilter{Text: "100%"}), []uint{dataset.Samples[0].ID})
+	is.Equal(sampleIds(SampleFilter{MetadataKey: "source", MetadataValue: "news"}), []uint{dataset.Samples[0].ID, dataset.Samples[2].ID})
+	is.Equal(sampleIds(SampleFilter{MetadataKey: "source", MetadataValue: "news", EntityTag: "PER"}), []uint{dataset.Samples[0].ID})
+
+	_, pageErr := handler.ListSamples(dataset.ID, &SampleQuery{SampleFilter: SampleFilter{Status: "unknown"}})
+	is.True(errors.Is(pageErr, ErrInvalidSampleQuery))
+}
+
 func TestGetSample(t *testing.T) {
 	db, cleanup := setupDBForSamplesHandlerTests(t)
 	defer cleanup()
@@ -181,7 +326,7 @@ func TestPatchSample(t *testing.T) {
 		Status: models.Rejected.ToNullString(),
 	}
 
-	_, updateErr := handler.PatchSample(datasets[0].ID, datasets[0].Samples[0].ID, data)
+	_, updateErr := handler.PatchSample(datasets[0].ID, datasets[0].Samples[0].ID, testAnnotator(1), data)
 	is.NoErr(updateErr)
 
 	refreshedSample, sampleErr := handler.GetSample(datasets[0].ID, datasets[0].Samples[0].ID)
@@ -218,7 +363,7 @@ func TestPatchNonExistentSample(t *testing.T) {
 		Status: models.Rejected.ToNullString(),
 	}
 
-	_, updateErr := handler.PatchSample(dataset.ID, 0, data)
+	_, updateErr := handler.PatchSample(dataset.ID, 0, testAnnotator(1), data)
 	is.Equal(updateErr, gorm.ErrRecordNotFound)
 }
 
@@ -229,10 +374,10 @@ func TestFindingAssignedSample(t *testing.T) {
 	is := is.New(t)
 	handler := NewSamplesHandler(db)
 
-	var userID uint = 0
+	var userID uint = 1
 	dataset1Samples := []models.Sample{
 		{Text: "Sample text"},
-		{Text: "Sample text", AssignedTo: null.IntFrom(int64(userID))},
+		{Text: "Sample text", UserAnnotations: []models.SampleAnnotation{{UserID: userID}}},
 	}
 
 	dataset := &models.Dataset{
@@ -257,8 +402,8 @@ func TestAssigningNewSample(t *testing.T) {
 
 	dataset1Samples := []models.Sample{
 		{Text: "Sample text", Status: models.Accepted.ToNullString()},
-		{Text: "Sample text", AssignedTo: null.IntFrom(5)},
-		{Text: "Sample text", Status: models.Accepted.ToNullString(), AssignedTo: null.IntFrom(4)},
+		{Text: "Sample text", UserAnnotations: []models.SampleAnnotation{{UserID: 5}}},
+		{Text: "Sample text", Status: models.Accepted.ToNullString(), UserAnnotations: []models.SampleAnnotation{{UserID: 4, Status: models.Accepted.ToNullString()}}},
 		{Text: "Sample text"},
 		{Text: "Sample text"},
 	}
@@ -274,3 +419,1092 @@ func TestAssigningNewSample(t *testing.T) {
 	is.NoErr(sampleErr)
 	is.Equal(assignedSample.ID, dataset1Samples[3].ID)
 }
+
+func TestPatchSampleWithInvalidAnnotations(t *testing.T) {
+	db, cleanup := setupDBForSamplesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	dataset := &models.Dataset{
+		Name:     "dataset1",
+		Type:     models.RelationAnnotation,
+		Metadata: datatypes.JSON(`{"entityTags": [{"name": "PER"}], "relationshipTags": [{"name": "knows"}]}`),
+		Samples:  []models.Sample{{Text: "John knows Jane"}},
+	}
+
+	is.NoErr(db.Create(&dataset).Error)
+
+	data := &UpdateSampleData{
+		Annotations: datatypes.JSON(`{
+			"entities": [
+				{"id": 1, "start": 0, "end": 4, "tag": "PER"},
+				{"id": 1, "start": 11, "end": 20, "tag": "PER"},
+				{"id": 2, "start": 5, "end": 5, "tag": "ORG"}
+			],
+			"relationships": [{"id": 1, "entity1": 1, "entity2": 3, "name": "hates"}]
+		}`),
+	}
+
+	_, updateErr := handler.PatchSample(dataset.ID, dataset.Samples[0].ID, testAnnotator(1), data)
+	var validationErrs dataset_utils.ValidationErrors
+	is.True(errors.As(updateErr, &validationErrs))
+
+	fields := make([]string, len(validationErrs))
+	for i, validationErr := range validationErrs {
+		fields[i] = validationErr.Field
+	}
+
+	is.Equal(fields, []string{
+		"annotations.entities[1].end",
+		"annotations.entities[2].start",
+		"annotations.entities[1].id",
+		"annotations.relationships[0].entity2",
+		"annotations.entities[2].tag",
+		"annotations.relationships[0].name",
+	})
+
+	refreshedSample, sampleErr := handler.GetSample(dataset.ID, dataset.Samples[0].ID)
+	is.NoErr(sampleErr)
+	is.Equal(len(refreshedSample.Annotations), 0)
+}
+
+func TestPatchSampleWithoutDeclaredTags(t *testing.T) {
+	db, cleanup := setupDBForSamplesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	dataset := &models.Dataset{
+		Name:     "dataset1",
+		Type:     models.RelationAnnotation,
+		Metadata: datatypes.JSON(`{"entityTags": [], "relationshipTags": []}`),
+		Samples:  []models.Sample{{Text: "John knows Jane"}},
+	}
+
+	is.NoErr(db.Create(&dataset).Error)
+
+	// a dataset without tags accepts no tagged annotations
+	_, updateErr := handler.PatchSample(dataset.ID, dataset.Samples[0].ID, testAnnotator(1), &UpdateSampleData{
+		Annotations: datatypes.JSON(`{
+			"entities": [{"id": 1, "start": 0, "end": 4, "tag": "PER"}, {"id": 2, "start": 11, "end": 15}],
+			"relationships": [{"id": 1, "entity1": 1, "entity2": 2, "name": "knows"}]
+		}`),
+	})
+	var validationErrs dataset_utils.ValidationErrors
+	is.True(errors.As(updateErr, &validationErrs))
+	is.Equal(len(validationErrs), 2)
+	is.Equal(validationErrs[0].Field, "annotations.entities[0].tag")
+	is.Equal(validationErrs[1].Field, "annotations.relationships[0].name")
+
+	// untagged entities are still allowed
+	_, updateErr = handler.PatchSample(dataset.ID, dataset.Samples[0].ID, testAnnotator(1), &UpdateSampleData{
+		Annotations: datatypes.JSON(`{"entities": [{"id": 1, "start": 0, "end": 4}], "relationships": []}`),
+	})
+	is.NoErr(updateErr)
+}
+
+func TestPatchSampleWithValidAnnotations(t *testing.T) {
+	db, cleanup := setupDBForSamplesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	dataset := &models.Dataset{
+		Name:     "dataset1",
+		Type:     models.EntityAnnotation,
+		Metadata: datatypes.JSON(`{"entityTags": [{"name": "PER"}], "relationshipTags": []}`),
+		Samples:  []models.Sample{{Text: "John knows Jane"}},
+	}
+
+	is.NoErr(db.Create(&dataset).Error)
+
+	data := &UpdateSampleData{
+		Annotations: datatypes.JSON(`{"entities": [{"id": 1, "start": 0, "end": 4, "tag": "PER", "elementId": "entity-1"}], "relationships": []}`),
+	}
+
+	sample, updateErr := handler.PatchSample(dataset.ID, dataset.Samples[0].ID, testAnnotator(1), data)
+	is.NoErr(updateErr)
+	is.Equal(sample.Annotations, data.Annotations)
+}
+
+func TestPatchSampleWithRelationshipConstraints(t *testing.T) {
+	db, cleanup := setupDBForSamplesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	dataset := &models.Dataset{
+		Name: "dataset1",
+		Type: models.RelationAnnotation,
+		Metadata: datatypes.JSON(`{"entityTags": [{"name": "PER"}, {"name": "ORG"}], "relationshipTags": [
+			{"name": "works_for", "sources": ["PER"], "targets": ["ORG"], "directed": true},
+			{"name": "partner_of", "sources": ["PER"], "targets": ["ORG"]}
+		]}`),
+		Samples: []models.Sample{{Text: "John works for Acme"}},
+	}
+
+	is.NoErr(db.Create(&dataset).Error)
+
+	entities := `[{"id": 1, "start": 0, "end": 4, "tag": "PER"}, {"id": 2, "start": 15, "end": 19, "tag": "ORG"}]`
+	data := &UpdateSampleData{
+		Annotations: datatypes.JSON(`{"entities": ` + entities + `, "relationships": [
+			{"id": 1, "entity1": 2, "entity2": 1, "name": "works_for"},
+			{"id": 2, "entity1": 2, "entity2": 1, "name": "partner_of"}
+		]}`),
+	}
+
+	_, updateErr := handler.PatchSample(dataset.ID, dataset.Samples[0].ID, testAnnotator(1), data)
+	var validationErrs dataset_utils.ValidationErrors
+	is.True(errors.As(updateErr, &validationErrs))
+	is.Equal(len(validationErrs), 1)
+	is.Equal(validationErrs[0].Field, "annotations.relationships[0]")
+
+	data.Annotations = datatypes.JSON(`{"entities": ` + entities + `, "relationships": [
+		{"id": 1, "entity1": 1, "entity2": 2, "name": "works_for"},
+		{"id": 2, "entity1": 2, "entity2": 1, "name": "partner_of"}
+	]}`)
+	_, updateErr = handler.PatchSample(dataset.ID, dataset.Samples[0].ID, testAnnotator(1), data)
+	is.NoErr(updateErr)
+}
+
+func TestConcurrentSampleAssignment(t *testing.T) {
+	// a file database is used so that the goroutines get their own connections
+	dbPath := filepath.Join(t.TempDir(), "assignment.db")
+	db, err := gorm.Open(sqlite.Open(dbPath+"?_busy_timeout=10000&_journal_mode=WAL"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to open sqlite connection: %v", err)
+	}
+
+	if migrationErr := db.AutoMigrate(&models.Dataset{}, &models.Sample{}, &models.SampleAnnotation{}, &models.SampleRevision{}); migrationErr != nil {
+		t.Fatalf("failed to migrate: %v", migrationErr)
+	}
+
+	sqlDB, sqlErr := db.DB()
+	if sqlErr != nil {
+		t.Fatalf("failed to obtain SQL DB: %v", sqlErr)
+	}
+	defer sqlDB.Close()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	samplesCount := 200
+	usersCount := 20
+	samples := make([]models.Sample, samplesCount)
+	for i := range samples {
+		samples[i] = models.Sample{Text: "Sample text"}
+	}
+
+	dataset := &models.Dataset{Name: "dataset1", Type: models.EntityAnnotation, Samples: samples}
+	is.NoErr(db.Create(&dataset).Error)
+
+	// every user keeps requesting and completing samples until there are none left
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	assignments := make([][]uint, usersCount)
+	assignErrs := make([]error, usersCount)
+	for i := 0; i < usersCount; i++ {
+		wg.Add(1)
+		go func(userIndex int) {
+			defer wg.Done()
+			<-start
+			userId := uint(userIndex + 1)
+			for {
+				sample, assignErr := handler.AssignNextSample(dataset.ID, userId)
+				if assignErr != nil {
+					if !errors.Is(assignErr, gorm.ErrRecordNotFound) {
+						assignErrs[userIndex] = assignErr
+					}
+					return
+				}
+
+				assignments[userIndex] = append(assignments[userIndex], sample.ID)
+				if _, patchErr := handler.PatchSample(dataset.ID, sample.ID, testAnnotator(userId), &UpdateSampleData{Status: models.Accepted.ToNullString()}); patchErr != nil {
+					assignErrs[userIndex] = patchErr
+					return
+				}
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	assignedTo := map[uint]uint{}
+	for i := 0; i < usersCount; i++ {
+		is.NoErr(assignErrs[i])
+		for _, sampleId := range assignments[i] {
+			if previousUser, ok := assignedTo[sampleId]; ok {
+				t.Fatalf("sample %d was assigned to users %d and %d", sampleId, previousUser, i+1)
+			}
+			assignedTo[sampleId] = uint(i + 1)
+		}
+	}
+
+	is.Equal(len(assignedTo), samplesCount)
+
+	// the database has to agree with the returned assignments
+	for sampleId, userId := range assignedTo {
+		sample, sampleErr := handler.GetSample(dataset.ID, sampleId)
+		is.NoErr(sampleErr)
+		is.Equal(sample.Status, models.Accepted.ToNullString())
+
+		var annotationsCount int64
+		is.NoErr(db.Model(&models.SampleAnnotation{}).Where("sample_id = ?", sampleId).Count(&annotationsCount).Error)
+		is.Equal(annotationsCount, int64(1))
+
+		sampleAnnotation, annotationErr := handler.findSampleAnnotation(sampleId, userId)
+		is.NoErr(annotationErr)
+		is.Equal(sampleAnnotation.Status, models.Accepted.ToNullString())
+	}
+}
+
+func TestAssigningSampleSetsLease(t *testing.T) {
+	db, cleanup := setupDBForSamplesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	dataset := &models.Dataset{
+		Name:    "dataset1",
+		Type:    models.EntityAnnotation,
+		Samples: []models.Sample{{Text: "Sample text"}},
+	}
+
+	is.NoErr(db.Create(&dataset).Error)
+	assignedSample, sampleErr := handler.AssignNextSample(dataset.ID, 1)
+	is.NoErr(sampleErr)
+	is.Equal(len(assignedSample.UserAnnotations), 1)
+	is.True(assignedSample.UserAnnotations[0].LeaseExpiresAt.Time.After(time.Now().Add(DefaultLeaseTTL - time.Minute)))
+
+	storedAnnotation, annotationErr := handler.findSampleAnnotation(assignedSample.ID, 1)
+	is.NoErr(annotationErr)
+	is.True(storedAnnotation.LeaseExpiresAt.Valid)
+}
+
+func TestExtendLease(t *testing.T) {
+	db, cleanup := setupDBForSamplesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	soon := time.Now().Add(time.Minute)
+	dataset1Samples := []models.Sample{
+		{Text: "Sample text", UserAnnotations: []models.SampleAnnotation{{UserID: 1, LeaseExpiresAt: null.TimeFrom(soon)}}},
+		{Text: "Sample text", UserAnnotations: []models.SampleAnnotation{{UserID: 2, LeaseExpiresAt: null.TimeFrom(soon)}}},
+	}
+
+	dataset := &models.Dataset{
+		Name:    "dataset1",
+		Type:    models.EntityAnnotation,
+		Samples: dataset1Samples,
+	}
+
+	is.NoErr(db.Create(&dataset).Error)
+	extendedSample, extendErr := handler.ExtendLease(dataset.ID, dataset1Samples[0].ID, 1)
+	is.NoErr(extendErr)
+	is.True(extendedSample.UserAnnotations[0].LeaseExpiresAt.Time.After(soon))
+
+	_, extendErr = handler.ExtendLease(dataset.ID, dataset1Samples[1].ID, 1)
+	is.True(errors.Is(extendErr, ErrLeaseNotHeld))
+}
+
+func TestReleaseExpiredLeases(t *testing.T) {
+	db, cleanup := setupDBForSamplesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	expired := null.TimeFrom(time.Now().Add(-time.Minute))
+	dataset1Samples := []models.Sample{
+		{Text: "Sample text", UserAnnotations: []models.SampleAnnotation{{UserID: 1, LeaseExpiresAt: expired}}},
+		{Text: "Sample text", UserAnnotations: []models.SampleAnnotation{{UserID: 2, LeaseExpiresAt: null.TimeFrom(time.Now().Add(time.Hour))}}},
+		{Text: "Sample text", UserAnnotations: []models.SampleAnnotation{{UserID: 3, LeaseExpiresAt: expired, Status: models.Accepted.ToNullString()}}},
+	}
+
+	dataset := &models.Dataset{
+		Name:    "dataset1",
+		Type:    models.EntityAnnotation,
+		Samples: dataset1Samples,
+	}
+
+	is.NoErr(db.Create(&dataset).Error)
+	released, releaseErr := handler.ReleaseExpiredLeases()
+	is.NoErr(releaseErr)
+	is.Equal(released, int64(1))
+
+	_, annotationErr := handler.findSampleAnnotation(dataset1Samples[0].ID, 1)
+	is.True(errors.Is(annotationErr, gorm.ErrRecordNotFound))
+
+	_, annotationErr = handler.findSampleAnnotation(dataset1Samples[1].ID, 2)
+	is.NoErr(annotationErr)
+
+	_, annotationErr = handler.findSampleAnnotation(dataset1Samples[2].ID, 3)
+	is.NoErr(annotationErr)
+
+	// the released sample can be assigned to another user
+	assignedSample, sampleErr := handler.AssignNextSample(dataset.ID, 5)
+	is.NoErr(sampleErr)
+	is.Equal(assignedSample.ID, dataset1Samples[0].ID)
+}
+
+func TestAssigningSampleToMultipleAnnotators(t *testing.T) {
+	db, cleanup := setupDBForSamplesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	dataset := &models.Dataset{
+		Name:                 "dataset1",
+		Type:                 models.EntityAnnotation,
+		AnnotationsPerSample: 2,
+		Samples:              []models.Sample{{Text: "Sample text"}, {Text: "Sample text"}},
+	}
+
+	is.NoErr(db.Create(&dataset).Error)
+	firstSample, firstSampleErr := handler.AssignNextSample(dataset.ID, 1)
+	is.NoErr(firstSampleErr)
+	is.Equal(firstSample.ID, dataset.Samples[0].ID)
+
+	// the second annotator gets the same sample
+	secondSample, secondSampleErr := handler.AssignNextSample(dataset.ID, 2)
+	is.NoErr(secondSampleErr)
+	is.Equal(secondSample.ID, dataset.Samples[0].ID)
+
+	// the sample is full for a third annotator
+	thirdSample, thirdSampleErr := handler.AssignNextSample(dataset.ID, 3)
+	is.NoErr(thirdSampleErr)
+	is.Equal(thirdSample.ID, dataset.Samples[1].ID)
+
+	// a user never gets the same sample twice
+	_, patchErr := handler.PatchSample(dataset.ID, firstSample.ID, testAnnotator(1), &UpdateSampleData{Status: models.Accepted.ToNullString()})
+	is.NoErr(patchErr)
+
+	nextSample, nextSampleErr := handler.AssignNextSample(dataset.ID, 1)
+	is.NoErr(nextSampleErr)
+	is.Equal(nextSample.ID, dataset.Samples[1].ID)
+
+	_, patchErr = handler.PatchSample(dataset.ID, nextSample.ID, testAnnotator(1), &UpdateSampleData{Status: models.Accepted.ToNullString()})
+	is.NoErr(patchErr)
+
+	_, noSampleErr := handler.AssignNextSample(dataset.ID, 1)
+	is.True(errors.Is(noSampleErr, gorm.ErrRecordNotFound))
+}
+
+func TestCompletingSampleWithMultipleAnnotations(t *testing.T) {
+	db, cleanup := setupDBForSamplesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	dataset := &models.Dataset{
+		Name:                 "dataset1",
+		Type:                 models.EntityAnnotation,
+		AnnotationsPerSample: 2,
+		Samples:              []models.Sample{{Text: "Sample text"}, {Text: "Sample text"}},
+	}
+
+	is.NoErr(db.Create(&dataset).Error)
+	annotate := func(userId uint, status models.StatusType) *models.Sample {
+		sample, sampleErr := handler.AssignNextSample(dataset.ID, userId)
+		is.NoErr(sampleErr)
+
+		_, patchErr := handler.PatchSample(dataset.ID, sample.ID, testAnnotator(userId), &UpdateSampleData{Status: status.ToNullString()})
+		is.NoErr(patchErr)
+
+		refreshedSample, refreshErr := handler.GetSample(dataset.ID, sample.ID)
+		is.NoErr(refreshErr)
+		return refreshedSample
+	}
+
+	// the sample stays open until it has enough annotations
+	is.True(!annotate(1, models.Accepted).Status.Valid)
+	is.Equal(annotate(2, models.Accepted).Status, models.Accepted.ToNullString())
+
+	// annotators disagree on the second sample
+	is.True(!annotate(1, models.Accepted).Status.Valid)
+	is.Equal(annotate(2, models.Rejected).Status, models.Uncertain.ToNullString())
+}
+
+func TestPatchSampleUnderReview(t *testing.T) {
+	db, cleanup := setupDBForSamplesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	dataset := &models.Dataset{
+		Name: "dataset1",
+		Type: models.EntityAnnotation,
+		Samples: []models.Sample{
+			{Text: "John", Status: models.Accepted.ToNullString(), ReviewStatus: models.Approved.ToNullString()},
+			{Text: "Jane", Status: models.Accepted.ToNullString(), ReviewStatus: models.InReview.ToNullString()},
+			{Text: "Jim", Status: models.Accepted.ToNullString(), ReviewStatus: models.Returned.ToNullString()},
+		},
+	}
+	is.NoErr(db.Create(&dataset).Error)
+	approved, inReview, returned := dataset.Samples[0], dataset.Samples[1], dataset.Samples[2]
+
+	// annotators without an assignment cannot change reviewed samples
+	update := &UpdateSampleData{Status: models.Rejected.ToNullString()}
+	_, patchErr := handler.PatchSample(dataset.ID, approved.ID, testAnnotator(1), update)
+	is.True(errors.Is(patchErr, ErrSampleUnderReview))
+	_, patchErr = handler.PatchSample(dataset.ID, inReview.ID, testAnnotator(1), update)
+	is.True(errors.Is(patchErr, ErrSampleUnderReview))
+
+	stored := &models.Sample{}
+	is.NoErr(db.First(stored, approved.ID).Error)
+	is.Equal(stored.Status, models.Accepted.ToNullString())
+	is.Equal(stored.Version, uint(1))
+
+	// returned samples are back with the annotators
+	_, patchErr = handler.PatchSample(dataset.ID, returned.ID, testAnnotator(1), update)
+	is.NoErr(patchErr)
+
+	for _, role := range []models.UserRole{models.ReviewerRole, models.AdminRole} {
+		_, patchErr = handler.PatchSample(dataset.ID, approved.ID, &models.User{Model: gorm.Model{ID: 2}, Role: role}, update)
+		is.NoErr(patchErr)
+	}
+}
+
+func TestReviewWorkflow(t *testing.T) {
+	db, cleanup := setupDBForSamplesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	dataset := &models.Dataset{
+		Name:    "dataset1",
+		Type:    models.EntityAnnotation,
+		Samples: []models.Sample{{Text: "Sample text"}},
+	}
+
+	is.NoErr(db.Create(&dataset).Error)
+	var reviewerId uint = 9
+
+	// completing the sample moves it to review
+	sample, sampleErr := handler.AssignNextSample(dataset.ID, 1)
+	is.NoErr(sampleErr)
+	_, patchErr := handler.PatchSample(dataset.ID, sample.ID, testAnnotator(1), &UpdateSampleData{Status: models.Accepted.ToNullString()})
+	is.NoErr(patchErr)
+
+	queue, queueErr := handler.GetReviewQueue(dataset.ID)
+	is.NoErr(queueErr)
+	is.Equal(len(queue), 1)
+	is.Equal(queue[0].ReviewStatus, models.InReview.ToNullString())
+	is.Equal(len(queue[0].UserAnnotations), 1)
+
+	// returning the sample reopens it for the same annotator
+	returnedSample, returnErr := handler.ReturnSample(dataset.ID, sample.ID, reviewerId, "missing entities")
+	is.NoErr(returnErr)
+	is.Equal(returnedSample.ReviewStatus, models.Returned.ToNullString())
+	is.Equal(returnedSample.ReviewComment.String, "missing entities")
+	is.True(!returnedSample.Status.Valid)
+
+	// the returned annotation has no lease, so releasing the expired leases keeps it
+	returnedAnnotation, annotationErr := handler.findSampleAnnotation(sample.ID, 1)
+	is.NoErr(annotationErr)
+	is.True(!returnedAnnotation.LeaseExpiresAt.Valid)
+	released, releaseErr := handler.ReleaseExpiredLeases()
+	is.NoErr(releaseErr)
+	is.Equal(released, int64(0))
+
+	_, acceptErr := handler.AcceptSample(dataset.ID, sample.ID, reviewerId)
+	is.True(errors.Is(acceptErr, ErrInvalidReviewTransition))
+
+	reassignedSample, reassignErr := handler.AssignNextSample(dataset.ID, 1)
+	is.NoErr(reassignErr)
+	is.Equal(reassignedSample.ID, sample.ID)
+
+	_, patchErr = handler.PatchSample(dataset.ID, sample.ID, testAnnotator(1), &UpdateSampleData{Status: models.Accepted.ToNullString()})
+	is.NoErr(patchErr)
+
+	acceptedSample, acceptErr := handler.AcceptSample(dataset.ID, sample.ID, reviewerId)
+	is.NoErr(acceptErr)
+	is.Equal(acceptedSample.ReviewStatus, models.Approved.ToNullString())
+	is.Equal(acceptedSample.ReviewedBy, null.IntFrom(int64(reviewerId)))
+
+	queue, queueErr = handler.GetReviewQueue(dataset.ID)
+	is.NoErr(queueErr)
+	is.Equal(len(queue), 0)
+}
+
+func TestMergeSample(t *testing.T) {
+	db, cleanup := setupDBForSamplesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	dataset := &models.Dataset{
+		Name:     "dataset1",
+		Type:     models.EntityAnnotation,
+		Metadata: datatypes.JSON(`{"entityTags": [{"name": "PER"}], "relationshipTags": []}`),
+		Samples: []models.Sample{
+			{Text: "John knows Jane", Status: models.Uncertain.ToNullString(), ReviewStatus: models.InReview.ToNullString()},
+		},
+	}
+
+	is.NoErr(db.Create(&dataset).Error)
+	sampleId := dataset.Samples[0].ID
+
+	_, mergeErr := handler.MergeSample(dataset.ID, sampleId, 9, &MergeSampleData{
+		Annotations: datatypes.JSON(`{"entities": [{"id": 1, "start": 0, "end": 4, "tag": "ORG"}], "relationships": []}`),
+	})
+	var validationErrs dataset_utils.ValidationErrors
+	is.True(errors.As(mergeErr, &validationErrs))
+
+	gold := datatypes.JSON(`{"entities": [{"id": 1, "start": 0, "end": 4, "tag": "PER"}], "relationships": []}`)
+	mergedSample, mergeErr := handler.MergeSample(dataset.ID, sampleId, 9, &MergeSampleData{
+		Annotations: gold,
+		Status:      models.Accepted.ToNullString(),
+	})
+	is.NoErr(mergeErr)
+	is.Equal(mergedSample.ReviewStatus, models.Approved.ToNullString())
+	is.Equal(mergedSample.Status, models.Accepted.ToNullString())
+	is.Equal(string(mergedSample.Annotations), string(gold))
+}
+
+func TestSampleHistory(t *testing.T) {
+	db, cleanup := setupDBForSamplesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	dataset := &models.Dataset{
+		Name:    "dataset1",
+		Type:    models.EntityAnnotation,
+		Samples: []models.Sample{{Text: "John knows Jane"}, {Text: "Jane knows John"}},
+	}
+
+	is.NoErr(db.Create(&dataset).Error)
+	sampleId := dataset.Samples[0].ID
+
+	firstAnnotations := datatypes.JSON(`{"entities": [{"id": 1, "start": 0, "end": 4}], "relationships": []}`)
+	secondAnnotations := datatypes.JSON(`{"entities": [{"id": 1, "start": 11, "end": 15}], "relationships": []}`)
+
+	_, patchErr := handler.PatchSample(dataset.ID, sampleId, testAnnotator(1), &UpdateSampleData{Annotations: firstAnnotations, Status: models.Accepted.ToNullString()})
+	is.NoErr(patchErr)
+	_, patchErr = handler.PatchSample(dataset.ID, sampleId, &models.User{Model: gorm.Model{ID: 2}, Role: models.ReviewerRole}, &UpdateSampleData{Annotations: secondAnnotations, Status: models.Rejected.ToNullString()})
+	is.NoErr(patchErr)
+
+	history, historyErr := handler.GetSampleHistory(dataset.ID, sampleId)
+	is.NoErr(historyErr)
+	is.Equal(len(history), 2)
+	is.Equal(history[0].UserID, uint(1))
+	is.Equal(history[0].Action, models.SampleUpdateAction)
+	is.True(!history[0].OldStatus.Valid)
+	is.Equal(history[0].NewStatus, models.Accepted.ToNullString())
+	is.Equal(history[1].UserID, uint(2))
+	is.Equal(string(history[1].OldAnnotations), string(firstAnnotations))
+	is.Equal(string(history[1].NewAnnotations), string(secondAnnotations))
+	is.Equal(history[1].OldStatus, models.Accepted.ToNullString())
+	is.Equal(history[1].NewStatus, models.Rejected.ToNullString())
+
+	// revisions are immutable
+	is.Equal(db.Model(history[0]).Update("user_id", 3).Error, models.ErrImmutableRevision)
+
+	restoredSample, restoreErr := handler.RestoreRevision(dataset.ID, sampleId, history[0].ID, 3)
+	is.NoErr(restoreErr)
+	is.Equal(string(restoredSample.Annotations), string(firstAnnotations))
+	is.Equal(restoredSample.Status, models.Accepted.ToNullString())
+
+	history, historyErr = handler.GetSampleHistory(dataset.ID, sampleId)
+	is.NoErr(historyErr)
+	is.Equal(len(history), 3)
+	is.Equal(history[2].Action, models.RestoreAction)
+	is.Equal(history[2].RestoredFrom, null.IntFrom(int64(history[0].ID)))
+
+	// revisions of other samples cannot be restored
+	_, restoreErr = handler.RestoreRevision(dataset.ID, dataset.Samples[1].ID, history[0].ID, 3)
+	is.True(errors.Is(restoreErr, gorm.ErrRecordNotFound))
+}
+
+func TestAnnotationHistory(t *testing.T) {
+	db, cleanup := setupDBForSamplesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	dataset := &models.Dataset{
+		Name:    "dataset1",
+		Type:    models.EntityAnnotation,
+		Samples: []models.Sample{{Text: "John knows Jane"}},
+	}
+
+	is.NoErr(db.Create(&dataset).Error)
+	sample, sampleErr := handler.AssignNextSample(dataset.ID, 1)
+	is.NoErr(sampleErr)
+
+	annotations := datatypes.JSON(`{"entities": [{"id": 1, "start": 0, "end": 4}], "relationships": []}`)
+	_, patchErr := handler.PatchSample(dataset.ID, sample.ID, testAnnotator(1), &UpdateSampleData{Annotations: annotations, Status: models.Accepted.ToNullString()})
+	is.NoErr(patchErr)
+
+	history, historyErr := handler.GetSampleHistory(dataset.ID, sample.ID)
+	is.NoErr(historyErr)
+	is.Equal(len(history), 2)
+
+	is.Equal(history[0].Action, models.AnnotationUpdateAction)
+	is.Equal(history[0].SampleAnnotationID, null.IntFrom(int64(sample.UserAnnotations[0].ID)))
+	is.Equal(string(history[0].NewAnnotations), string(annotations))
+
+	// completing the annotation copies it to the sample
+	is.Equal(history[1].Action, models.CompletionAction)
+	is.Equal(history[1].UserID, uint(1))
+	is.Equal(history[1].NewStatus, models.Accepted.ToNullString())
+
+	// restoring an annotation revision writes to the annotation and keeps the metadata of the sample
+	metadata := datatypes.JSON(`{"source": "news"}`)
+	is.NoErr(db.Model(&models.Sample{}).Where("id = ?", sample.ID).Update("metadata", metadata).Error)
+	_, patchErr = handler.PatchSample(dataset.ID, sample.ID, testAnnotator(1), &UpdateSampleData{Annotations: datatypes.JSON(`{"entities": [], "relationships": []}`)})
+	is.NoErr(patchErr)
+
+	restoredSample, restoreErr := handler.RestoreRevision(dataset.ID, sample.ID, history[0].ID, 2)
+	is.NoErr(restoreErr)
+	is.Equal(string(restoredSample.UserAnnotations[0].Annotations), string(annotations))
+	is.Equal(string(restoredSample.Metadata), string(metadata))
+
+	storedAnnotation, annotationErr := handler.findSampleAnnotation(sample.ID, 1)
+	is.NoErr(annotationErr)
+	is.Equal(string(storedAnnotation.Annotations), string(annotations))
+
+	history, historyErr = handler.GetSampleHistory(dataset.ID, sample.ID)
+	is.NoErr(historyErr)
+	var restore *models.SampleRevision
+	for _, revision := range history {
+		if revision.Action == models.RestoreAction {
+			restore = revision
+		}
+	}
+	is.True(restore != nil)
+	is.Equal(restore.SampleAnnotationID, null.IntFrom(int64(storedAnnotation.ID)))
+
+	// revisions of annotations that no longer exist cannot be restored
+	is.NoErr(db.Unscoped().Delete(storedAnnotation).Error)
+	_, restoreErr = handler.RestoreRevision(dataset.ID, sample.ID, history[0].ID, 2)
+	is.True(errors.Is(restoreErr, ErrInvalidRestore))
+}
+
+func TestDiffSample(t *testing.T) {
+	db, cleanup := setupDBForSamplesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	dataset := &models.Dataset{
+		Name:     "dataset1",
+		Type:     models.EntityAnnotation,
+		Metadata: datatypes.JSON(`{"entityTags": [{"name": "PER"}, {"name": "ORG"}]}`),
+		Samples:  []models.Sample{{Text: "John knows Jane"}},
+	}
+
+	is.NoErr(db.Create(&dataset).Error)
+	sampleId := dataset.Samples[0].ID
+
+	_, patchErr := handler.PatchSample(dataset.ID, sampleId, testAnnotator(1), &UpdateSampleData{
+		Annotations: datatypes.JSON(`{"entities": [{"id": 1, "start": 0, "end": 4, "tag": "PER"}], "relationships": []}`),
+	})
+	is.NoErr(patchErr)
+	_, patchErr = handler.PatchSample(dataset.ID, sampleId, testAnnotator(1), &UpdateSampleData{
+		Annotations: datatypes.JSON(`{"entities": [{"id": 1, "start": 0, "end": 4, "tag": "ORG"}, {"id": 2, "start": 11, "end": 15, "tag": "PER"}], "relationships": []}`),
+	})
+	is.NoErr(patchErr)
+
+	history, historyErr := handler.GetSampleHistory(dataset.ID, sampleId)
+	is.NoErr(historyErr)
+
+	// the first revision against the current annotations
+	diff, diffErr := handler.DiffSample(dataset.ID, sampleId, DiffSource{RevisionID: null.IntFrom(int64(history[0].ID))}, DiffSource{})
+	is.NoErr(diffErr)
+	is.Equal(len(diff.EntitiesRetagged), 1)
+	is.Equal(len(diff.EntitiesAdded), 1)
+
+	_, diffErr = handler.DiffSample(dataset.ID, sampleId, DiffSource{UserID: null.IntFrom(5)}, DiffSource{})
+	is.True(errors.Is(diffErr, gorm.ErrRecordNotFound))
+}
+
+func TestPatchSampleWithStaleVersion(t *testing.T) {
+	db, cleanup := setupDBForSamplesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	dataset := &models.Dataset{
+		Name:    "dataset1",
+		Type:    models.EntityAnnotation,
+		Samples: []models.Sample{{Text: "Sample text"}},
+	}
+
+	is.NoErr(db.Create(&dataset).Error)
+	sample, sampleErr := handler.GetSample(dataset.ID, dataset.Samples[0].ID)
+	is.NoErr(sampleErr)
+	is.Equal(sample.Version, uint(1))
+
+	// both tabs start from the same version
+	firstTab := &UpdateSampleData{Status: models.Accepted.ToNullString(), Version: null.IntFrom(int64(sample.Version))}
+	secondTab := &UpdateSampleData{Status: models.Rejected.ToNullString(), Version: null.IntFrom(int64(sample.Version))}
+
+	updatedSample, updateErr := handler.PatchSample(dataset.ID, sample.ID, testAnnotator(1), firstTab)
+	is.NoErr(updateErr)
+	is.Equal(updatedSample.Version, uint(2))
+
+	_, updateErr = handler.PatchSample(dataset.ID, sample.ID, testAnnotator(1), secondTab)
+	is.True(errors.Is(updateErr, ErrVersionConflict))
+
+	refreshedSample, refreshErr := handler.GetSample(dataset.ID, sample.ID)
+	is.NoErr(refreshErr)
+	is.Equal(refreshedSample.Status, models.Accepted.ToNullString())
+	is.Equal(refreshedSample.Version, uint(2))
+
+	history, historyErr := handler.GetSampleHistory(dataset.ID, sample.ID)
+	is.NoErr(historyErr)
+	is.Equal(len(history), 1)
+}
+
+func TestPatchSampleAnnotationVersions(t *testing.T) {
+	db, cleanup := setupDBForSamplesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	dataset := &models.Dataset{
+		Name:                 "dataset1",
+		Type:                 models.EntityAnnotation,
+		AnnotationsPerSample: 2,
+		Samples:              []models.Sample{{Text: "Sample text"}},
+	}
+
+	is.NoErr(db.Create(&dataset).Error)
+	first, assignErr := handler.AssignNextSample(dataset.ID, 1)
+	is.NoErr(assignErr)
+	second, assignErr := handler.AssignNextSample(dataset.ID, 2)
+	is.NoErr(assignErr)
+	is.Equal(first.UserAnnotations[0].Version, uint(1))
+	is.Equal(second.UserAnnotations[0].Version, uint(1))
+
+	// the annotators update their own annotations and do not conflict with each other
+	annotations := datatypes.JSON(`{"entities": [{"id": 1, "start": 0, "end": 6}], "relationships": []}`)
+	updatedSample, updateErr := handler.PatchSample(dataset.ID, first.ID, testAnnotator(1), &UpdateSampleData{Annotations: annotations, Version: null.IntFrom(1)})
+	is.NoErr(updateErr)
+	is.Equal(updatedSample.UserAnnotations[0].Version, uint(2))
+	is.Equal(updatedSample.Version, uint(1))
+
+	updatedSample, updateErr = handler.PatchSample(dataset.ID, second.ID, testAnnotator(2), &UpdateSampleData{Annotations: annotations, Version: null.IntFrom(1)})
+	is.NoErr(updateErr)
+	is.Equal(updatedSample.UserAnnotations[0].Version, uint(2))
+
+	// a stale version of the annotation still conflicts
+	_, updateErr = handler.PatchSample(dataset.ID, first.ID, testAnnotator(1), &UpdateSampleData{Status: models.Accepted.ToNullString(), Version: null.IntFrom(1)})
+	is.True(errors.Is(updateErr, ErrVersionConflict))
+
+	conflicting, sampleErr := handler.GetSampleForUser(dataset.ID, first.ID, 1)
+	is.NoErr(sampleErr)
+	is.Equal(len(conflicting.UserAnnotations), 1)
+	is.Equal(conflicting.UserAnnotations[0].UserID, uint(1))
+	is.Equal(conflicting.UserAnnotations[0].Version, uint(2))
+}
+
+func TestBulkResetStatus(t *testing.T) {
+	db, cleanup := setupDBForSamplesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	dataset := &models.Dataset{Name: "dataset1", Type: models.EntityAnnotation, Samples: []models.Sample{
+		{Text: "John knows Jane", Status: models.Accepted.ToNullString(), ReviewStatus: models.Approved.ToNullString(), UserAnnotations: []models.SampleAnnotation{
+			{UserID: 1, Status: models.Accepted.ToNullString()},
+		}},
+		{Text: "Jane knows John"},
+		{Text: "John and Jane", Status: models.Rejected.ToNullString()},
+	}}
+	is.NoErr(db.Create(dataset).Error)
+
+	result, bulkErr := handler.BulkUpdateSamples(dataset.ID, 2, &BulkSampleData{
+		SampleIDs: []uint{dataset.Samples[0].ID, dataset.Samples[1].ID},
+		Operation: BulkResetStatus,
+	})
+	is.NoErr(bulkErr)
+	is.Equal(*result, BulkSampleResult{MatchedSamples: 2, AffectedSamples: 1, AffectedAnnotations: 1})
+
+	sample, sampleErr := handler.GetSample(dataset.ID, dataset.Samples[0].ID)
+	is.NoErr(sampleErr)
+	is.True(!sample.Status.Valid)
+	is.True(!sample.ReviewStatus.Valid)
+	is.Equal(sample.Version, uint(2))
+
+	// the annotation is reopened for its annotator
+	sampleAnnotation, annotationErr := handler.findSampleAnnotation(sample.ID, 1)
+	is.NoErr(annotationErr)
+	is.True(!sampleAnnotation.Status.Valid)
+	is.True(!sampleAnnotation.LeaseExpiresAt.Valid)
+	is.Equal(sampleAnnotation.Version, uint(2))
+
+	history, historyErr := handler.GetSampleHistory(dataset.ID, sample.ID)
+	is.NoErr(historyErr)
+	is.Equal(len(history), 2)
+	is.Equal(history[0].Action, models.BulkUpdateAction)
+	is.Equal(history[0].OldStatus, models.Accepted.ToNullString())
+	is.Equal(history[1].Action, models.BulkUpdateAction)
+	is.Equal(history[1].SampleAnnotationID, null.IntFrom(int64(sampleAnnotation.ID)))
+	is.Equal(history[1].OldStatus, models.Accepted.ToNullString())
+	is.True(!history[1].NewStatus.Valid)
+
+	// samples that are not selected keep their status
+	sample, sampleErr = handler.GetSample(dataset.ID, dataset.Samples[2].ID)
+	is.NoErr(sampleErr)
+	is.Equal(sample.Status, models.Rejected.ToNullString())
+}
+
+func TestBulkReassignAndUnassign(t *testing.T) {
+	db, cleanup := setupDBForSamplesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	lease := null.TimeFrom(time.Now().Add(time.Hour))
+	dataset := &models.Dataset{Name: "dataset1", Type: models.EntityAnnotation, AnnotationsPerSample: 2, Samples: []models.Sample{
+		{Text: "John knows Jane", UserAnnotations: []models.SampleAnnotation{{UserID: 1, Slot: 0, LeaseExpiresAt: lease}}},
+		{Text: "Jane knows John", UserAnnotations: []models.SampleAnnotation{
+			{UserID: 1, Slot: 0, LeaseExpiresAt: lease},
+			{UserID: 2, Slot: 1, LeaseExpiresAt: lease},
+		}},
+		{Text: "John and Jane", UserAnnotations: []models.SampleAnnotation{{UserID: 1, Slot: 0, Status: models.Accepted.ToNullString()}}},
+	}}
+	is.NoErr(db.Create(dataset).Error)
+
+	// the second sample is already annotated by the new user and the third one is finished
+	result, bulkErr := handler.BulkUpdateSamples(dataset.ID, 3, &BulkSampleData{
+		Filter:     &SampleFilter{},
+		Operation:  BulkReassign,
+		FromUserID: null.IntFrom(1),
+		ToUserID:   null.IntFrom(2),
+	})
+	is.NoErr(bulkErr)
+	is.Equal(*result, BulkSampleResult{MatchedSamples: 3, AffectedAnnotations: 1})
+
+	reassigned, annotationErr := handler.findSampleAnnotation(dataset.Samples[0].ID, 2)
+	is.NoErr(annotationErr)
+	is.Equal(reassigned.Version, uint(2))
+	_, annotationErr = handler.findSampleAnnotation(dataset.Samples[1].ID, 1)
+	is.NoErr(annotationErr)
+	_, annotationErr = handler.findSampleAnnotation(dataset.Samples[2].ID, 1)
+	is.NoErr(annotationErr)
+
+	result, bulkErr = handler.BulkUpdateSamples(dataset.ID, 3, &BulkSampleData{
+		Filter:    &SampleFilter{Status: AssignedSampleFilter},
+		Operation: BulkUnassign,
+	})
+	is.NoErr(bulkErr)
+	is.Equal(*result, BulkSampleResult{MatchedSamples: 2, AffectedAnnotations: 3})
+
+	var remaining int64
+	is.NoErr(db.Unscoped().Model(&models.SampleAnnotation{}).Count(&remaining).Error)
+	is.Equal(remaining, int64(1))
+
+	// the reassignment and the removal are recorded on the annotation and the removal bumps the sample version
+	history, historyErr := handler.GetSampleHistory(dataset.ID, dataset.Samples[0].ID)
+	is.NoErr(historyErr)
+	is.Equal(len(history), 2)
+	is.Equal(history[0].SampleAnnotationID, null.IntFrom(int64(reassigned.ID)))
+	is.Equal(history[1].SampleAnnotationID, null.IntFrom(int64(reassigned.ID)))
+	is.Equal(history[1].UserID, uint(3))
+
+	sample, sampleErr := handler.GetSample(dataset.ID, dataset.Samples[0].ID)
+	is.NoErr(sampleErr)
+	is.Equal(sample.Version, uint(2))
+}
+
+func TestBulkRenameTagAndDelete(t *testing.T) {
+	db, cleanup := setupDBForSamplesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	annotations := datatypes.JSON(`{"entities": [{"id": 1, "start": 0, "end": 4, "tag": "PER"}, {"id": 2, "start": 11, "end": 15, "tag": "LOC"}], "relationships": []}`)
+	dataset := &models.Dataset{Name: "dataset1", Type: models.EntityAnnotation, Samples: []models.Sample{
+		{Text: "John knows Jane", Annotations: annotations, UserAnnotations: []models.SampleAnnotation{
+			{UserID: 1, Annotations: annotations, Status: models.Accepted.ToNullString()},
+		}},
+		{Text: "Jane knows John", Annotations: datatypes.JSON(`{"entities": [{"id": 1, "start": 0, "end": 4, "tag": "LOC"}], "relationships": []}`)},
+		{Text: "John and Jane", Status: models.Rejected.ToNullString()},
+	}}
+	is.NoErr(db.Create(dataset).Error)
+
+	result, bulkErr := handler.BulkUpdateSamples(dataset.ID, 2, &BulkSampleData{
+		Filter:    &SampleFilter{},
+		Operation: BulkRenameTag,
+		OldTag:    "PER",
+		NewTag:    "PERSON",
+	})
+	is.NoErr(bulkErr)
+	is.Equal(*result, BulkSampleResult{MatchedSamples: 3, AffectedSamples: 1, AffectedAnnotations: 1})
+
+	sample, sampleErr := handler.GetSample(dataset.ID, dataset.Samples[0].ID)
+	is.NoErr(sampleErr)
+	renamed, parsingErr := dataset_utils.ParseAnnotations(sample.Annotations)
+	is.NoErr(parsingErr)
+	is.Equal(renamed.Entities[0].Tag, null.StringFrom("PERSON"))
+	is.Equal(renamed.Entities[1].Tag, null.StringFrom("LOC"))
+
+	sampleAnnotation, annotationErr := handler.findSampleAnnotation(sample.ID, 1)
+	is.NoErr(annotationErr)
+	renamed, parsingErr = dataset_utils.ParseAnnotations(sampleAnnotation.Annotations)
+	is.NoErr(parsingErr)
+	is.Equal(renamed.Entities[0].Tag, null.StringFrom("PERSON"))
+
+	history, historyErr := handler.GetSampleHistory(dataset.ID, sample.ID)
+	is.NoErr(historyErr)
+	is.Equal(len(history), 2)
+
+	result, bulkErr = handler.BulkUpdateSamples(dataset.ID, 2, &BulkSampleData{
+		Filter:    &SampleFilter{Status: string(models.Rejected)},
+		Operation: BulkDelete,
+	})
+	is.NoErr(bulkErr)
+	is.Equal(*result, BulkSampleResult{MatchedSamples: 1, AffectedSamples: 1})
+
+	_, sampleErr = handler.GetSample(dataset.ID, dataset.Samples[2].ID)
+	is.True(errors.Is(sampleErr, gorm.ErrRecordNotFound))
+
+	deleted := &models.Sample{}
+	is.NoErr(db.Unscoped().First(deleted, dataset.Samples[2].ID).Error)
+	is.Equal(deleted.Version, uint(2))
+
+	var revisions []*models.SampleRevision
+	is.NoErr(db.Where("sample_id = ?", deleted.ID).Find(&revisions).Error)
+	is.Equal(len(revisions), 1)
+	is.Equal(revisions[0].Action, models.BulkUpdateAction)
+}
+
+func TestInvalidBulkOperations(t *testing.T) {
+	db, cleanup := setupDBForSamplesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	invalidOperations := []*BulkSampleData{
+		{Operation: BulkDelete},
+		{Filter: &SampleFilter{}, Operation: "archive"},
+		{Filter: &SampleFilter{}, Operation: BulkReassign, FromUserID: null.IntFrom(1)},
+		{SampleIDs: []uint{1}, Operation: BulkRenameTag, OldTag: "PER"},
+	}
+
+	for _, data := range invalidOperations {
+		_, bulkErr := handler.BulkUpdateSamples(1, 1, data)
+		is.True(errors.Is(bulkErr, ErrInvalidBulkOperation))
+	}
+
+	_, bulkErr := handler.BulkUpdateSamples(1, 1, &BulkSampleData{Filter: &SampleFilter{Status: "unknown"}, Operation: BulkDelete})
+	is.True(errors.Is(bulkErr, ErrInvalidSampleQuery))
+}
+
+func TestAssigningSamplesWithSamplingStrategies(t *testing.T) {
+	db, cleanup := setupDBForSamplesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	dataset := &models.Dataset{
+		Name:                 "dataset1",
+		Type:                 models.EntityAnnotation,
+		AnnotationsPerSample: 4,
+		Samples: []models.Sample{
+			{Text: "Sample text", Metadata: datatypes.JSON(`{"score": 0.2, "doc": "a"}`)},
+			{Text: "Sample text", Metadata: datatypes.JSON(`{"score": 0.9, "doc": "a"}`), Priority: null.FloatFrom(1)},
+			{Text: "Sample text", Metadata: datatypes.JSON(`{"doc": "b"}`), Priority: null.FloatFrom(5)},
+			{Text: "Sample text", Metadata: datatypes.JSON(`{"score": 0.5, "doc": "b"}`)},
+		},
+	}
+	is.NoErr(db.Create(&dataset).Error)
+	is.Equal(dataset.SamplingStrategy, models.SequentialSampling)
+
+	assignOrder := func(userId uint) []uint {
+		var ids []uint
+		for {
+			sample, assignErr := handler.AssignNextSample(dataset.ID, userId)
+			if errors.Is(assignErr, gorm.ErrRecordNotFound) {
+				return ids
+			}
+			is.NoErr(assignErr)
+
+			ids = append(ids, sample.ID)
+			_, patchErr := handler.PatchSample(dataset.ID, sample.ID, testAnnotator(userId), &UpdateSampleData{Status: models.Accepted.ToNullString()})
+			is.NoErr(patchErr)
+			is.NoErr(db.Model(&models.Sample{}).Where("id = ?", sample.ID).Update("status", nil).Error)
+		}
+	}
+
+	samples := dataset.Samples
+	is.NoErr(db.Model(dataset).Updates(map[string]interface{}{"sampling_strategy": models.PrioritySampling}).Error)
+	is.Equal(assignOrder(1), []uint{samples[2].ID, samples[1].ID, samples[0].ID, samples[3].ID})
+
+	is.NoErr(db.Model(dataset).Updates(map[string]interface{}{"sampling_strategy": models.UncertaintySampling, "sampling_key": "score"}).Error)
+	is.Equal(assignOrder(2), []uint{samples[1].ID, samples[3].ID, samples[0].ID, samples[2].ID})
+
+	// the strata take turns, starting with the ones with fewer assignments
+	is.NoErr(db.Model(dataset).Updates(map[string]interface{}{"sampling_strategy": models.StratifiedSampling, "sampling_key": "doc"}).Error)
+	is.Equal(assignOrder(3), []uint{samples[0].ID, samples[2].ID, samples[1].ID, samples[3].ID})
+
+	is.NoErr(db.Model(dataset).Updates(map[string]interface{}{"sampling_strategy": models.RandomSampling}).Error)
+	is.Equal(len(assignOrder(4)), 4)
+}
+
+func TestUpdatePriorities(t *testing.T) {
+	db, cleanup := setupDBForSamplesHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSamplesHandler(db)
+
+	dataset := &models.Dataset{
+		Name: "dataset1",
+		Type: models.EntityAnnotation,
+		Samples: []models.Sample{
+			{Text: "Sample text", Priority: null.FloatFrom(3)},
+			{Text: "Sample text", ExternalID: null.StringFrom("doc-2")},
+		},
+	}
+	is.NoErr(db.Create(&dataset).Error)
+
+	result, updateErr := handler.UpdatePriorities(dataset.ID, []*PriorityUpdate{
+		{SampleID: null.IntFrom(int64(dataset.Samples[0].ID))},
+		{ExternalID: null.StringFrom("doc-2"), Priority: null.FloatFrom(0.5)},
+		{ExternalID: null.StringFrom("doc-3"), Priority: null.FloatFrom(0.7)},
+	})
+	is.NoErr(updateErr)
+	is.Equal(*result, PriorityUpdateResult{UpdatedSamples: 2, MissingSamples: 1})
+
+	first, sampleErr := handler.GetSample(dataset.ID, dataset.Samples[0].ID)
+	is.NoErr(sampleErr)
+	is.Equal(first.Priority, null.Float{})
+	is.Equal(first.Version, uint(1))
+
+	second, sampleErr := handler.GetSample(dataset.ID, dataset.Samples[1].ID)
+	is.NoErr(sampleErr)
+	is.Equal(second.Priority, null.FloatFrom(0.5))
+
+	_, updateErr = handler.UpdatePriorities(dataset.ID, []*PriorityUpdate{{Priority: null.FloatFrom(1)}})
+	is.True(errors.Is(updateErr, ErrInvalidPriorityUpdate))
+}
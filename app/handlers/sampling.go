@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"backend/app/models"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"gopkg.in/guregu/null.v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrInvalidSamplingStrategy = errors.New("invalid sampling strategy")
+
+// sampling keys are embedded in JSON paths, so they are limited to plain names
+var samplingKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// sampler picks the next sample among the candidates, candidates returns a new query every time it is called
+type sampler func(db *gorm.DB, candidates func() *gorm.DB, dataset *models.Dataset) (*models.Sample, error)
+
+var samplers = map[models.SamplingStrategy]sampler{
+	models.SequentialSampling:  sequentialSampler,
+	models.RandomSampling:      randomSampler,
+	models.UncertaintySampling: uncertaintySampler,
+	models.StratifiedSampling:  stratifiedSampler,
+	models.PrioritySampling:    prioritySampler,
+}
+
+func validateSampling(strategy models.SamplingStrategy, key null.String) error {
+	if strategy.IsValid() != nil {
+		return fmt.Errorf("%w: unknown strategy %q", ErrInvalidSamplingStrategy, strategy)
+	}
+
+	if key.Valid && !samplingKeyPattern.MatchString(key.String) {
+		return fmt.Errorf("%w: invalid sampling key %q", ErrInvalidSamplingStrategy, key.String)
+	}
+
+	if strategy.UsesSamplingKey() && !key.Valid {
+		return fmt.Errorf("%w: the %s strategy needs a sampling key", ErrInvalidSamplingStrategy, strategy)
+	}
+
+	return nil
+}
+
+func getSampler(dataset *models.Dataset) (sampler, error) {
+	strategy := dataset.SamplingStrategy
+	if strategy == "" {
+		strategy = models.SequentialSampling
+	}
+
+	if validationErr := validateSampling(strategy, dataset.SamplingKey); validationErr != nil {
+		return nil, validationErr
+	}
+
+	return samplers[strategy], nil
+}
+
+func sequentialSampler(db *gorm.DB, candidates func() *gorm.DB, dataset *models.Dataset) (*models.Sample, error) {
+	sample := &models.Sample{}
+	if dbErr := candidates().Order("samples.id").First(sample).Error; dbErr != nil {
+		return nil, dbErr
+	}
+
+	return sample, nil
+}
+
+func randomSampler(db *gorm.DB, candidates func() *gorm.DB, dataset *models.Dataset) (*models.Sample, error) {
+	random := "RANDOM()"
+	if db.Dialector.Name() == "mysql" {
+		random = "RAND()"
+	}
+
+	sample := &models.Sample{}
+	if dbErr := candidates().Order(random).Take(sample).Error; dbErr != nil {
+		return nil, dbErr
+	}
+
+	return sample, nil
+}
+
+// prioritySampler assigns the samples with the highest priority first and the ones without one last
+func prioritySampler(db *gorm.DB, candidates func() *gorm.DB, dataset *models.Dataset) (*models.Sample, error) {
+	sample := &models.Sample{}
+	dbErr := candidates().
+		Clauses(clause.OrderBy{Expression: clause.Expr{SQL: "samples.priority IS NULL, samples.priority DESC, samples.id"}}).
+		Take(sample).Error
+	if dbErr != nil {
+		return nil, dbErr
+	}
+
+	return sample, nil
+}
+
+func uncertaintySampler(db *gorm.DB, candidates func() *gorm.DB, dataset *models.Dataset) (*models.Sample, error) {
+	score := metadataNumber(db.Dialector.Name(), dataset.SamplingKey.String)
+
+	sample := &models.Sample{}
+	dbErr := candidates().
+		Clauses(clause.OrderBy{Expression: clause.Expr{SQL: fmt.Sprintf("%s IS NULL, %s DESC, samples.id", score, score)}}).
+		Take(sample).Error
+	if dbErr != nil {
+		return nil, dbErr
+	}
+
+	return sample, nil
+}
+
+// stratifiedSampler takes the stratum with the fewest assignments among the ones that still have candidates,
+// samples without the sampling key make a stratum of their own
+func stratifiedSampler(db *gorm.DB, candidates func() *gorm.DB, dataset *models.Dataset) (*models.Sample, error) {
+	stratum := metadataValue(db.Dialector.Name(), dataset.SamplingKey.String)
+
+	var strata []null.String
+	if dbErr := candidates().Distinct().Pluck(stratum, &strata).Error; dbErr != nil {
+		return nil, dbErr
+	} else if len(strata) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var counts []struct {
+		Stratum     null.String
+		Assignments int64
+	}
+	dbErr := db.Model(&models.SampleAnnotation{}).
+		Select(stratum+" AS stratum, COUNT(*) AS assignments").
+		Joins("JOIN samples ON samples.id = sample_annotations.sample_id").
+		Where("samples.dataset_id = ? AND samples.deleted_at IS NULL", dataset.ID).
+		Group(stratum).
+		Scan(&counts).Error
+	if dbErr != nil {
+		return nil, dbErr
+	}
+
+	assignments := map[null.String]int64{}
+	for _, count := range counts {
+		assignments[count.Stratum] = count.Assignments
+	}
+
+	sort.SliceStable(strata, func(i, j int) bool {
+		if assignments[strata[i]] != assignments[strata[j]] {
+			return assignments[strata[i]] < assignments[strata[j]]
+		}
+		if strata[i].Valid != strata[j].Valid {
+			return strata[i].Valid
+		}
+		return strata[i].String < strata[j].String
+	})
+
+	query := candidates()
+	if next := strata[0]; next.Valid {
+		query = query.Where(stratum+" = ?", next.String)
+	} else {
+		query = query.Where(stratum + " IS NULL")
+	}
+
+	sample := &models.Sample{}
+	if dbErr := query.Order("samples.id").First(sample).Error; dbErr != nil {
+		return nil, dbErr
+	}
+
+	return sample, nil
+}
+
+// metadataValue extracts the key of the sample metadata as text, the key must match samplingKeyPattern
+func metadataValue(dialect string, key string) string {
+	if dialect == "mysql" {
+		return fmt.Sprintf(`JSON_UNQUOTE(JSON_EXTRACT(samples.metadata, '$."%s"'))`, key)
+	}
+
+	return fmt.Sprintf(`CAST(json_extract(samples.metadata, '$."%s"') AS TEXT)`, key)
+}
+
+// metadataNumber extracts the key of the sample metadata as a number
+func metadataNumber(dialect string, key string) string {
+	if dialect == "mysql" {
+		return fmt.Sprintf(`CAST(JSON_UNQUOTE(JSON_EXTRACT(samples.metadata, '$."%s"')) AS DECIMAL(65,30))`, key)
+	}
+
+	return fmt.Sprintf(`CAST(json_extract(samples.metadata, '$."%s"') AS REAL)`, key)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"backend/app/models"
+	"backend/app/utils"
+	"backend/app/utils/search"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+const DefaultSearchLimit = 20
+const MaxSearchLimit = 100
+
+var ErrEmptySearchQuery = errors.New("search query has no words")
+
+type SearchHandler struct {
+	DB    *gorm.DB
+	Index search.Index
+}
+
+func NewSearchHandler(db *gorm.DB, backend utils.DBBackend) *SearchHandler {
+	return &SearchHandler{
+		DB:    db,
+		Index: search.NewIndex(db, backend),
+	}
+}
+
+func (s *SearchHandler) SearchDataset(datasetId uint, query string, limit int) ([]*search.Hit, error) {
+	return s.search(query, []uint{datasetId}, limit)
+}
+
+// SearchUserDatasets searches every dataset for admins and the datasets assigned to the user otherwise
+func (s *SearchHandler) SearchUserDatasets(user *models.User, query string, limit int) ([]*search.Hit, error) {
+	if user.Role == models.AdminRole {
+		return s.search(query, nil, limit)
+	}
+
+	var datasetIds []uint
+	if dbErr := s.DB.Model(&models.UserDataset{}).Where("user_id = ?", user.ID).Pluck("dataset_id", &datasetIds).Error; dbErr != nil {
+		return nil, dbErr
+	}
+
+	if datasetIds == nil {
+		// a nil slice would search every dataset
+		datasetIds = []uint{}
+	}
+
+	return s.search(query, datasetIds, limit)
+}
+
+func (s *SearchHandler) search(query string, datasetIds []uint, limit int) ([]*search.Hit, error) {
+	terms := search.Terms(query)
+	if len(terms) == 0 {
+		return nil, ErrEmptySearchQuery
+	}
+
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	} else if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	return s.Index.Search(terms, datasetIds, limit)
+}
@@ -0,0 +1,153 @@
+//go:build sqlite_fts5
+
+package handlers
+
+import (
+	"backend/app/models"
+	"backend/app/utils"
+	"errors"
+	"testing"
+
+	"github.com/matryer/is"
+	"gorm.io/datatypes"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupDBForSearchHandlerTests(t *testing.T) (*gorm.DB, func() error) {
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+
+	if err != nil {
+		t.Fatalf("failed to open sqlite connection: %v", err)
+	}
+
+	if migrationErr := db.AutoMigrate(&models.Dataset{}, &models.Sample{}, &models.SampleAnnotation{}, &models.UserDataset{}); migrationErr != nil {
+		t.Fatalf("failed to migrate: %v", migrationErr)
+	}
+
+	sqlDB, sqlErr := db.DB()
+	if sqlErr != nil {
+		t.Fatalf("failed to obtain SQL DB: %v", sqlErr)
+	}
+	return db, sqlDB.Close
+}
+
+func TestSearchDataset(t *testing.T) {
+	db, cleanup := setupDBForSearchHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+
+	// samples created before the index are added when it is migrated
+	dataset := &models.Dataset{Name: "dataset1", Type: models.EntityAnnotation, Samples: []models.Sample{
+		{Text: "Acme hired John last year"},
+	}}
+	is.NoErr(db.Create(dataset).Error)
+
+	handler := NewSearchHandler(db, utils.SQLiteBackend)
+	is.NoErr(handler.Index.Migrate())
+	is.NoErr(handler.Index.Migrate())
+
+	samples := []models.Sample{
+		{DatasetID: dataset.ID, Text: "John works for a small company"},
+		{DatasetID: dataset.ID, Text: "Jane likes hiking", Annotations: datatypes.JSON(`{"entities": [{"id": 3, "start": 0, "end": 4, "tag": "PER", "notes": "Spelled Jayne in acme records"}]}`)},
+		{DatasetID: dataset.ID, Text: "Nothing to see here"},
+	}
+	is.NoErr(db.Create(&samples).Error)
+
+	hits, searchErr := handler.SearchDataset(dataset.ID, "ACME", 0)
+	is.NoErr(searchErr)
+	is.Equal(len(hits), 2)
+
+	hitsBySample := map[uint]int{}
+	for i, hit := range hits {
+		hitsBySample[hit.SampleID] = i
+	}
+
+	textHit := hits[hitsBySample[dataset.Samples[0].ID]]
+	is.Equal(textHit.DatasetID, dataset.ID)
+	is.Equal(textHit.Text.Text, "Acme hired John last year")
+	is.Equal(len(textHit.Text.Highlights), 1)
+	is.Equal(textHit.Text.Highlights[0].End, uint(4))
+	is.Equal(len(textHit.Notes), 0)
+
+	notesHit := hits[hitsBySample[samples[1].ID]]
+	is.Equal(len(notesHit.Text.Highlights), 0)
+	is.Equal(len(notesHit.Notes), 1)
+	is.Equal(notesHit.Notes[0].EntityID, uint(3))
+	is.Equal(notesHit.Notes[0].Highlights[0].Start, uint(17))
+
+	// all the words have to match
+	hits, searchErr = handler.SearchDataset(dataset.ID, "john company", 0)
+	is.NoErr(searchErr)
+	is.Equal(len(hits), 1)
+	is.Equal(hits[0].SampleID, samples[0].ID)
+
+	// the index follows updates and deletions
+	is.NoErr(db.Model(&samples[1]).Update("annotations", datatypes.JSON(`{"entities": []}`)).Error)
+	is.NoErr(db.Model(&samples[2]).Update("text", "Acme is everywhere").Error)
+	is.NoErr(db.Unscoped().Delete(&dataset.Samples[0]).Error)
+
+	hits, searchErr = handler.SearchDataset(dataset.ID, "acme", 0)
+	is.NoErr(searchErr)
+	is.Equal(len(hits), 1)
+	is.Equal(hits[0].SampleID, samples[2].ID)
+
+	// the notes of the annotations of the users are searched as well
+	userAnnotation := &models.SampleAnnotation{SampleID: samples[1].ID, UserID: 4}
+	is.NoErr(db.Create(userAnnotation).Error)
+	is.NoErr(db.Model(userAnnotation).Update("annotations", datatypes.JSON(`{"entities": [{"id": 1, "start": 0, "end": 4, "tag": "PER", "notes": "Maybe Jayne"}]}`)).Error)
+
+	hits, searchErr = handler.SearchDataset(dataset.ID, "jayne", 0)
+	is.NoErr(searchErr)
+	is.Equal(len(hits), 1)
+	is.Equal(hits[0].SampleID, samples[1].ID)
+	is.Equal(len(hits[0].Notes), 1)
+	is.Equal(hits[0].Notes[0].UserID, uint(4))
+
+	is.NoErr(db.Unscoped().Delete(userAnnotation).Error)
+	hits, searchErr = handler.SearchDataset(dataset.ID, "jayne", 0)
+	is.NoErr(searchErr)
+	is.Equal(len(hits), 0)
+
+	_, searchErr = handler.SearchDataset(dataset.ID, " \"* ", 0)
+	is.True(errors.Is(searchErr, ErrEmptySearchQuery))
+}
+
+func TestSearchUserDatasets(t *testing.T) {
+	db, cleanup := setupDBForSearchHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewSearchHandler(db, utils.SQLiteBackend)
+	is.NoErr(handler.Index.Migrate())
+
+	datasets := []models.Dataset{
+		{Name: "dataset1", Type: models.EntityAnnotation, Samples: []models.Sample{{Text: "Acme hired John"}}},
+		{Name: "dataset2", Type: models.EntityAnnotation, Samples: []models.Sample{{Text: "Acme fired Jane"}}},
+	}
+	is.NoErr(db.Create(&datasets).Error)
+	is.NoErr(db.Create(&models.UserDataset{UserID: 1, DatasetID: datasets[1].ID}).Error)
+
+	admin := &models.User{Role: models.AdminRole}
+	admin.ID = 2
+	hits, searchErr := handler.SearchUserDatasets(admin, "acme", 0)
+	is.NoErr(searchErr)
+	is.Equal(len(hits), 2)
+
+	annotator := &models.User{Role: models.AnnotatorRole}
+	annotator.ID = 1
+	hits, searchErr = handler.SearchUserDatasets(annotator, "acme", 0)
+	is.NoErr(searchErr)
+	is.Equal(len(hits), 1)
+	is.Equal(hits[0].DatasetID, datasets[1].ID)
+
+	// users without datasets find nothing
+	annotator.ID = 3
+	hits, searchErr = handler.SearchUserDatasets(annotator, "acme", 0)
+	is.NoErr(searchErr)
+	is.Equal(len(hits), 0)
+}
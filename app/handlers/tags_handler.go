@@ -0,0 +1,468 @@
+package handlers
+
+import (
+	"backend/app/models"
+	dataset "backend/app/utils/dataset"
+	dataset_import "backend/app/utils/dataset/import"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+type TagKind string
+
+const (
+	EntityTagKind       TagKind = "entity"
+	RelationshipTagKind TagKind = "relationship"
+)
+
+var ErrInvalidTag = errors.New("invalid tag")
+
+var ErrTagExists = errors.New("tag already exists")
+
+var ErrTagInUse = errors.New("tag is used by annotations")
+
+// UpdateTagData replaces a tag, renamed tags are renamed in the annotations of the dataset when RewriteAnnotations is set.
+// Tags used by annotations can only be renamed together with the annotations.
+type UpdateTagData struct {
+	dataset.Tag
+	RewriteAnnotations bool `json:"rewrite_annotations"`
+}
+
+// MergeTagData merges a tag into another tag of the same kind
+type MergeTagData struct {
+	Into               string `json:"into"`
+	RewriteAnnotations bool   `json:"rewrite_annotations"`
+}
+
+type TagUpdateResult struct {
+	Tag                 dataset.Tag `json:"tag"`
+	AffectedSamples     int64       `json:"affected_samples"`
+	AffectedAnnotations int64       `json:"affected_annotations"`
+}
+
+type TagsHandler struct {
+	DB *gorm.DB
+}
+
+func NewTagsHandler(db *gorm.DB) *TagsHandler {
+	return &TagsHandler{
+		DB: db,
+	}
+}
+
+func (t *TagsHandler) GetTags(datasetId uint) (*dataset.Metadata, error) {
+	targetDataset := &models.Dataset{}
+	if dbErr := t.DB.First(targetDataset, datasetId).Error; dbErr != nil {
+		return nil, dbErr
+	}
+
+	metadata, metadataErr := dataset.ParseMetadata(targetDataset.Metadata)
+	if metadataErr != nil {
+		return nil, metadataErr
+	}
+
+	if metadata.EntityTags == nil {
+		metadata.EntityTags = []dataset.Tag{}
+	}
+	if metadata.RelationshipTags == nil {
+		metadata.RelationshipTags = []dataset.Tag{}
+	}
+
+	return metadata, nil
+}
+
+func (t *TagsHandler) CreateTag(datasetId uint, kind TagKind, tag *dataset.Tag) (*dataset.Tag, error) {
+	txErr := t.DB.Transaction(func(tx *gorm.DB) error {
+		return t.updateMetadata(tx, datasetId, func(metadata *dataset.Metadata) error {
+			if validationErr := validateTag(metadata, kind, tag, ""); validationErr != nil {
+				return validationErr
+			}
+
+			tags := tagsOfKind(metadata, kind)
+			*tags = append(*tags, *tag)
+			return nil
+		})
+	})
+
+	if txErr != nil {
+		return nil, txErr
+	}
+
+	return tag, nil
+}
+
+// UpdateTag replaces the tag with the given name
+func (t *TagsHandler) UpdateTag(datasetId uint, kind TagKind, name string, userId uint, data *UpdateTagData) (*TagUpdateResult, error) {
+	result := &TagUpdateResult{Tag: data.Tag}
+	txErr := t.DB.Transaction(func(tx *gorm.DB) error {
+		metadataErr := t.updateMetadata(tx, datasetId, func(metadata *dataset.Metadata) error {
+			index := findTag(*tagsOfKind(metadata, kind), name)
+			if index == -1 {
+				return gorm.ErrRecordNotFound
+			}
+
+			if validationErr := validateTag(metadata, kind, &data.Tag, name); validationErr != nil {
+				return validationErr
+			}
+
+			(*tagsOfKind(metadata, kind))[index] = data.Tag
+			if kind == EntityTagKind {
+				renameConstraintTag(metadata, name, data.Name)
+			}
+			return nil
+		})
+		if metadataErr != nil {
+			return metadataErr
+		}
+
+		if kind == EntityTagKind && data.Name != name {
+			if renameErr := renameLabelingRulesTag(tx, datasetId, name, data.Name); renameErr != nil {
+				return renameErr
+			}
+		}
+
+		if data.Name == name {
+			return nil
+		}
+
+		if !data.RewriteAnnotations {
+			return t.checkTagUnused(tx, datasetId, kind, name)
+		}
+
+		return t.renameInAnnotations(tx, datasetId, userId, kind, name, data.Name, result)
+	})
+
+	if txErr != nil {
+		return nil, txErr
+	}
+
+	return result, nil
+}
+
+// MergeTag removes the tag and optionally renames it to the tag it is merged into in the annotations
+func (t *TagsHandler) MergeTag(datasetId uint, kind TagKind, name string, userId uint, data *MergeTagData) (*TagUpdateResult, error) {
+	if data.Into == name {
+		return nil, fmt.Errorf("%w: a tag cannot be merged into itself", ErrInvalidTag)
+	}
+
+	result := &TagUpdateResult{}
+	txErr := t.DB.Transaction(func(tx *gorm.DB) error {
+		metadataErr := t.updateMetadata(tx, datasetId, func(metadata *dataset.Metadata) error {
+			tags := tagsOfKind(metadata, kind)
+			index := findTag(*tags, name)
+			if index == -1 {
+				return gorm.ErrRecordNotFound
+			}
+
+			intoIndex := findTag(*tags, data.Into)
+			if intoIndex == -1 {
+				return fmt.Errorf("%w: unknown tag %q", ErrInvalidTag, data.Into)
+			}
+
+			result.Tag = (*tags)[intoIndex]
+			*tags = append((*tags)[:index], (*tags)[index+1:]...)
+			if kind == EntityTagKind {
+				renameConstraintTag(metadata, name, data.Into)
+			}
+			return nil
+		})
+		if metadataErr != nil {
+			return metadataErr
+		}
+
+		if kind == EntityTagKind {
+			if renameErr := renameLabelingRulesTag(tx, datasetId, name, data.Into); renameErr != nil {
+				return renameErr
+			}
+		}
+
+		if !data.RewriteAnnotations {
+			return t.checkTagUnused(tx, datasetId, kind, name)
+		}
+
+		return t.renameInAnnotations(tx, datasetId, userId, kind, name, data.Into, result)
+	})
+
+	if txErr != nil {
+		return nil, txErr
+	}
+
+	return result, nil
+}
+
+// DeleteTag removes a tag that no annotation of the dataset uses
+func (t *TagsHandler) DeleteTag(datasetId uint, kind TagKind, name string) error {
+	return t.DB.Transaction(func(tx *gorm.DB) error {
+		inUse, usageErr := t.isTagUsed(tx, datasetId, kind, name)
+		if usageErr != nil {
+			return usageErr
+		} else if inUse {
+			return fmt.Errorf("%w: %q", ErrTagInUse, name)
+		}
+
+		if kind == EntityTagKind {
+			var rules int64
+			if dbErr := tx.Model(&models.LabelingRule{}).Where("dataset_id = ? AND tag = ?", datasetId, name).Count(&rules).Error; dbErr != nil {
+				return dbErr
+			} else if rules > 0 {
+				return fmt.Errorf("%w: %q is used by labeling rules", ErrTagInUse, name)
+			}
+		}
+
+		return t.updateMetadata(tx, datasetId, func(metadata *dataset.Metadata) error {
+			tags := tagsOfKind(metadata, kind)
+			index := findTag(*tags, name)
+			if index == -1 {
+				return gorm.ErrRecordNotFound
+			}
+
+			if kind == EntityTagKind {
+				for _, relationshipTag := range metadata.RelationshipTags {
+					if containsTagName(relationshipTag.Sources, name) || containsTagName(relationshipTag.Targets, name) {
+						return fmt.Errorf("%w: %q is allowed by relationship %q", ErrTagInUse, name, relationshipTag.Name)
+					}
+				}
+			}
+
+			*tags = append((*tags)[:index], (*tags)[index+1:]...)
+			return nil
+		})
+	})
+}
+
+// updateMetadata applies the update to the metadata of the dataset and saves it
+func (t *TagsHandler) updateMetadata(tx *gorm.DB, datasetId uint, update func(*dataset.Metadata) error) error {
+	targetDataset := &models.Dataset{}
+	if dbErr := tx.First(targetDataset, datasetId).Error; dbErr != nil {
+		return dbErr
+	}
+
+	metadata, metadataErr := dataset.ParseMetadata(targetDataset.Metadata)
+	if metadataErr != nil {
+		return metadataErr
+	}
+
+	if updateErr := update(metadata); updateErr != nil {
+		return updateErr
+	}
+
+	metadataJson, marshalErr := dataset_import.MarshalDatasetMetadata(*metadata)
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	return tx.Model(targetDataset).Update("metadata", metadataJson).Error
+}
+
+func (t *TagsHandler) renameInAnnotations(tx *gorm.DB, datasetId uint, userId uint, kind TagKind, oldName string, newName string, result *TagUpdateResult) error {
+	var sampleIds []uint
+	if dbErr := tx.Model(&models.Sample{}).Where("dataset_id = ?", datasetId).Order("id").Pluck("id", &sampleIds).Error; dbErr != nil {
+		return dbErr
+	}
+
+	rename := func(annotations *dataset.AnnotationData) bool {
+		if kind == EntityTagKind {
+			return annotations.RenameEntityTag(oldName, newName)
+		}
+		return annotations.RenameRelationshipTag(oldName, newName)
+	}
+
+	samplesHandler := &SamplesHandler{DB: tx}
+	bulkResult := &BulkSampleResult{}
+	for start := 0; start < len(sampleIds); start += bulkChunkSize {
+		end := start + bulkChunkSize
+		if end > len(sampleIds) {
+			end = len(sampleIds)
+		}
+
+		if rewriteErr := samplesHandler.rewriteAnnotations(tx, sampleIds[start:end], userId, rename, bulkResult); rewriteErr != nil {
+			return rewriteErr
+		}
+	}
+
+	result.AffectedSamples = bulkResult.AffectedSamples
+	result.AffectedAnnotations = bulkResult.AffectedAnnotations
+	return nil
+}
+
+// checkTagUnused returns ErrTagInUse when annotations still use the tag, so that a tag is not renamed
+// or merged away from under them without rewriting them
+func (t *TagsHandler) checkTagUnused(tx *gorm.DB, datasetId uint, kind TagKind, name string) error {
+	inUse, usageErr := t.isTagUsed(tx, datasetId, kind, name)
+	if usageErr != nil {
+		return usageErr
+	} else if inUse {
+		return fmt.Errorf("%w: %q, rewrite the annotations to rename it", ErrTagInUse, name)
+	}
+
+	return nil
+}
+
+// isTagUsed checks the annotations of the samples of the dataset and of their users
+func (t *TagsHandler) isTagUsed(tx *gorm.DB, datasetId uint, kind TagKind, name string) (bool, error) {
+	used := false
+	check := func(data []byte) error {
+		annotations, parsingErr := dataset.ParseAnnotations(data)
+		if parsingErr != nil {
+			return parsingErr
+		}
+
+		used = used || usesTag(annotations, kind, name)
+		return nil
+	}
+
+	var samples []*models.Sample
+	samplesErr := tx.Select("id", "annotations").
+		Where("dataset_id = ? AND annotations IS NOT NULL", datasetId).
+		FindInBatches(&samples, bulkChunkSize, func(batchTx *gorm.DB, batch int) error {
+			for _, sample := range samples {
+				if checkErr := check(sample.Annotations); checkErr != nil || used {
+					return checkErr
+				}
+			}
+
+			return nil
+		}).Error
+	if samplesErr != nil || used {
+		return used, samplesErr
+	}
+
+	var sampleAnnotations []*models.SampleAnnotation
+	annotationsErr := tx.Select("sample_annotations.id", "sample_annotations.annotations").
+		Joins("JOIN samples ON samples.id = sample_annotations.sample_id").
+		Where("samples.dataset_id = ? AND sample_annotations.annotations IS NOT NULL", datasetId).
+		FindInBatches(&sampleAnnotations, bulkChunkSize, func(batchTx *gorm.DB, batch int) error {
+			for _, sampleAnnotation := range sampleAnnotations {
+				if checkErr := check(sampleAnnotation.Annotations); checkErr != nil || used {
+					return checkErr
+				}
+			}
+
+			return nil
+		}).Error
+
+	return used, annotationsErr
+}
+
+func usesTag(annotations *dataset.AnnotationData, kind TagKind, name string) bool {
+	if kind == EntityTagKind {
+		for _, entity := range annotations.Entities {
+			if entity.Tag.Valid && entity.Tag.String == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, relationship := range annotations.Relationships {
+		if relationship.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func renameLabelingRulesTag(tx *gorm.DB, datasetId uint, oldName string, newName string) error {
+	return tx.Model(&models.LabelingRule{}).Where("dataset_id = ? AND tag = ?", datasetId, oldName).Update("tag", newName).Error
+}
+
+// renameConstraintTag renames an entity tag in the sources and targets of the relationship tags
+func renameConstraintTag(metadata *dataset.Metadata, oldName string, newName string) {
+	rename := func(names []string) []string {
+		renamed := make([]string, 0, len(names))
+		for _, name := range names {
+			if name == oldName {
+				name = newName
+			}
+			if !containsTagName(renamed, name) {
+				renamed = append(renamed, name)
+			}
+		}
+		return renamed
+	}
+
+	for i := range metadata.RelationshipTags {
+		if len(metadata.RelationshipTags[i].Sources) > 0 {
+			metadata.RelationshipTags[i].Sources = rename(metadata.RelationshipTags[i].Sources)
+		}
+		if len(metadata.RelationshipTags[i].Targets) > 0 {
+			metadata.RelationshipTags[i].Targets = rename(metadata.RelationshipTags[i].Targets)
+		}
+	}
+}
+
+func containsTagName(names []string, name string) bool {
+	for _, other := range names {
+		if other == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func tagsOfKind(metadata *dataset.Metadata, kind TagKind) *[]dataset.Tag {
+	if kind == EntityTagKind {
+		return &metadata.EntityTags
+	}
+	return &metadata.RelationshipTags
+}
+
+func findTag(tags []dataset.Tag, name string) int {
+	for i, tag := range tags {
+		if tag.Name == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// validateTag checks the tag that replaces the current tag, the current name is empty for new tags.
+// Names are unique per kind and hotkeys are unique across all the tags of the dataset.
+func validateTag(metadata *dataset.Metadata, kind TagKind, tag *dataset.Tag, currentName string) error {
+	if kind != EntityTagKind && kind != RelationshipTagKind {
+		return fmt.Errorf("%w: unknown tag kind %q", ErrInvalidTag, kind)
+	}
+
+	tag.Name = strings.TrimSpace(tag.Name)
+	if tag.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidTag)
+	}
+
+	if tag.Name != currentName && findTag(*tagsOfKind(metadata, kind), tag.Name) != -1 {
+		return fmt.Errorf("%w: %q", ErrTagExists, tag.Name)
+	}
+
+	if kind == EntityTagKind && (tag.HasConstraints() || tag.Directed) {
+		return fmt.Errorf("%w: only relationship tags have sources, targets and a direction", ErrInvalidTag)
+	}
+
+	for _, name := range append(append([]string{}, tag.Sources...), tag.Targets...) {
+		if findTag(metadata.EntityTags, name) == -1 {
+			return fmt.Errorf("%w: unknown entity tag %q", ErrInvalidTag, name)
+		}
+	}
+
+	if !tag.Hotkey.Valid {
+		return nil
+	}
+
+	if utf8.RuneCountInString(tag.Hotkey.String) != 1 {
+		return fmt.Errorf("%w: hotkey must be a single character", ErrInvalidTag)
+	}
+
+	for _, otherKind := range []TagKind{EntityTagKind, RelationshipTagKind} {
+		for _, other := range *tagsOfKind(metadata, otherKind) {
+			if other.Hotkey == tag.Hotkey && !(otherKind == kind && other.Name == currentName) {
+				return fmt.Errorf("%w: hotkey %q is used by %q", ErrTagExists, tag.Hotkey.String, other.Name)
+			}
+		}
+	}
+
+	return nil
+}
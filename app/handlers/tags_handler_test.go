@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"backend/app/models"
+	dataset_utils "backend/app/utils/dataset"
+	"errors"
+	"testing"
+
+	"github.com/matryer/is"
+	"gopkg.in/guregu/null.v4"
+	"gorm.io/datatypes"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupDBForTagsHandlerTests(t *testing.T) (*gorm.DB, func() error) {
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+
+	if err != nil {
+		t.Fatalf("failed to open sqlite connection: %v", err)
+	}
+
+	if migrationErr := db.AutoMigrate(&models.Sample{}); migrationErr != nil {
+		t.Fatalf("failed to migrate sample: %v", migrationErr)
+	}
+
+	if migrationErr := db.AutoMigrate(&models.Dataset{}); migrationErr != nil {
+		t.Fatalf("failed to migrate dataset: %v", migrationErr)
+	}
+
+	if migrationErr := db.AutoMigrate(&models.SampleAnnotation{}); migrationErr != nil {
+		t.Fatalf("failed to migrate sample annotation: %v", migrationErr)
+	}
+
+	if migrationErr := db.AutoMigrate(&models.SampleRevision{}); migrationErr != nil {
+		t.Fatalf("failed to migrate sample revision: %v", migrationErr)
+	}
+
+	if migrationErr := db.AutoMigrate(&models.LabelingRule{}); migrationErr != nil {
+		t.Fatalf("failed to migrate labeling rule: %v", migrationErr)
+	}
+
+	sqlDB, sqlErr := db.DB()
+	if sqlErr != nil {
+		t.Fatalf("failed to obtain SQL DB: %v", sqlErr)
+	}
+	return db, sqlDB.Close
+}
+
+func TestCreateAndUpdateTags(t *testing.T) {
+	db, cleanup := setupDBForTagsHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewTagsHandler(db)
+
+	dataset := &models.Dataset{Name: "dataset1", Type: models.EntityAnnotation}
+	is.NoErr(db.Create(dataset).Error)
+
+	tags, tagsErr := handler.GetTags(dataset.ID)
+	is.NoErr(tagsErr)
+	is.Equal(len(tags.EntityTags), 0)
+
+	_, createErr := handler.CreateTag(dataset.ID, EntityTagKind, &dataset_utils.Tag{Name: " PER ", Hotkey: null.StringFrom("p")})
+	is.NoErr(createErr)
+	_, createErr = handler.CreateTag(dataset.ID, RelationshipTagKind, &dataset_utils.Tag{Name: "PER"})
+	is.NoErr(createErr)
+
+	_, createErr = handler.CreateTag(dataset.ID, EntityTagKind, &dataset_utils.Tag{Name: "PER"})
+	is.True(errors.Is(createErr, ErrTagExists))
+	_, createErr = handler.CreateTag(dataset.ID, EntityTagKind, &dataset_utils.Tag{Name: "LOC", Hotkey: null.StringFrom("p")})
+	is.True(errors.Is(createErr, ErrTagExists))
+	_, createErr = handler.CreateTag(dataset.ID, EntityTagKind, &dataset_utils.Tag{Name: "LOC", Hotkey: null.StringFrom("lo")})
+	is.True(errors.Is(createErr, ErrInvalidTag))
+	_, createErr = handler.CreateTag(dataset.ID, EntityTagKind, &dataset_utils.Tag{Name: " "})
+	is.True(errors.Is(createErr, ErrInvalidTag))
+
+	// the tag keeps its own hotkey
+	updated, updateErr := handler.UpdateTag(dataset.ID, EntityTagKind, "PER", 1, &UpdateTagData{
+		Tag: dataset_utils.Tag{Name: "PER", Color: null.StringFrom("#ff0000"), Description: null.StringFrom("A person"), Hotkey: null.StringFrom("p")},
+	})
+	is.NoErr(updateErr)
+	is.Equal(updated.Tag.Color, null.StringFrom("#ff0000"))
+
+	_, updateErr = handler.UpdateTag(dataset.ID, EntityTagKind, "ORG", 1, &UpdateTagData{Tag: dataset_utils.Tag{Name: "ORG"}})
+	is.True(errors.Is(updateErr, gorm.ErrRecordNotFound))
+
+	tags, tagsErr = handler.GetTags(dataset.ID)
+	is.NoErr(tagsErr)
+	is.Equal(tags.EntityTags, []dataset_utils.Tag{{Name: "PER", Color: null.StringFrom("#ff0000"), Description: null.StringFrom("A person"), Hotkey: null.StringFrom("p")}})
+	is.Equal(tags.RelationshipTags, []dataset_utils.Tag{{Name: "PER"}})
+}
+
+func TestTagsWithRelationshipConstraints(t *testing.T) {
+	db, cleanup := setupDBForTagsHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewTagsHandler(db)
+
+	dataset := &models.Dataset{
+		Name:     "dataset1",
+		Type:     models.RelationAnnotation,
+		Metadata: datatypes.JSON(`{"entityTags": [{"name": "PER"}, {"name": "ORG"}], "relationshipTags": []}`),
+	}
+	is.NoErr(db.Create(dataset).Error)
+
+	_, createErr := handler.CreateTag(dataset.ID, RelationshipTagKind, &dataset_utils.Tag{Name: "works_for", Sources: []string{"PER"}, Targets: []string{"LOC"}})
+	is.True(errors.Is(createErr, ErrInvalidTag))
+	_, createErr = handler.CreateTag(dataset.ID, EntityTagKind, &dataset_utils.Tag{Name: "LOC", Directed: true})
+	is.True(errors.Is(createErr, ErrInvalidTag))
+
+	_, createErr = handler.CreateTag(dataset.ID, RelationshipTagKind, &dataset_utils.Tag{Name: "works_for", Sources: []string{"PER"}, Targets: []string{"ORG"}, Directed: true})
+	is.NoErr(createErr)
+
+	deleteErr := handler.DeleteTag(dataset.ID, EntityTagKind, "ORG")
+	is.True(errors.Is(deleteErr, ErrTagInUse))
+
+	_, updateErr := handler.UpdateTag(dataset.ID, EntityTagKind, "PER", 1, &UpdateTagData{Tag: dataset_utils.Tag{Name: "PERSON"}})
+	is.NoErr(updateErr)
+
+	tags, tagsErr := handler.GetTags(dataset.ID)
+	is.NoErr(tagsErr)
+	is.Equal(tags.RelationshipTags[0].Sources, []string{"PERSON"})
+	is.Equal(tags.RelationshipTags[0].Targets, []string{"ORG"})
+}
+
+func TestRenameMergeAndDeleteTags(t *testing.T) {
+	db, cleanup := setupDBForTagsHandlerTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+	handler := NewTagsHandler(db)
+
+	annotations := datatypes.JSON(`{"entities": [{"id": 1, "start": 0, "end": 4, "tag": "PER"}, {"id": 2, "start": 11, "end": 15, "tag": "PERSON"}], "relationships": [{"id": 1, "entity1": 1, "entity2": 2, "name": "PER"}]}`)
+	dataset := &models.Dataset{
+		Name:     "dataset1",
+		Type:     models.EntityAnnotation,
+		Metadata: datatypes.JSON(`{"entityTags": [{"name": "PER"}, {"name": "PERSON"}, {"name": "LOC"}], "relationshipTags": [{"name": "PER"}]}`),
+		Samples: []models.Sample{
+			{Text: "John knows Jane", UserAnnotations: []models.SampleAnnotation{{UserID: 1, Annotations: annotations}}},
+			{Text: "Jane knows John", Annotations: annotations},
+		},
+	}
+	is.NoErr(db.Create(dataset).Error)
+
+	deleteErr := handler.DeleteTag(dataset.ID, EntityTagKind, "PERSON")
+	is.True(errors.Is(deleteErr, ErrTagInUse))
+
+	// tags used by annotations are not renamed or merged without rewriting them
+	_, updateErr := handler.UpdateTag(dataset.ID, EntityTagKind, "PERSON", 2, &UpdateTagData{Tag: dataset_utils.Tag{Name: "HUMAN"}})
+	is.True(errors.Is(updateErr, ErrTagInUse))
+	_, mergeErr := handler.MergeTag(dataset.ID, EntityTagKind, "PERSON", 2, &MergeTagData{Into: "LOC"})
+	is.True(errors.Is(mergeErr, ErrTagInUse))
+
+	// only the entity tags are renamed
+	result, updateErr := handler.UpdateTag(dataset.ID, EntityTagKind, "PERSON", 2, &UpdateTagData{Tag: dataset_utils.Tag{Name: "HUMAN"}, RewriteAnnotations: true})
+	is.NoErr(updateErr)
+	is.Equal(result.AffectedSamples, int64(1))
+	is.Equal(result.AffectedAnnotations, int64(1))
+
+	result, mergeErr = handler.MergeTag(dataset.ID, EntityTagKind, "PER", 2, &MergeTagData{Into: "HUMAN", RewriteAnnotations: true})
+	is.NoErr(mergeErr)
+	is.Equal(result.Tag.Name, "HUMAN")
+	is.Equal(result.AffectedSamples, int64(1))
+
+	_, mergeErr = handler.MergeTag(dataset.ID, EntityTagKind, "HUMAN", 2, &MergeTagData{Into: "ORG"})
+	is.True(errors.Is(mergeErr, ErrInvalidTag))
+
+	sample := &models.Sample{}
+	is.NoErr(db.First(sample, dataset.Samples[1].ID).Error)
+	rewritten, parsingErr := dataset_utils.ParseAnnotations(sample.Annotations)
+	is.NoErr(parsingErr)
+	is.Equal(rewritten.Entities[0].Tag, null.StringFrom("HUMAN"))
+	is.Equal(rewritten.Entities[1].Tag, null.StringFrom("HUMAN"))
+	is.Equal(rewritten.Relationships[0].Name, "PER")
+
+	sampleAnnotation := &models.SampleAnnotation{}
+	is.NoErr(db.Where("sample_id = ?", dataset.Samples[0].ID).First(sampleAnnotation).Error)
+	rewritten, parsingErr = dataset_utils.ParseAnnotations(sampleAnnotation.Annotations)
+	is.NoErr(parsingErr)
+	is.Equal(rewritten.Entities[0].Tag, null.StringFrom("HUMAN"))
+
+	tags, tagsErr := handler.GetTags(dataset.ID)
+	is.NoErr(tagsErr)
+	is.Equal(tags.EntityTags, []dataset_utils.Tag{{Name: "HUMAN"}, {Name: "LOC"}})
+
+	is.NoErr(handler.DeleteTag(dataset.ID, EntityTagKind, "LOC"))
+	deleteErr = handler.DeleteTag(dataset.ID, RelationshipTagKind, "PER")
+	is.True(errors.Is(deleteErr, ErrTagInUse))
+	deleteErr = handler.DeleteTag(dataset.ID, EntityTagKind, "LOC")
+	is.True(errors.Is(deleteErr, gorm.ErrRecordNotFound))
+}
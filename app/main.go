@@ -10,6 +10,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"backend/app/utils"
@@ -35,6 +36,12 @@ type App struct {
 	samplesHandler          *handlers.SamplesHandler
 	usersHandler            *handlers.UsersHandler
 	userDatasetPermsHandler *handlers.UserDatasetPermsHandler
+	datasetImportHandler    *handlers.DatasetImportHandler
+	agreementHandler        *handlers.AgreementHandler
+	searchHandler           *handlers.SearchHandler
+	tagsHandler             *handlers.TagsHandler
+	preAnnotationHandler    *handlers.PreAnnotationHandler
+	labelingRulesHandler    *handlers.LabelingRulesHandler
 }
 
 func (a *App) Initialize() {
@@ -58,15 +65,39 @@ func (a *App) Initialize() {
 	a.authHandler = handlers.NewAuthHandler(a.userAuth, a.tokenAuth)
 	a.datasetsHandler = handlers.NewDatasetsHandler(db)
 	a.samplesHandler = handlers.NewSamplesHandler(db)
+	if leaseTTL := os.Getenv("SAMPLE_LEASE_TTL"); leaseTTL != "" {
+		ttl, ttlErr := time.ParseDuration(leaseTTL)
+		if ttlErr != nil {
+			log.Fatalf("Invalid SAMPLE_LEASE_TTL: %v\n", ttlErr)
+		}
+		a.samplesHandler.LeaseTTL = ttl
+	}
 	a.usersHandler = handlers.NewUsersHandler(db)
 	a.userDatasetPermsHandler = handlers.NewUserDatasetPermsHandler(db)
+	a.datasetImportHandler = handlers.NewDatasetImportHandler(db)
+	a.agreementHandler = handlers.NewAgreementHandler(db)
+
+	backend, backendErr := utils.GetDBBackend()
+	if backendErr != nil {
+		log.Fatal(backendErr)
+	}
+	a.searchHandler = handlers.NewSearchHandler(db, backend)
+	a.tagsHandler = handlers.NewTagsHandler(db)
+	a.preAnnotationHandler = handlers.NewPreAnnotationHandler(db)
+	if webhookUrls := os.Getenv("PREANNOTATION_WEBHOOK_URLS"); webhookUrls != "" {
+		for _, webhookUrl := range strings.Split(webhookUrls, ",") {
+			a.preAnnotationHandler.WebhookURLs = append(a.preAnnotationHandler.WebhookURLs, strings.TrimSpace(webhookUrl))
+		}
+	}
+	a.labelingRulesHandler = handlers.NewLabelingRulesHandler(db)
 
 	a.InitializeControllers()
 }
 
 func (a *App) InitializeControllers() {
 	cors := mux_handlers.CORS(
-		mux_handlers.AllowedHeaders([]string{"Content-Type", "sentry-trace", "baggage"}),
+		mux_handlers.AllowedHeaders([]string{"Content-Type", "Authorization", "If-Match", "sentry-trace", "baggage"}),
+		mux_handlers.ExposedHeaders([]string{"ETag"}),
 		mux_handlers.AllowedOrigins([]string{os.Getenv("ALLOWED_ORIGIN")}),
 		mux_handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PATCH", "DELETE", "OPTIONS"}),
 		mux_handlers.AllowCredentials(),
@@ -90,7 +121,7 @@ func (a *App) InitializeControllers() {
 	adminController.Init(adminRouter)
 
 	datasetsRouter := a.router.PathPrefix("/datasets").Subrouter()
-	datasetsController := controllers.NewDatasetsController(a.tokenAuth, a.datasetsHandler, a.samplesHandler, a.userDatasetPermsHandler, a.db)
+	datasetsController := controllers.NewDatasetsController(a.tokenAuth, a.datasetsHandler, a.samplesHandler, a.userDatasetPermsHandler, a.datasetImportHandler, a.agreementHandler, a.searchHandler, a.tagsHandler, a.preAnnotationHandler, a.labelingRulesHandler)
 	datasetsController.Init(datasetsRouter)
 }
 
@@ -118,6 +149,20 @@ func checkLicence(lc *licence_checker.LicenceChecker) func() {
 	}
 }
 
+func releaseExpiredLeases(samplesHandler *handlers.SamplesHandler) func() {
+	return func() {
+		released, releaseErr := samplesHandler.ReleaseExpiredLeases()
+		if releaseErr != nil {
+			log.Printf("Releasing expired sample leases failed: %v\n", releaseErr)
+			return
+		}
+
+		if released > 0 {
+			log.Printf("Released %d expired sample leases.\n", released)
+		}
+	}
+}
+
 func main() {
 	log.Println("Starting")
 
@@ -136,12 +181,14 @@ func main() {
 		log.Fatalf("Sentry initialization failed: %v\n", err)
 	}
 
+	a := App{}
+	a.Initialize()
+
 	s := gocron.NewScheduler(time.UTC)
 	s.Every(1).Day().Do(checkLicence(licenceChecker))
+	s.Every(1).Minute().Do(releaseExpiredLeases(a.samplesHandler))
 	s.StartAsync()
 
-	a := App{}
-	a.Initialize()
 	a.Run()
 	sqlDB, err := a.db.DB()
 	if err == nil {
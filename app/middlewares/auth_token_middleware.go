@@ -3,14 +3,23 @@ package middlewares
 import (
 	"backend/app/auth"
 	utils "backend/app/controllers/utils"
+	"backend/app/models"
 	"context"
 	"errors"
 	"net/http"
+	"strings"
 )
 
+// AuthTokenMiddleware authenticates the request with the auth token cookie or with an api key
+// in the Authorization header, requests made with an api key carry its scope in the context
 func AuthTokenMiddleware(tokenAuth *auth.TokenAuth) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if authorization := r.Header.Get("Authorization"); authorization != "" {
+				serveWithAPIKey(tokenAuth, authorization, next, w, r)
+				return
+			}
+
 			cookie, err := r.Cookie(auth.AuthTokenCookieName)
 			if err != nil {
 				w.WriteHeader(http.StatusUnauthorized)
@@ -30,3 +39,33 @@ func AuthTokenMiddleware(tokenAuth *auth.TokenAuth) func(http.Handler) http.Hand
 		})
 	}
 }
+
+func serveWithAPIKey(tokenAuth *auth.TokenAuth, authorization string, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	scheme, key, found := strings.Cut(authorization, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		w.WriteHeader(http.StatusUnauthorized)
+		utils.WriteError(errors.New("Unauthorized"), w)
+		return
+	}
+
+	user, apiKey, authErr := tokenAuth.CheckAPIKey(strings.TrimSpace(key))
+	if authErr != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		utils.WriteError(errors.New("Unauthorized"), w)
+		return
+	}
+
+	if apiKey.Scope == models.ReadOnlyScope && !isSafeMethod(r.Method) {
+		w.WriteHeader(http.StatusForbidden)
+		utils.WriteError(errors.New("API key is read-only"), w)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), UserContextKey, user)
+	ctx = context.WithValue(ctx, APIKeyScopeContextKey, apiKey.Scope)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
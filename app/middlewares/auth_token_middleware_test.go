@@ -35,6 +35,10 @@ func setupDBForAuthTokenMiddlewareTests(t *testing.T) (*gorm.DB, func() error) {
 		t.Fatalf("failed to migrate refresh token: %v", migrationErr)
 	}
 
+	if migrationErr := db.AutoMigrate(&models.APIKey{}); migrationErr != nil {
+		t.Fatalf("failed to migrate api key: %v", migrationErr)
+	}
+
 	sqlDB, sqlErr := db.DB()
 	if sqlErr != nil {
 		t.Fatalf("failed to obtain SQL DB: %v", sqlErr)
@@ -118,3 +122,49 @@ func TestMiddlewareWithInvalidAuthToken(t *testing.T) {
 
 	is.Equal(rr.Code, http.StatusUnauthorized)
 }
+
+func TestMiddlewareWithAPIKey(t *testing.T) {
+	db, cleanup := setupDBForAuthTokenMiddlewareTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+
+	tokenAuth := auth.NewTokenAuth(db)
+	userAuth := auth.NewUserAuth(db)
+
+	user, userErr := userAuth.CreateUser("user@email.com", "pass", models.AdminRole)
+	is.NoErr(userErr)
+	_, readOnlyKey, keyErr := tokenAuth.CreateAPIKey(user, &auth.CreateAPIKeyData{Name: "reader", Scope: models.ReadOnlyScope})
+	is.NoErr(keyErr)
+
+	middleware := AuthTokenMiddleware(tokenAuth)
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contextUser, ok := r.Context().Value(UserContextKey).(*models.User)
+		is.True(ok)
+		is.Equal(contextUser.ID, user.ID)
+		is.Equal(r.Context().Value(APIKeyScopeContextKey), models.ReadOnlyScope)
+		w.WriteHeader(http.StatusOK)
+	})
+	testHandler := middleware(nextHandler)
+
+	req := httptest.NewRequest("GET", "http://testing", nil)
+	req.Header.Set("Authorization", "Bearer "+readOnlyKey)
+	rr := httptest.NewRecorder()
+	testHandler.ServeHTTP(rr, req)
+	is.Equal(rr.Code, http.StatusOK)
+
+	// read-only keys cannot change anything
+	req = httptest.NewRequest("POST", "http://testing", nil)
+	req.Header.Set("Authorization", "Bearer "+readOnlyKey)
+	rr = httptest.NewRecorder()
+	testHandler.ServeHTTP(rr, req)
+	is.Equal(rr.Code, http.StatusForbidden)
+
+	for _, authorization := range []string{"Bearer invalid", readOnlyKey, "Basic " + readOnlyKey} {
+		req = httptest.NewRequest("GET", "http://testing", nil)
+		req.Header.Set("Authorization", authorization)
+		rr = httptest.NewRecorder()
+		testHandler.ServeHTTP(rr, req)
+		is.Equal(rr.Code, http.StatusUnauthorized)
+	}
+}
@@ -10,7 +10,8 @@ import (
 func IsAdminMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user, ok := r.Context().Value(UserContextKey).(*models.User)
-		if ok && user != nil && user.Role == models.AdminRole {
+		scope, viaAPIKey := r.Context().Value(APIKeyScopeContextKey).(models.APIKeyScope)
+		if ok && user != nil && user.Role == models.AdminRole && (!viaAPIKey || scope == models.AdminScope) {
 			next.ServeHTTP(w, r)
 		} else {
 			w.WriteHeader(http.StatusUnauthorized)
@@ -58,3 +58,23 @@ func TestIsAdminMiddlewareWithoutUser(t *testing.T) {
 
 	is.Equal(rr.Code, http.StatusUnauthorized)
 }
+
+func TestIsAdminMiddlewareWithAPIKeyScope(t *testing.T) {
+	is := is.New(t)
+	user := &models.User{Role: models.AdminRole}
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	testHandler := IsAdminMiddleware(nextHandler)
+	for scope, code := range map[models.APIKeyScope]int{models.AdminScope: http.StatusOK, models.AnnotateScope: http.StatusUnauthorized} {
+		req := httptest.NewRequest("GET", "http://testing", nil)
+		ctx := context.WithValue(req.Context(), UserContextKey, user)
+		ctx = context.WithValue(ctx, APIKeyScopeContextKey, scope)
+		rr := httptest.NewRecorder()
+		testHandler.ServeHTTP(rr, req.WithContext(ctx))
+
+		is.Equal(rr.Code, code)
+	}
+}
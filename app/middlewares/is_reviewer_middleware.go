@@ -0,0 +1,22 @@
+package middlewares
+
+import (
+	utils "backend/app/controllers/utils"
+	"backend/app/models"
+	"errors"
+	"net/http"
+)
+
+// IsReviewerMiddleware lets through reviewers and admins
+func IsReviewerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value(UserContextKey).(*models.User)
+		if ok && user != nil && user.Role.CanReview() {
+			next.ServeHTTP(w, r)
+		} else {
+			w.WriteHeader(http.StatusUnauthorized)
+			utils.WriteError(errors.New("Unauthorized"), w)
+			return
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package middlewares
+
+import (
+	"backend/app/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestIsReviewerMiddlewareWithReviewerAndAdminRoles(t *testing.T) {
+	is := is.New(t)
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, role := range []models.UserRole{models.ReviewerRole, models.AdminRole} {
+		user := &models.User{Role: role}
+		testHandler := IsReviewerMiddleware(nextHandler)
+		req := httptest.NewRequest("GET", "http://testing", nil)
+		ctx := context.WithValue(req.Context(), UserContextKey, user)
+		rr := httptest.NewRecorder()
+		testHandler.ServeHTTP(rr, req.WithContext(ctx))
+
+		is.Equal(rr.Code, http.StatusOK)
+	}
+}
+
+func TestIsReviewerMiddlewareWithAnnotatorRole(t *testing.T) {
+	is := is.New(t)
+	user := &models.User{Role: models.AnnotatorRole}
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("request should be stopped by the middleware and it should not reach here")
+	})
+
+	testHandler := IsReviewerMiddleware(nextHandler)
+	req := httptest.NewRequest("GET", "http://testing", nil)
+	ctx := context.WithValue(req.Context(), UserContextKey, user)
+	rr := httptest.NewRecorder()
+	testHandler.ServeHTTP(rr, req.WithContext(ctx))
+
+	is.Equal(rr.Code, http.StatusUnauthorized)
+}
+
+func TestIsReviewerMiddlewareWithoutUser(t *testing.T) {
+	is := is.New(t)
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("request should be stopped by the middleware and it should not reach here")
+	})
+
+	testHandler := IsReviewerMiddleware(nextHandler)
+	req := httptest.NewRequest("GET", "http://testing", nil)
+	rr := httptest.NewRecorder()
+	testHandler.ServeHTTP(rr, req)
+
+	is.Equal(rr.Code, http.StatusUnauthorized)
+}
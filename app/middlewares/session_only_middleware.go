@@ -0,0 +1,21 @@
+package middlewares
+
+import (
+	utils "backend/app/controllers/utils"
+	"backend/app/models"
+	"errors"
+	"net/http"
+)
+
+// SessionOnlyMiddleware rejects requests authenticated with an api key, so that keys cannot manage other keys
+func SessionOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, viaAPIKey := r.Context().Value(APIKeyScopeContextKey).(models.APIKeyScope); viaAPIKey {
+			w.WriteHeader(http.StatusForbidden)
+			utils.WriteError(errors.New("Not allowed with an API key"), w)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,42 @@
+package middlewares
+
+import (
+	"backend/app/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestSessionOnlyMiddlewareWithSession(t *testing.T) {
+	is := is.New(t)
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	testHandler := SessionOnlyMiddleware(nextHandler)
+	req := httptest.NewRequest("GET", "http://testing", nil)
+	rr := httptest.NewRecorder()
+	testHandler.ServeHTTP(rr, req)
+
+	is.Equal(rr.Code, http.StatusOK)
+}
+
+func TestSessionOnlyMiddlewareWithAPIKey(t *testing.T) {
+	is := is.New(t)
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("request should be stopped by the middleware and it should not reach here")
+	})
+
+	testHandler := SessionOnlyMiddleware(nextHandler)
+	req := httptest.NewRequest("GET", "http://testing", nil)
+	ctx := context.WithValue(req.Context(), APIKeyScopeContextKey, models.AdminScope)
+	rr := httptest.NewRecorder()
+	testHandler.ServeHTTP(rr, req.WithContext(ctx))
+
+	is.Equal(rr.Code, http.StatusForbidden)
+}
@@ -3,3 +3,6 @@ package middlewares
 type ContextKey string
 
 const UserContextKey ContextKey = "user"
+
+// APIKeyScopeContextKey is only set for requests authenticated with an api key
+const APIKeyScopeContextKey ContextKey = "api_key_scope"
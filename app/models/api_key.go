@@ -0,0 +1,39 @@
+package models
+
+import (
+	"errors"
+
+	"gopkg.in/guregu/null.v4"
+	"gorm.io/gorm"
+)
+
+type APIKeyScope string
+
+const (
+	// ReadOnlyScope only allows safe methods
+	ReadOnlyScope APIKeyScope = "read_only"
+	// AnnotateScope allows everything except the admin endpoints
+	AnnotateScope APIKeyScope = "annotate"
+	AdminScope    APIKeyScope = "admin"
+)
+
+func (s APIKeyScope) IsValid() error {
+	switch s {
+	case ReadOnlyScope, AnnotateScope, AdminScope:
+		return nil
+	}
+	return errors.New("invalid api key scope")
+}
+
+// APIKey is a personal key for machine clients, only the hash of the key is stored
+type APIKey struct {
+	gorm.Model
+	UserID     uint        `gorm:"not null;index" json:"user_id"`
+	User       User        `json:"-"`
+	Name       string      `gorm:"not null" json:"name"`
+	Prefix     string      `gorm:"size:16;not null" json:"prefix"`
+	KeyHash    string      `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	Scope      APIKeyScope `gorm:"not null" json:"scope"`
+	ExpiresAt  null.Time   `json:"expires_at"`
+	LastUsedAt null.Time   `json:"last_used_at"`
+}
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"errors"
+
+	"gopkg.in/guregu/null.v4"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
@@ -12,10 +15,39 @@ const (
 	RelationAnnotation DatasetType = "relation"
 )
 
+// SamplingStrategy decides which pending sample is assigned next
+type SamplingStrategy string
+
+const (
+	SequentialSampling SamplingStrategy = "sequential"
+	RandomSampling     SamplingStrategy = "random"
+	// UncertaintySampling assigns the samples with the highest score in the sampling key of their metadata first
+	UncertaintySampling SamplingStrategy = "uncertainty"
+	// StratifiedSampling takes turns between the values of the sampling key of the sample metadata
+	StratifiedSampling SamplingStrategy = "stratified"
+	PrioritySampling   SamplingStrategy = "priority"
+)
+
+func (ss SamplingStrategy) IsValid() error {
+	switch ss {
+	case SequentialSampling, RandomSampling, UncertaintySampling, StratifiedSampling, PrioritySampling:
+		return nil
+	}
+	return errors.New("invalid sampling strategy")
+}
+
+// UsesSamplingKey tells if the strategy reads the sampling key of the sample metadata
+func (ss SamplingStrategy) UsesSamplingKey() bool {
+	return ss == UncertaintySampling || ss == StratifiedSampling
+}
+
 type Dataset struct {
 	gorm.Model
-	Name     string         `gorm:"not null;" json:"name"`
-	Samples  []Sample       `json:"samples"`
-	Type     DatasetType    `gorm:"not null" json:"type"`
-	Metadata datatypes.JSON `json:"metadata"`
+	Name                 string           `gorm:"not null;" json:"name"`
+	Samples              []Sample         `json:"samples"`
+	Type                 DatasetType      `gorm:"not null" json:"type"`
+	Metadata             datatypes.JSON   `json:"metadata"`
+	AnnotationsPerSample uint             `gorm:"not null;default:1" json:"annotations_per_sample"`
+	SamplingStrategy     SamplingStrategy `gorm:"not null;default:sequential" json:"sampling_strategy"`
+	SamplingKey          null.String      `json:"sampling_key"`
 }
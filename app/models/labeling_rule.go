@@ -0,0 +1,16 @@
+package models
+
+import (
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// LabelingRule tags the occurrences of a list of terms or the matches of a regular expression in the samples of a dataset
+type LabelingRule struct {
+	gorm.Model
+	DatasetID     uint           `gorm:"not null;index" json:"dataset_id"`
+	Tag           string         `gorm:"not null" json:"tag"`
+	Terms         datatypes.JSON `json:"terms"`
+	Pattern       string         `json:"pattern"`
+	CaseSensitive bool           `gorm:"not null;default:false" json:"case_sensitive"`
+}
@@ -27,12 +27,49 @@ func (st StatusType) ToNullString() null.String {
 	return null.StringFrom(string(st))
 }
 
+type ReviewStatusType string
+
+const (
+	InReview ReviewStatusType = "in_review"
+	Approved ReviewStatusType = "approved"
+	Returned ReviewStatusType = "returned"
+)
+
+// reviewTransitions lists the review statuses a sample can move to, samples without
+// a review status are moved to review once they are completed
+var reviewTransitions = map[ReviewStatusType][]ReviewStatusType{
+	"":       {InReview},
+	InReview: {Approved, Returned},
+	Returned: {InReview},
+}
+
+func (rs ReviewStatusType) CanTransitionTo(next ReviewStatusType) bool {
+	for _, allowed := range reviewTransitions[rs] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+func (rs ReviewStatusType) ToNullString() null.String {
+	return null.StringFrom(string(rs))
+}
+
 type Sample struct {
 	gorm.Model
-	DatasetID   uint           `json:"dataset_id"`
-	Annotations datatypes.JSON `json:"annotations"`
-	Metadata    datatypes.JSON `json:"metadata"`
-	Status      null.String    `json:"status"`
-	Text        string         `json:"text"`
-	AssignedTo  null.Int       `json:"assigned_to"`
+	DatasetID       uint               `gorm:"uniqueIndex:idx_samples_external_id,priority:1" json:"dataset_id"`
+	ExternalID      null.String        `gorm:"size:191;uniqueIndex:idx_samples_external_id,priority:2" json:"external_id"`
+	Annotations     datatypes.JSON     `json:"annotations"`
+	Metadata        datatypes.JSON     `json:"metadata"`
+	Status          null.String        `json:"status"`
+	Text            string             `json:"text"`
+	ContentHash     string             `gorm:"size:64;index" json:"-"`
+	ReviewStatus    null.String        `json:"review_status"`
+	ReviewComment   null.String        `json:"review_comment"`
+	ReviewedBy      null.Int           `json:"reviewed_by"`
+	ReviewedAt      null.Time          `json:"reviewed_at"`
+	Version         uint               `gorm:"not null;default:1" json:"version"`
+	Priority        null.Float         `gorm:"index" json:"priority"`
+	UserAnnotations []SampleAnnotation `json:"user_annotations,omitempty"`
 }
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"gopkg.in/guregu/null.v4"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// SampleAnnotation holds the annotations of a single user for a sample. A sample has at most
+// Dataset.AnnotationsPerSample of them, each one takes a slot so that concurrent assignments
+// cannot exceed the limit. The version is bumped on every write to the annotation, so that annotators
+// of the same sample do not conflict with each other.
+type SampleAnnotation struct {
+	gorm.Model
+	SampleID       uint           `gorm:"not null;uniqueIndex:idx_sample_annotations_user;uniqueIndex:idx_sample_annotations_slot" json:"sample_id"`
+	UserID         uint           `gorm:"not null;uniqueIndex:idx_sample_annotations_user" json:"user_id"`
+	Slot           uint           `gorm:"not null;uniqueIndex:idx_sample_annotations_slot" json:"-"`
+	Annotations    datatypes.JSON `json:"annotations"`
+	Status         null.String    `json:"status"`
+	LeaseExpiresAt null.Time      `json:"lease_expires_at"`
+	Version        uint           `gorm:"not null;default:1" json:"version"`
+}
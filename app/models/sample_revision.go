@@ -0,0 +1,54 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gopkg.in/guregu/null.v4"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+type RevisionAction string
+
+const (
+	SampleUpdateAction     RevisionAction = "sample_update"
+	AnnotationUpdateAction RevisionAction = "annotation_update"
+	CompletionAction       RevisionAction = "completion"
+	ReviewAcceptAction     RevisionAction = "review_accept"
+	ReviewReturnAction     RevisionAction = "review_return"
+	ReviewMergeAction      RevisionAction = "review_merge"
+	RestoreAction          RevisionAction = "restore"
+	BulkUpdateAction       RevisionAction = "bulk_update"
+	ImportUpdateAction     RevisionAction = "import_update"
+	PreAnnotationAction    RevisionAction = "pre_annotation"
+	LabelingRulesAction    RevisionAction = "labeling_rules"
+)
+
+var ErrImmutableRevision = errors.New("sample revisions cannot be changed")
+
+// SampleRevision records a write to a sample or to the annotation of one of its users.
+// Revisions of user annotations hold the annotations and status of the user.
+type SampleRevision struct {
+	ID                 uint           `gorm:"primarykey" json:"id"`
+	CreatedAt          time.Time      `json:"created_at"`
+	SampleID           uint           `gorm:"not null;index" json:"sample_id"`
+	SampleAnnotationID null.Int       `json:"sample_annotation_id"`
+	UserID             uint           `json:"user_id"`
+	Action             RevisionAction `gorm:"not null" json:"action"`
+	OldAnnotations     datatypes.JSON `json:"old_annotations"`
+	NewAnnotations     datatypes.JSON `json:"new_annotations"`
+	OldMetadata        datatypes.JSON `json:"old_metadata"`
+	NewMetadata        datatypes.JSON `json:"new_metadata"`
+	OldStatus          null.String    `json:"old_status"`
+	NewStatus          null.String    `json:"new_status"`
+	RestoredFrom       null.Int       `json:"restored_from"`
+}
+
+func (r *SampleRevision) BeforeUpdate(tx *gorm.DB) error {
+	return ErrImmutableRevision
+}
+
+func (r *SampleRevision) BeforeDelete(tx *gorm.DB) error {
+	return ErrImmutableRevision
+}
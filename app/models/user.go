@@ -10,16 +10,22 @@ type UserRole string
 const (
 	AdminRole     UserRole = "admin"
 	AnnotatorRole UserRole = "annotator"
+	ReviewerRole  UserRole = "reviewer"
 )
 
 func (ur UserRole) IsValid() error {
 	switch ur {
-	case AdminRole, AnnotatorRole:
+	case AdminRole, AnnotatorRole, ReviewerRole:
 		return nil
 	}
 	return errors.New("invalid user role")
 }
 
+// CanReview tells whether the role may review samples
+func (ur UserRole) CanReview() bool {
+	return ur == ReviewerRole || ur == AdminRole
+}
+
 type User struct {
 	gorm.Model
 	Email    string    `gorm:"unique" json:"email"`
@@ -0,0 +1,377 @@
+package dataset
+
+import (
+	"sort"
+
+	"gopkg.in/guregu/null.v4"
+)
+
+// UserAnnotationData is a completed annotation of a sample by a single user
+type UserAnnotationData struct {
+	UserID      uint
+	Status      string
+	Annotations *AnnotationData
+}
+
+// SpanAgreement counts the matching spans of two annotators, F1 is null when neither annotated any span
+type SpanAgreement struct {
+	Matches int        `json:"matches"`
+	Spans1  int        `json:"spans1"`
+	Spans2  int        `json:"spans2"`
+	F1      null.Float `json:"f1"`
+}
+
+type EntityAgreement struct {
+	Exact   SpanAgreement `json:"exact"`
+	Overlap SpanAgreement `json:"overlap"`
+}
+
+type PairAgreement struct {
+	User1              uint                        `json:"user1"`
+	User2              uint                        `json:"user2"`
+	Samples            int                         `json:"samples"`
+	StatusKappa        null.Float                  `json:"status_kappa"`
+	Entities           EntityAgreement             `json:"entities"`
+	EntitiesByTag      map[string]*EntityAgreement `json:"entities_by_tag"`
+	Relationships      SpanAgreement               `json:"relationships"`
+	RelationshipsByTag map[string]*SpanAgreement   `json:"relationships_by_tag"`
+
+	statuses1 []string
+	statuses2 []string
+}
+
+type AgreementReport struct {
+	Samples           int              `json:"samples"`
+	StatusFleissKappa null.Float       `json:"status_fleiss_kappa"`
+	Pairs             []*PairAgreement `json:"pairs"`
+}
+
+func (a *SpanAgreement) add(matches int, spans1 int, spans2 int) {
+	a.Matches += matches
+	a.Spans1 += spans1
+	a.Spans2 += spans2
+}
+
+func (a *SpanAgreement) computeF1() {
+	if total := a.Spans1 + a.Spans2; total > 0 {
+		a.F1 = null.FloatFrom(2 * float64(a.Matches) / float64(total))
+	}
+}
+
+// ComputeAgreement compares the annotations of every pair of users that annotated the same samples.
+// Samples with fewer than two annotations are ignored. The per tag results cover the tags of the metadata.
+func ComputeAgreement(samples [][]UserAnnotationData, metadata *Metadata) *AgreementReport {
+	report := &AgreementReport{Pairs: []*PairAgreement{}}
+	pairs := map[[2]uint]*PairAgreement{}
+	var ratings [][]string
+
+	for _, sampleAnnotations := range samples {
+		if len(sampleAnnotations) < 2 {
+			continue
+		}
+		report.Samples++
+
+		sorted := make([]UserAnnotationData, len(sampleAnnotations))
+		copy(sorted, sampleAnnotations)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].UserID < sorted[j].UserID })
+
+		statuses := make([]string, len(sorted))
+		for i, annotation := range sorted {
+			statuses[i] = annotation.Status
+		}
+		ratings = append(ratings, statuses)
+
+		for i := 0; i < len(sorted); i++ {
+			for j := i + 1; j < len(sorted); j++ {
+				key := [2]uint{sorted[i].UserID, sorted[j].UserID}
+				pair, ok := pairs[key]
+				if !ok {
+					pair = newPairAgreement(key[0], key[1], metadata)
+					pairs[key] = pair
+					report.Pairs = append(report.Pairs, pair)
+				}
+				pair.addSample(&sorted[i], &sorted[j])
+			}
+		}
+	}
+
+	report.StatusFleissKappa = FleissKappa(ratings)
+
+	sort.Slice(report.Pairs, func(i, j int) bool {
+		if report.Pairs[i].User1 != report.Pairs[j].User1 {
+			return report.Pairs[i].User1 < report.Pairs[j].User1
+		}
+		return report.Pairs[i].User2 < report.Pairs[j].User2
+	})
+
+	for _, pair := range report.Pairs {
+		pair.finish()
+	}
+
+	return report
+}
+
+func newPairAgreement(user1 uint, user2 uint, metadata *Metadata) *PairAgreement {
+	pair := &PairAgreement{
+		User1:              user1,
+		User2:              user2,
+		EntitiesByTag:      map[string]*EntityAgreement{},
+		RelationshipsByTag: map[string]*SpanAgreement{},
+	}
+
+	if metadata != nil {
+		for _, tag := range metadata.EntityTags {
+			pair.EntitiesByTag[tag.Name] = &EntityAgreement{}
+		}
+
+		for _, tag := range metadata.RelationshipTags {
+			pair.RelationshipsByTag[tag.Name] = &SpanAgreement{}
+		}
+	}
+
+	return pair
+}
+
+func (p *PairAgreement) addSample(annotation1 *UserAnnotationData, annotation2 *UserAnnotationData) {
+	p.Samples++
+	p.statuses1 = append(p.statuses1, annotation1.Status)
+	p.statuses2 = append(p.statuses2, annotation2.Status)
+
+	entities1 := annotation1.Annotations.Entities
+	entities2 := annotation2.Annotations.Entities
+
+	exactMatches := matchEntities(entities1, entities2, false)
+	overlapMatches := matchEntities(entities1, entities2, true)
+	p.Entities.Exact.add(len(exactMatches), len(entities1), len(entities2))
+	p.Entities.Overlap.add(len(overlapMatches), len(entities1), len(entities2))
+
+	for tag, agreement := range p.EntitiesByTag {
+		spans1 := countEntitiesWithTag(entities1, tag)
+		spans2 := countEntitiesWithTag(entities2, tag)
+		agreement.Exact.add(countMatchesWithTag(entities1, exactMatches, tag), spans1, spans2)
+		agreement.Overlap.add(countMatchesWithTag(entities1, overlapMatches, tag), spans1, spans2)
+	}
+
+	relationships1 := annotation1.Annotations.Relationships
+	relationships2 := annotation2.Annotations.Relationships
+	relationshipMatches := matchRelationships(entities1, entities2, exactMatches, relationships1, relationships2)
+	p.Relationships.add(len(relationshipMatches), len(relationships1), len(relationships2))
+
+	for name, agreement := range p.RelationshipsByTag {
+		matches := 0
+		for i := range relationshipMatches {
+			if relationships1[i].Name == name {
+				matches++
+			}
+		}
+		agreement.add(matches, countRelationshipsWithName(relationships1, name), countRelationshipsWithName(relationships2, name))
+	}
+}
+
+func (p *PairAgreement) finish() {
+	p.StatusKappa = CohensKappa(p.statuses1, p.statuses2)
+	p.Entities.Exact.computeF1()
+	p.Entities.Overlap.computeF1()
+	p.Relationships.computeF1()
+
+	for _, agreement := range p.EntitiesByTag {
+		agreement.Exact.computeF1()
+		agreement.Overlap.computeF1()
+	}
+
+	for _, agreement := range p.RelationshipsByTag {
+		agreement.computeF1()
+	}
+}
+
+// matchEntities pairs the entities of two annotators one to one and returns the matched indexes.
+// Exact matching requires the same span and tag, overlap matching the same tag and overlapping spans,
+// in which case every entity is paired with the one it overlaps the most.
+func matchEntities(entities1 []Entity, entities2 []Entity, overlap bool) map[int]int {
+	matches := map[int]int{}
+	matched := make([]bool, len(entities2))
+
+	for i, entity1 := range entities1 {
+		best, bestOverlap := -1, uint(0)
+		for j, entity2 := range entities2 {
+			if matched[j] || entity1.Tag != entity2.Tag {
+				continue
+			}
+
+			if !overlap {
+				if entity1.Start == entity2.Start && entity1.End == entity2.End {
+					best = j
+					break
+				}
+				continue
+			}
+
+			if spanOverlap := overlapLength(entity1, entity2); spanOverlap > bestOverlap {
+				best, bestOverlap = j, spanOverlap
+			}
+		}
+
+		if best != -1 {
+			matches[i] = best
+			matched[best] = true
+		}
+	}
+
+	return matches
+}
+
+func overlapLength(entity1 Entity, entity2 Entity) uint {
+	start, end := entity1.Start, entity1.End
+	if entity2.Start > start {
+		start = entity2.Start
+	}
+	if entity2.End < end {
+		end = entity2.End
+	}
+
+	if end <= start {
+		return 0
+	}
+	return end - start
+}
+
+// matchRelationships pairs relationships with the same name between exactly matched entities
+func matchRelationships(entities1 []Entity, entities2 []Entity, entityMatches map[int]int, relationships1 []Relationship, relationships2 []Relationship) map[int]int {
+	entityIds := map[uint]uint{}
+	for i, j := range entityMatches {
+		entityIds[entities1[i].Id] = entities2[j].Id
+	}
+
+	matches := map[int]int{}
+	matched := make([]bool, len(relationships2))
+	for i, relationship1 := range relationships1 {
+		entity1, ok1 := entityIds[relationship1.Entity1]
+		entity2, ok2 := entityIds[relationship1.Entity2]
+		if !ok1 || !ok2 {
+			continue
+		}
+
+		for j, relationship2 := range relationships2 {
+			if !matched[j] && relationship2.Name == relationship1.Name && relationship2.Entity1 == entity1 && relationship2.Entity2 == entity2 {
+				matches[i] = j
+				matched[j] = true
+				break
+			}
+		}
+	}
+
+	return matches
+}
+
+func countEntitiesWithTag(entities []Entity, tag string) int {
+	count := 0
+	for _, entity := range entities {
+		if entity.Tag.Valid && entity.Tag.String == tag {
+			count++
+		}
+	}
+
+	return count
+}
+
+func countMatchesWithTag(entities1 []Entity, matches map[int]int, tag string) int {
+	count := 0
+	for i := range matches {
+		if entities1[i].Tag.Valid && entities1[i].Tag.String == tag {
+			count++
+		}
+	}
+
+	return count
+}
+
+func countRelationshipsWithName(relationships []Relationship, name string) int {
+	count := 0
+	for _, relationship := range relationships {
+		if relationship.Name == name {
+			count++
+		}
+	}
+
+	return count
+}
+
+// CohensKappa measures the agreement of two raters that labeled the same items,
+// it is null when there are no items or the agreement by chance is perfect
+func CohensKappa(labels1 []string, labels2 []string) null.Float {
+	n := len(labels1)
+	if n == 0 || n != len(labels2) {
+		return null.Float{}
+	}
+
+	agreed := 0
+	counts1 := map[string]int{}
+	counts2 := map[string]int{}
+	for i := range labels1 {
+		if labels1[i] == labels2[i] {
+			agreed++
+		}
+		counts1[labels1[i]]++
+		counts2[labels2[i]]++
+	}
+
+	observed := float64(agreed) / float64(n)
+	expected := 0.0
+	for label, count := range counts1 {
+		expected += float64(count) * float64(counts2[label]) / float64(n*n)
+	}
+
+	if expected == 1 {
+		return null.Float{}
+	}
+
+	return null.FloatFrom((observed - expected) / (1 - expected))
+}
+
+// FleissKappa measures the agreement of any number of raters, every item holds the labels it was given.
+// Items with fewer than two labels are ignored, the number of raters may differ between items.
+func FleissKappa(ratings [][]string) null.Float {
+	categoryTotals := map[string]int{}
+	totalRatings := 0
+	items := 0
+	agreementSum := 0.0
+
+	for _, labels := range ratings {
+		n := len(labels)
+		if n < 2 {
+			continue
+		}
+
+		counts := map[string]int{}
+		for _, label := range labels {
+			counts[label]++
+			categoryTotals[label]++
+		}
+
+		agreeingPairs := 0
+		for _, count := range counts {
+			agreeingPairs += count * (count - 1)
+		}
+
+		agreementSum += float64(agreeingPairs) / float64(n*(n-1))
+		totalRatings += n
+		items++
+	}
+
+	if items == 0 {
+		return null.Float{}
+	}
+
+	observed := agreementSum / float64(items)
+	expected := 0.0
+	for _, total := range categoryTotals {
+		proportion := float64(total) / float64(totalRatings)
+		expected += proportion * proportion
+	}
+
+	if expected == 1 {
+		return null.Float{}
+	}
+
+	return null.FloatFrom((observed - expected) / (1 - expected))
+}
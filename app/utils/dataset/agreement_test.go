@@ -0,0 +1,85 @@
+package dataset
+
+import (
+	"math"
+	"testing"
+
+	"github.com/matryer/is"
+	"gopkg.in/guregu/null.v4"
+)
+
+func roughlyEqual(value null.Float, expected float64) bool {
+	return value.Valid && math.Abs(value.Float64-expected) < 1e-9
+}
+
+func TestCohensKappa(t *testing.T) {
+	is := is.New(t)
+
+	is.True(roughlyEqual(CohensKappa([]string{"a", "a", "b", "b"}, []string{"a", "b", "b", "b"}), 0.5))
+	is.True(roughlyEqual(CohensKappa([]string{"a", "b"}, []string{"a", "b"}), 1))
+	is.True(!CohensKappa([]string{"a", "a"}, []string{"a", "a"}).Valid)
+	is.True(!CohensKappa(nil, nil).Valid)
+}
+
+func TestFleissKappa(t *testing.T) {
+	is := is.New(t)
+
+	ratings := [][]string{{"a", "a", "a"}, {"a", "a", "b"}, {"b", "b", "b"}, {"a"}}
+	is.True(roughlyEqual(FleissKappa(ratings), 0.55))
+	is.True(!FleissKappa([][]string{{"a"}}).Valid)
+}
+
+func TestComputeAgreement(t *testing.T) {
+	is := is.New(t)
+
+	metadata := &Metadata{
+		EntityTags:       []Tag{{Name: "PER"}, {Name: "ORG"}},
+		RelationshipTags: []Tag{{Name: "works for"}},
+	}
+
+	samples := [][]UserAnnotationData{
+		{
+			{UserID: 2, Status: "accepted", Annotations: &AnnotationData{
+				Entities: []Entity{
+					{Id: 1, Start: 0, End: 4, Tag: null.StringFrom("PER")},
+					{Id: 2, Start: 11, End: 15, Tag: null.StringFrom("ORG")},
+					{Id: 3, Start: 20, End: 25, Tag: null.StringFrom("PER")},
+				},
+				Relationships: []Relationship{{Id: 1, Entity1: 1, Entity2: 2, Name: "works for"}},
+			}},
+			{UserID: 1, Status: "accepted", Annotations: &AnnotationData{
+				Entities: []Entity{
+					{Id: 1, Start: 0, End: 4, Tag: null.StringFrom("PER")},
+					{Id: 2, Start: 10, End: 15, Tag: null.StringFrom("ORG")},
+				},
+				Relationships: []Relationship{{Id: 1, Entity1: 1, Entity2: 2, Name: "works for"}},
+			}},
+		},
+		{
+			{UserID: 1, Status: "rejected", Annotations: &AnnotationData{}},
+		},
+	}
+
+	report := ComputeAgreement(samples, metadata)
+	is.Equal(report.Samples, 1)
+	is.Equal(len(report.Pairs), 1)
+
+	pair := report.Pairs[0]
+	is.Equal(pair.User1, uint(1))
+	is.Equal(pair.User2, uint(2))
+	is.Equal(pair.Samples, 1)
+	is.True(!pair.StatusKappa.Valid)
+
+	is.Equal(pair.Entities.Exact.Matches, 1)
+	is.True(roughlyEqual(pair.Entities.Exact.F1, 0.4))
+	is.Equal(pair.Entities.Overlap.Matches, 2)
+	is.True(roughlyEqual(pair.Entities.Overlap.F1, 0.8))
+
+	is.True(roughlyEqual(pair.EntitiesByTag["PER"].Exact.F1, 2.0/3.0))
+	is.True(roughlyEqual(pair.EntitiesByTag["ORG"].Exact.F1, 0))
+	is.True(roughlyEqual(pair.EntitiesByTag["ORG"].Overlap.F1, 1))
+
+	// the relationship connects entities that do not match exactly
+	is.Equal(pair.Relationships.Matches, 0)
+	is.True(roughlyEqual(pair.RelationshipsByTag["works for"].F1, 0))
+}
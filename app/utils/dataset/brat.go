@@ -0,0 +1,310 @@
+package dataset
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/guregu/null.v4"
+)
+
+const BratConfigFileName = "annotation.conf"
+
+// bratType replaces the characters that brat does not allow in type names
+func bratType(name string) string {
+	return strings.Join(strings.Fields(name), "_")
+}
+
+func bratText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// FormatBratAnnotations writes the annotations in the brat standoff format, entities become
+// T lines, relationships R lines and entity notes AnnotatorNotes
+func FormatBratAnnotations(text string, annotations *AnnotationData) string {
+	var builder strings.Builder
+	runes := []rune(text)
+	textLength := uint(len(runes))
+
+	exportedEntities := map[uint]bool{}
+	for _, entity := range annotations.Entities {
+		if !entity.Tag.Valid || entity.Start >= entity.End || entity.End > textLength {
+			continue
+		}
+
+		exportedEntities[entity.Id] = true
+		fmt.Fprintf(&builder, "T%d\t%s %d %d\t%s\n", entity.Id, bratType(entity.Tag.String), entity.Start, entity.End, bratText(string(runes[entity.Start:entity.End])))
+	}
+
+	for _, relationship := range annotations.Relationships {
+		if !exportedEntities[relationship.Entity1] || !exportedEntities[relationship.Entity2] {
+			continue
+		}
+
+		fmt.Fprintf(&builder, "R%d\t%s Arg1:T%d Arg2:T%d\n", relationship.Id, bratType(relationship.Name), relationship.Entity1, relationship.Entity2)
+	}
+
+	noteId := 1
+	for _, entity := range annotations.Entities {
+		if exportedEntities[entity.Id] && entity.Notes.Valid && entity.Notes.String != "" {
+			fmt.Fprintf(&builder, "#%d\tAnnotatorNotes T%d\t%s\n", noteId, entity.Id, bratText(entity.Notes.String))
+			noteId++
+		}
+	}
+
+	return builder.String()
+}
+
+// ParseBratAnnotations reads T, R and AnnotatorNotes lines of a brat .ann file, other annotations are ignored.
+// Brat ids are translated to sequential entity and relationship ids. Discontinuous spans are
+// imported as a single span from the start of the first fragment to the end of the last one.
+func ParseBratAnnotations(ann string) (*AnnotationData, error) {
+	annotations := &AnnotationData{Entities: []Entity{}, Relationships: []Relationship{}}
+	entityIds := map[string]uint{}
+
+	type bratRelation struct {
+		name string
+		arg1 string
+		arg2 string
+	}
+	var relations []bratRelation
+	notes := map[string]string{}
+
+	scanner := bufio.NewScanner(strings.NewReader(ann))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: missing annotation", lineNumber)
+		}
+
+		id := fields[0]
+		switch {
+		case strings.HasPrefix(id, "T"):
+			entity, entityErr := parseBratEntity(fields[1])
+			if entityErr != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNumber, entityErr)
+			}
+
+			entity.Id = uint(len(annotations.Entities) + 1)
+			entityIds[id] = entity.Id
+			annotations.Entities = append(annotations.Entities, *entity)
+		case strings.HasPrefix(id, "R"):
+			parts := strings.Fields(fields[1])
+			if len(parts) != 3 {
+				return nil, fmt.Errorf("line %d: invalid relation %q", lineNumber, fields[1])
+			}
+
+			relation := bratRelation{name: parts[0]}
+			for _, arg := range parts[1:] {
+				argParts := strings.SplitN(arg, ":", 2)
+				if len(argParts) != 2 {
+					return nil, fmt.Errorf("line %d: invalid relation argument %q", lineNumber, arg)
+				}
+
+				if argParts[0] == "Arg1" {
+					relation.arg1 = argParts[1]
+				} else {
+					relation.arg2 = argParts[1]
+				}
+			}
+			relations = append(relations, relation)
+		case strings.HasPrefix(id, "#"):
+			parts := strings.Fields(fields[1])
+			if len(parts) == 2 && parts[0] == "AnnotatorNotes" && len(fields) > 2 {
+				notes[parts[1]] = fields[2]
+			}
+		}
+	}
+
+	if scanErr := scanner.Err(); scanErr != nil {
+		return nil, scanErr
+	}
+
+	for _, relation := range relations {
+		entity1, ok1 := entityIds[relation.arg1]
+		entity2, ok2 := entityIds[relation.arg2]
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("relation %s refers to an unknown entity", relation.name)
+		}
+
+		annotations.Relationships = append(annotations.Relationships, Relationship{
+			Id:      uint(len(annotations.Relationships) + 1),
+			Entity1: entity1,
+			Entity2: entity2,
+			Name:    relation.name,
+		})
+	}
+
+	for bratId, note := range notes {
+		if entityId, ok := entityIds[bratId]; ok {
+			annotations.Entities[entityId-1].Notes = null.StringFrom(note)
+		}
+	}
+
+	return annotations, nil
+}
+
+func parseBratEntity(value string) (*Entity, error) {
+	typeAndSpans := strings.SplitN(value, " ", 2)
+	if len(typeAndSpans) != 2 {
+		return nil, fmt.Errorf("invalid entity %q", value)
+	}
+
+	entity := &Entity{Tag: null.StringFrom(typeAndSpans[0])}
+	fragments := strings.Split(typeAndSpans[1], ";")
+	for i, fragment := range fragments {
+		offsets := strings.Fields(fragment)
+		if len(offsets) != 2 {
+			return nil, fmt.Errorf("invalid entity span %q", fragment)
+		}
+
+		start, startErr := strconv.ParseUint(offsets[0], 10, 64)
+		if startErr != nil {
+			return nil, startErr
+		}
+
+		end, endErr := strconv.ParseUint(offsets[1], 10, 64)
+		if endErr != nil {
+			return nil, endErr
+		}
+
+		if i == 0 {
+			entity.Start = uint(start)
+		}
+		entity.End = uint(end)
+	}
+
+	return entity, nil
+}
+
+func FormatBratConfig(metadata *Metadata) string {
+	var builder strings.Builder
+	builder.WriteString("[entities]\n")
+	for _, tag := range metadata.EntityTags {
+		builder.WriteString(bratType(tag.Name) + "\n")
+	}
+
+	builder.WriteString("[relations]\n")
+	for _, tag := range metadata.RelationshipTags {
+		fmt.Fprintf(&builder, "%s\tArg1:%s, Arg2:%s", bratType(tag.Name), bratArgTypes(tag.Sources), bratArgTypes(tag.Targets))
+		if tag.HasConstraints() && !tag.Directed {
+			builder.WriteString(", <REL-TYPE>:symmetric")
+		}
+		builder.WriteString("\n")
+	}
+
+	builder.WriteString("[events]\n[attributes]\n")
+	return builder.String()
+}
+
+func bratArgTypes(tags []string) string {
+	if len(tags) == 0 {
+		return "<ENTITY>"
+	}
+
+	types := make([]string, len(tags))
+	for i, tag := range tags {
+		types[i] = bratType(tag)
+	}
+	return strings.Join(types, "|")
+}
+
+// ParseBratConfig reads the entity and relation types from a brat annotation.conf.
+// The argument types of the relations become the allowed sources and targets of the relationship tags.
+func ParseBratConfig(conf string) *Metadata {
+	metadata := &Metadata{EntityTags: []Tag{}, RelationshipTags: []Tag{}}
+	section := ""
+	for _, line := range strings.Split(conf, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.Trim(line, "[]")
+			continue
+		}
+
+		name := strings.TrimLeft(strings.Fields(line)[0], "!-")
+		switch section {
+		case "entities":
+			metadata.EntityTags = append(metadata.EntityTags, Tag{Name: name})
+		case "relations":
+			if strings.HasPrefix(name, "<") {
+				continue
+			}
+
+			tag := findTag(metadata.RelationshipTags, name)
+			if tag == nil {
+				metadata.RelationshipTags = append(metadata.RelationshipTags, Tag{Name: name})
+				tag = &metadata.RelationshipTags[len(metadata.RelationshipTags)-1]
+			}
+			parseBratRelationArgs(tag, strings.TrimSpace(strings.TrimPrefix(line, strings.Fields(line)[0])))
+		}
+	}
+
+	return metadata
+}
+
+// SortedBratDocumentNames returns the names of the documents that have a .txt file
+func SortedBratDocumentNames(fileNames []string) []string {
+	var documents []string
+	for _, fileName := range fileNames {
+		if strings.HasSuffix(fileName, ".txt") {
+			documents = append(documents, strings.TrimSuffix(fileName, ".txt"))
+		}
+	}
+	sort.Strings(documents)
+
+	return documents
+}
+
+// parseBratRelationArgs adds the argument types of a relation definition such as "Arg1:PER|ORG, Arg2:LOC"
+func parseBratRelationArgs(tag *Tag, args string) {
+	symmetric := false
+	for _, arg := range strings.Split(args, ",") {
+		parts := strings.SplitN(strings.TrimSpace(arg), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		var allowed *[]string
+		switch parts[0] {
+		case "Arg1":
+			allowed = &tag.Sources
+		case "Arg2":
+			allowed = &tag.Targets
+		case "<REL-TYPE>":
+			symmetric = strings.HasPrefix(parts[1], "symmetric")
+			continue
+		default:
+			continue
+		}
+
+		for _, argType := range strings.Split(parts[1], "|") {
+			if argType = strings.TrimSpace(argType); argType != "" && !strings.HasPrefix(argType, "<") && !containsString(*allowed, argType) {
+				*allowed = append(*allowed, argType)
+			}
+		}
+	}
+
+	tag.Directed = tag.HasConstraints() && !symmetric
+}
+
+func containsString(values []string, value string) bool {
+	for _, other := range values {
+		if other == value {
+			return true
+		}
+	}
+
+	return false
+}
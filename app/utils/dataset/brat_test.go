@@ -0,0 +1,80 @@
+package dataset
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestBratRoundTrip(t *testing.T) {
+	is := is.New(t)
+
+	text := "John works for Acme"
+	annotations := &AnnotationData{
+		Entities: []Entity{
+			{Id: 7, Start: 0, End: 4, Tag: null.StringFrom("PER"), Notes: null.StringFrom("the boss")},
+			{Id: 3, Start: 15, End: 19, Tag: null.StringFrom("ORG")},
+		},
+		Relationships: []Relationship{
+			{Id: 5, Entity1: 7, Entity2: 3, Name: "works for"},
+		},
+	}
+
+	ann := FormatBratAnnotations(text, annotations)
+	is.Equal(ann, "T7\tPER 0 4\tJohn\nT3\tORG 15 19\tAcme\nR5\tworks_for Arg1:T7 Arg2:T3\n#1\tAnnotatorNotes T7\tthe boss\n")
+
+	parsed, parsingErr := ParseBratAnnotations(ann)
+	is.NoErr(parsingErr)
+	is.Equal(len(parsed.Entities), 2)
+	is.Equal(parsed.Entities[0].Id, uint(1))
+	is.Equal(parsed.Entities[0].Notes.String, "the boss")
+	is.Equal(parsed.Entities[1].Id, uint(2))
+	is.Equal(parsed.Entities[1].Start, uint(15))
+	is.Equal(len(parsed.Relationships), 1)
+	is.Equal(parsed.Relationships[0].Entity1, uint(1))
+	is.Equal(parsed.Relationships[0].Entity2, uint(2))
+	is.Equal(parsed.Relationships[0].Name, "works_for")
+}
+
+func TestParseBratAnnotationsWithUnknownEntity(t *testing.T) {
+	is := is.New(t)
+
+	_, parsingErr := ParseBratAnnotations("T1\tPER 0 4\tJohn\nR1\tknows Arg1:T1 Arg2:T2\n")
+	is.True(parsingErr != nil)
+}
+
+func TestParseBratConfig(t *testing.T) {
+	is := is.New(t)
+
+	metadata := ParseBratConfig("[entities]\nPER\nORG\n[relations]\nworks_for\tArg1:PER, Arg2:ORG\n<OVERLAP>\tArg1:<ENTITY>, Arg2:<ENTITY>, <OVL-TYPE>:<ANY>\n[events]\n[attributes]\n")
+	is.Equal(len(metadata.EntityTags), 2)
+	is.Equal(len(metadata.RelationshipTags), 1)
+	is.Equal(metadata.RelationshipTags[0].Name, "works_for")
+	is.Equal(metadata.RelationshipTags[0].Sources, []string{"PER"})
+	is.Equal(metadata.RelationshipTags[0].Targets, []string{"ORG"})
+	is.True(metadata.RelationshipTags[0].Directed)
+}
+
+func TestBratConfigRoundTrip(t *testing.T) {
+	is := is.New(t)
+
+	metadata := &Metadata{
+		EntityTags: []Tag{{Name: "PER"}, {Name: "ORG"}, {Name: "GPE"}},
+		RelationshipTags: []Tag{
+			{Name: "works for", Sources: []string{"PER"}, Targets: []string{"ORG", "GPE"}, Directed: true},
+			{Name: "allied", Sources: []string{"ORG"}, Targets: []string{"ORG"}},
+			{Name: "knows"},
+		},
+	}
+
+	conf := FormatBratConfig(metadata)
+	is.Equal(conf, "[entities]\nPER\nORG\nGPE\n[relations]\nworks_for\tArg1:PER, Arg2:ORG|GPE\nallied\tArg1:ORG, Arg2:ORG, <REL-TYPE>:symmetric\nknows\tArg1:<ENTITY>, Arg2:<ENTITY>\n[events]\n[attributes]\n")
+
+	parsed := ParseBratConfig(conf)
+	is.Equal(parsed.RelationshipTags, []Tag{
+		{Name: "works_for", Sources: []string{"PER"}, Targets: []string{"ORG", "GPE"}, Directed: true},
+		{Name: "allied", Sources: []string{"ORG"}, Targets: []string{"ORG"}},
+		{Name: "knows"},
+	})
+}
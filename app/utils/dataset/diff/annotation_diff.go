@@ -0,0 +1,169 @@
+package dataset_diff
+
+import (
+	dataset_utils "backend/app/utils/dataset"
+)
+
+type EntityChange struct {
+	Old dataset_utils.Entity `json:"old"`
+	New dataset_utils.Entity `json:"new"`
+}
+
+type RelationshipChange struct {
+	Old dataset_utils.Relationship `json:"old"`
+	New dataset_utils.Relationship `json:"new"`
+}
+
+// AnnotationDiff lists the changes between two annotations. An entity whose boundaries moved
+// and whose tag changed is listed both as moved and as retagged.
+type AnnotationDiff struct {
+	EntitiesAdded        []dataset_utils.Entity       `json:"entities_added"`
+	EntitiesRemoved      []dataset_utils.Entity       `json:"entities_removed"`
+	EntitiesRetagged     []EntityChange               `json:"entities_retagged"`
+	EntitiesMoved        []EntityChange               `json:"entities_moved"`
+	RelationshipsAdded   []dataset_utils.Relationship `json:"relationships_added"`
+	RelationshipsRemoved []dataset_utils.Relationship `json:"relationships_removed"`
+	RelationshipsRenamed []RelationshipChange         `json:"relationships_renamed"`
+}
+
+func (d *AnnotationDiff) IsEmpty() bool {
+	return len(d.EntitiesAdded) == 0 && len(d.EntitiesRemoved) == 0 && len(d.EntitiesRetagged) == 0 &&
+		len(d.EntitiesMoved) == 0 && len(d.RelationshipsAdded) == 0 && len(d.RelationshipsRemoved) == 0 &&
+		len(d.RelationshipsRenamed) == 0
+}
+
+// entityMatcher decides whether an old and an updated entity are the same one
+type entityMatcher func(old dataset_utils.Entity, updated dataset_utils.Entity) bool
+
+// entityMatchers are tried in order, so that an entity is paired with its closest counterpart.
+// Entities are matched by their spans and tags rather than by ids, which differ between annotators.
+var entityMatchers = []entityMatcher{
+	func(old dataset_utils.Entity, updated dataset_utils.Entity) bool {
+		return sameSpan(old, updated) && old.Tag == updated.Tag
+	},
+	sameSpan,
+	func(old dataset_utils.Entity, updated dataset_utils.Entity) bool {
+		return overlaps(old, updated) && old.Tag == updated.Tag
+	},
+	overlaps,
+}
+
+func sameSpan(old dataset_utils.Entity, updated dataset_utils.Entity) bool {
+	return old.Start == updated.Start && old.End == updated.End
+}
+
+func overlaps(old dataset_utils.Entity, updated dataset_utils.Entity) bool {
+	return old.Start < updated.End && updated.Start < old.End
+}
+
+// DiffAnnotations compares the old and the updated annotations
+func DiffAnnotations(old *dataset_utils.AnnotationData, updated *dataset_utils.AnnotationData) *AnnotationDiff {
+	diff := &AnnotationDiff{
+		EntitiesAdded:        []dataset_utils.Entity{},
+		EntitiesRemoved:      []dataset_utils.Entity{},
+		EntitiesRetagged:     []EntityChange{},
+		EntitiesMoved:        []EntityChange{},
+		RelationshipsAdded:   []dataset_utils.Relationship{},
+		RelationshipsRemoved: []dataset_utils.Relationship{},
+		RelationshipsRenamed: []RelationshipChange{},
+	}
+
+	// the index of the matching updated entity for every old entity
+	matches := make([]int, len(old.Entities))
+	for i := range matches {
+		matches[i] = -1
+	}
+	matchedNew := make([]bool, len(updated.Entities))
+
+	for _, matcher := range entityMatchers {
+		for i, oldEntity := range old.Entities {
+			if matches[i] != -1 {
+				continue
+			}
+
+			for j, newEntity := range updated.Entities {
+				if !matchedNew[j] && matcher(oldEntity, newEntity) {
+					matches[i] = j
+					matchedNew[j] = true
+					break
+				}
+			}
+		}
+	}
+
+	entityIds := map[uint]uint{}
+	for i, oldEntity := range old.Entities {
+		if matches[i] == -1 {
+			diff.EntitiesRemoved = append(diff.EntitiesRemoved, oldEntity)
+			continue
+		}
+
+		newEntity := updated.Entities[matches[i]]
+		entityIds[oldEntity.Id] = newEntity.Id
+		if oldEntity.Tag != newEntity.Tag {
+			diff.EntitiesRetagged = append(diff.EntitiesRetagged, EntityChange{Old: oldEntity, New: newEntity})
+		}
+		if !sameSpan(oldEntity, newEntity) {
+			diff.EntitiesMoved = append(diff.EntitiesMoved, EntityChange{Old: oldEntity, New: newEntity})
+		}
+	}
+
+	for j, newEntity := range updated.Entities {
+		if !matchedNew[j] {
+			diff.EntitiesAdded = append(diff.EntitiesAdded, newEntity)
+		}
+	}
+
+	diffRelationships(diff, old.Relationships, updated.Relationships, entityIds)
+	return diff
+}
+
+// diffRelationships pairs the relationships that connect the same matched entities,
+// relationships between the same entities with a different name are renamed
+func diffRelationships(diff *AnnotationDiff, old []dataset_utils.Relationship, updated []dataset_utils.Relationship, entityIds map[uint]uint) {
+	matchedNew := make([]bool, len(updated))
+	var unmatchedOld []dataset_utils.Relationship
+
+	connects := func(oldRelationship dataset_utils.Relationship, newRelationship dataset_utils.Relationship) bool {
+		entity1, ok1 := entityIds[oldRelationship.Entity1]
+		entity2, ok2 := entityIds[oldRelationship.Entity2]
+		return ok1 && ok2 && newRelationship.Entity1 == entity1 && newRelationship.Entity2 == entity2
+	}
+
+	for _, oldRelationship := range old {
+		matched := false
+		for j, newRelationship := range updated {
+			if !matchedNew[j] && connects(oldRelationship, newRelationship) && oldRelationship.Name == newRelationship.Name {
+				matchedNew[j] = true
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			unmatchedOld = append(unmatchedOld, oldRelationship)
+		}
+	}
+
+	for _, oldRelationship := range unmatchedOld {
+		renamed := false
+		for j, newRelationship := range updated {
+			if !matchedNew[j] && connects(oldRelationship, newRelationship) {
+				matchedNew[j] = true
+				renamed = true
+				diff.RelationshipsRenamed = append(diff.RelationshipsRenamed, RelationshipChange{Old: oldRelationship, New: newRelationship})
+				break
+			}
+		}
+
+		if !renamed {
+			diff.RelationshipsRemoved = append(diff.RelationshipsRemoved, oldRelationship)
+		}
+	}
+
+	for j, newRelationship := range updated {
+		if !matchedNew[j] {
+			diff.RelationshipsAdded = append(diff.RelationshipsAdded, newRelationship)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package dataset_diff
+
+import (
+	dataset_utils "backend/app/utils/dataset"
+	"testing"
+
+	"github.com/matryer/is"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestDiffAnnotations(t *testing.T) {
+	is := is.New(t)
+
+	old := &dataset_utils.AnnotationData{
+		Entities: []dataset_utils.Entity{
+			{Id: 1, Start: 0, End: 4, Tag: null.StringFrom("PER")},
+			{Id: 2, Start: 11, End: 15, Tag: null.StringFrom("PER")},
+			{Id: 3, Start: 20, End: 26, Tag: null.StringFrom("ORG")},
+			{Id: 4, Start: 30, End: 35, Tag: null.StringFrom("LOC")},
+		},
+		Relationships: []dataset_utils.Relationship{
+			{Id: 1, Entity1: 1, Entity2: 2, Name: "knows"},
+			{Id: 2, Entity1: 1, Entity2: 3, Name: "works for"},
+			{Id: 3, Entity1: 2, Entity2: 4, Name: "lives in"},
+		},
+	}
+
+	// the ids differ, as they would between two annotators
+	updated := &dataset_utils.AnnotationData{
+		Entities: []dataset_utils.Entity{
+			{Id: 7, Start: 0, End: 4, Tag: null.StringFrom("PER")},
+			{Id: 8, Start: 11, End: 15, Tag: null.StringFrom("ORG")},
+			{Id: 9, Start: 19, End: 26, Tag: null.StringFrom("ORG")},
+			{Id: 10, Start: 40, End: 45, Tag: null.StringFrom("LOC")},
+		},
+		Relationships: []dataset_utils.Relationship{
+			{Id: 4, Entity1: 7, Entity2: 8, Name: "hates"},
+			{Id: 5, Entity1: 7, Entity2: 9, Name: "works for"},
+			{Id: 6, Entity1: 9, Entity2: 10, Name: "located in"},
+		},
+	}
+
+	diff := DiffAnnotations(old, updated)
+	is.True(!diff.IsEmpty())
+
+	is.Equal(len(diff.EntitiesRetagged), 1)
+	is.Equal(diff.EntitiesRetagged[0].Old.Id, uint(2))
+	is.Equal(diff.EntitiesRetagged[0].New.Id, uint(8))
+
+	is.Equal(len(diff.EntitiesMoved), 1)
+	is.Equal(diff.EntitiesMoved[0].Old.Id, uint(3))
+	is.Equal(diff.EntitiesMoved[0].New.Start, uint(19))
+
+	is.Equal(len(diff.EntitiesRemoved), 1)
+	is.Equal(diff.EntitiesRemoved[0].Id, uint(4))
+	is.Equal(len(diff.EntitiesAdded), 1)
+	is.Equal(diff.EntitiesAdded[0].Id, uint(10))
+
+	is.Equal(len(diff.RelationshipsRenamed), 1)
+	is.Equal(diff.RelationshipsRenamed[0].Old.Name, "knows")
+	is.Equal(diff.RelationshipsRenamed[0].New.Name, "hates")
+
+	is.Equal(len(diff.RelationshipsRemoved), 1)
+	is.Equal(diff.RelationshipsRemoved[0].Name, "lives in")
+	is.Equal(len(diff.RelationshipsAdded), 1)
+	is.Equal(diff.RelationshipsAdded[0].Name, "located in")
+}
+
+func TestDiffOfEqualAnnotations(t *testing.T) {
+	is := is.New(t)
+
+	annotations := &dataset_utils.AnnotationData{
+		Entities: []dataset_utils.Entity{
+			{Id: 1, Start: 0, End: 4, Tag: null.StringFrom("PER")},
+			{Id: 2, Start: 11, End: 15, Tag: null.StringFrom("PER")},
+		},
+		Relationships: []dataset_utils.Relationship{{Id: 1, Entity1: 1, Entity2: 2, Name: "knows"}},
+	}
+
+	is.True(DiffAnnotations(annotations, annotations).IsEmpty())
+	is.True(DiffAnnotations(&dataset_utils.AnnotationData{}, &dataset_utils.AnnotationData{}).IsEmpty())
+}
@@ -0,0 +1,50 @@
+package dataset_export
+
+import (
+	"archive/zip"
+	"backend/app/models"
+	dataset_utils "backend/app/utils/dataset"
+	"fmt"
+	"io"
+)
+
+// ExportDatasetBrat writes a zip archive with a .txt and .ann file for every sample and the annotation.conf
+func ExportDatasetBrat(w io.Writer, dataset *models.Dataset, samples []*models.Sample) error {
+	metadata, metadataErr := dataset_utils.ParseMetadata(dataset.Metadata)
+	if metadataErr != nil {
+		return metadataErr
+	}
+
+	archive := zip.NewWriter(w)
+	if writeErr := writeZipFile(archive, dataset_utils.BratConfigFileName, dataset_utils.FormatBratConfig(metadata)); writeErr != nil {
+		return writeErr
+	}
+
+	for _, sample := range samples {
+		annotations, annotationsErr := dataset_utils.ParseAnnotations(sample.Annotations)
+		if annotationsErr != nil {
+			return annotationsErr
+		}
+
+		documentName := fmt.Sprintf("sample_%d", sample.ID)
+		if writeErr := writeZipFile(archive, documentName+".txt", sample.Text); writeErr != nil {
+			return writeErr
+		}
+
+		if writeErr := writeZipFile(archive, documentName+".ann", dataset_utils.FormatBratAnnotations(sample.Text, annotations)); writeErr != nil {
+			return writeErr
+		}
+	}
+
+	return archive.Close()
+}
+
+func writeZipFile(archive *zip.Writer, name string, content string) error {
+	fileWriter, createErr := archive.Create(name)
+	if createErr != nil {
+		return createErr
+	}
+
+	_, writeErr := io.WriteString(fileWriter, content)
+	return writeErr
+}
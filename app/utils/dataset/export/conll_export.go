@@ -0,0 +1,137 @@
+package dataset_export
+
+import (
+	"backend/app/models"
+	dataset_utils "backend/app/utils/dataset"
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const conllDocStart = "-DOCSTART- -X- -X- O"
+const conllOutsideTag = "O"
+
+type SpanIssue struct {
+	SampleID uint   `json:"sample_id"`
+	EntityID uint   `json:"entity_id"`
+	Start    uint   `json:"start"`
+	End      uint   `json:"end"`
+	Reason   string `json:"reason"`
+}
+
+type ConllExportReport struct {
+	ExportedSamples int         `json:"exported_samples"`
+	SpanIssues      []SpanIssue `json:"span_issues"`
+}
+
+type LabeledToken struct {
+	dataset_utils.Token
+	Label string
+}
+
+// MapEntitiesToBIO tokenizes the text and labels the tokens with B-/I-/O labels.
+// Spans that do not line up with token boundaries are expanded to the tokens they touch,
+// spans that cannot be represented are skipped. Both cases are reported as span issues.
+func MapEntitiesToBIO(sampleId uint, text string, entities []dataset_utils.Entity) ([]LabeledToken, []SpanIssue) {
+	tokens := dataset_utils.Tokenize(text)
+	labeled := make([]LabeledToken, len(tokens))
+	for i, token := range tokens {
+		labeled[i] = LabeledToken{Token: token, Label: conllOutsideTag}
+	}
+
+	sortedEntities := make([]dataset_utils.Entity, len(entities))
+	copy(sortedEntities, entities)
+	sort.SliceStable(sortedEntities, func(i, j int) bool {
+		return sortedEntities[i].Start < sortedEntities[j].Start
+	})
+
+	var issues []SpanIssue
+	for _, entity := range sortedEntities {
+		issue := SpanIssue{SampleID: sampleId, EntityID: entity.Id, Start: entity.Start, End: entity.End}
+		if !entity.Tag.Valid || entity.Tag.String == "" {
+			issue.Reason = "entity has no tag"
+			issues = append(issues, issue)
+			continue
+		}
+
+		first, last := -1, -1
+		for i, token := range tokens {
+			if token.Start < entity.End && token.End > entity.Start {
+				if first == -1 {
+					first = i
+				}
+				last = i
+			}
+		}
+
+		if first == -1 {
+			issue.Reason = "span does not cover any token"
+			issues = append(issues, issue)
+			continue
+		}
+
+		overlapping := false
+		for i := first; i <= last; i++ {
+			if labeled[i].Label != conllOutsideTag {
+				overlapping = true
+			}
+		}
+
+		if overlapping {
+			issue.Reason = "span overlaps another entity"
+			issues = append(issues, issue)
+			continue
+		}
+
+		if tokens[first].Start != entity.Start || tokens[last].End != entity.End {
+			issue.Reason = fmt.Sprintf("span does not line up with token boundaries, expanded to %d-%d", tokens[first].Start, tokens[last].End)
+			issues = append(issues, issue)
+		}
+
+		labeled[first].Label = "B-" + entity.Tag.String
+		for i := first + 1; i <= last; i++ {
+			labeled[i].Label = "I-" + entity.Tag.String
+		}
+	}
+
+	return labeled, issues
+}
+
+func ExportDatasetConll(w io.Writer, samples []*models.Sample) (*ConllExportReport, error) {
+	report := &ConllExportReport{SpanIssues: []SpanIssue{}}
+	writer := bufio.NewWriter(w)
+	if _, writeErr := fmt.Fprintf(writer, "%s\n\n", conllDocStart); writeErr != nil {
+		return nil, writeErr
+	}
+
+	for _, sample := range samples {
+		annotations, annotationsErr := dataset_utils.ParseAnnotations(sample.Annotations)
+		if annotationsErr != nil {
+			return nil, annotationsErr
+		}
+
+		tokens, issues := MapEntitiesToBIO(sample.ID, sample.Text, annotations.Entities)
+		report.SpanIssues = append(report.SpanIssues, issues...)
+		if len(tokens) == 0 {
+			continue
+		}
+
+		for _, token := range tokens {
+			if _, writeErr := fmt.Fprintf(writer, "%s _ _ %s\n", token.Text, token.Label); writeErr != nil {
+				return nil, writeErr
+			}
+		}
+
+		if _, writeErr := writer.WriteString("\n"); writeErr != nil {
+			return nil, writeErr
+		}
+		report.ExportedSamples++
+	}
+
+	if flushErr := writer.Flush(); flushErr != nil {
+		return nil, flushErr
+	}
+
+	return report, nil
+}
@@ -0,0 +1,49 @@
+package dataset_export
+
+import (
+	"backend/app/models"
+	dataset_utils "backend/app/utils/dataset"
+	"bytes"
+	"testing"
+
+	"github.com/matryer/is"
+	"gopkg.in/guregu/null.v4"
+	"gorm.io/datatypes"
+)
+
+func TestMapEntitiesToBIO(t *testing.T) {
+	is := is.New(t)
+
+	entities := []dataset_utils.Entity{
+		{Id: 1, Start: 0, End: 10, Tag: null.StringFrom("PER")},
+		{Id: 2, Start: 17, End: 20, Tag: null.StringFrom("LOC")},
+		{Id: 3, Start: 0, End: 4, Tag: null.StringFrom("PER")},
+	}
+
+	tokens, issues := MapEntitiesToBIO(1, "John Smith, from Paris.", entities)
+	labels := make([]string, len(tokens))
+	for i, token := range tokens {
+		labels[i] = token.Label
+	}
+
+	is.Equal(labels, []string{"B-PER", "I-PER", "O", "O", "B-LOC", "O"})
+	is.Equal(len(issues), 2)
+	is.Equal(issues[0].EntityID, uint(3))
+	is.Equal(issues[1].EntityID, uint(2))
+}
+
+func TestExportDatasetConll(t *testing.T) {
+	is := is.New(t)
+
+	samples := []*models.Sample{
+		{Text: "John lives in Paris", Annotations: datatypes.JSON(`{"entities": [{"id": 1, "start": 14, "end": 19, "tag": "LOC"}]}`)},
+		{Text: "  "},
+	}
+
+	var output bytes.Buffer
+	report, exportErr := ExportDatasetConll(&output, samples)
+	is.NoErr(exportErr)
+	is.Equal(report.ExportedSamples, 1)
+	is.Equal(len(report.SpanIssues), 0)
+	is.Equal(output.String(), "-DOCSTART- -X- -X- O\n\nJohn _ _ O\nlives _ _ O\nin _ _ O\nParis _ _ B-LOC\n\n")
+}
@@ -4,25 +4,45 @@ import (
 	"backend/app/models"
 	dataset_utils "backend/app/utils/dataset"
 	"encoding/json"
+	"io"
 )
 
 func MapSampleToSampleData(sample *models.Sample) (*dataset_utils.SampleData, error) {
-	var annotations dataset_utils.AnnotationData
-	if parsingErr := json.Unmarshal(sample.Annotations, &annotations); parsingErr != nil {
-		return nil, parsingErr
+	annotations, annotationsErr := dataset_utils.ParseAnnotations(sample.Annotations)
+	if annotationsErr != nil {
+		return nil, annotationsErr
 	}
 
-	var metadata dataset_utils.Metadata
-	if parsingErr := json.Unmarshal(sample.Metadata, &metadata); parsingErr != nil {
-		return nil, parsingErr
+	metadata, metadataErr := dataset_utils.ParseMetadata(sample.Metadata)
+	if metadataErr != nil {
+		return nil, metadataErr
 	}
 
-	return &dataset_utils.SampleData{
+	sampleData := &dataset_utils.SampleData{
+		ExternalID:  sample.ExternalID,
 		Text:        sample.Text,
-		Annotations: annotations,
+		Annotations: *annotations,
 		Status:      sample.Status,
-		Metadata:    metadata,
-	}, nil
+		Metadata:    *metadata,
+	}
+
+	// a single annotation is copied to the sample when it is completed, several ones are only merged on review
+	if len(sample.UserAnnotations) > 1 {
+		for _, sampleAnnotation := range sample.UserAnnotations {
+			userAnnotations, annotationsErr := dataset_utils.ParseAnnotations(sampleAnnotation.Annotations)
+			if annotationsErr != nil {
+				return nil, annotationsErr
+			}
+
+			sampleData.UserAnnotations = append(sampleData.UserAnnotations, dataset_utils.ExportedUserAnnotation{
+				UserID:      sampleAnnotation.UserID,
+				Status:      sampleAnnotation.Status,
+				Annotations: *userAnnotations,
+			})
+		}
+	}
+
+	return sampleData, nil
 }
 
 func MapSamplesToSampleData(samples []*models.Sample) ([]dataset_utils.SampleData, error) {
@@ -39,9 +59,9 @@ func MapSamplesToSampleData(samples []*models.Sample) ([]dataset_utils.SampleDat
 }
 
 func ExportDataset(dataset *models.Dataset, samples []*models.Sample) (*dataset_utils.JsonDataset, error) {
-	var metadata dataset_utils.Metadata
-	if parsingErr := json.Unmarshal(dataset.Metadata, &metadata); parsingErr != nil {
-		return nil, parsingErr
+	metadata, metadataErr := dataset_utils.ParseMetadata(dataset.Metadata)
+	if metadataErr != nil {
+		return nil, metadataErr
 	}
 
 	sampleData, sampleDataErr := MapSamplesToSampleData(samples)
@@ -52,6 +72,36 @@ func ExportDataset(dataset *models.Dataset, samples []*models.Sample) (*dataset_
 	return &dataset_utils.JsonDataset{
 		Name:     dataset.Name,
 		Samples:  sampleData,
-		Metadata: metadata,
+		Metadata: *metadata,
 	}, nil
 }
+
+func ExportDatasetJsonl(w io.Writer, dataset *models.Dataset, samples []*models.Sample) error {
+	metadata, metadataErr := dataset_utils.ParseMetadata(dataset.Metadata)
+	if metadataErr != nil {
+		return metadataErr
+	}
+
+	encoder := json.NewEncoder(w)
+	header := &dataset_utils.JsonlHeader{
+		Name:     dataset.Name,
+		Metadata: metadata,
+	}
+
+	if encodeErr := encoder.Encode(header); encodeErr != nil {
+		return encodeErr
+	}
+
+	for _, sample := range samples {
+		sampleData, exportErr := MapSampleToSampleData(sample)
+		if exportErr != nil {
+			return exportErr
+		}
+
+		if encodeErr := encoder.Encode(sampleData); encodeErr != nil {
+			return encodeErr
+		}
+	}
+
+	return nil
+}
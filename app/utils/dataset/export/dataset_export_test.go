@@ -0,0 +1,37 @@
+package dataset_export
+
+import (
+	"backend/app/models"
+	"testing"
+
+	"github.com/matryer/is"
+	"gopkg.in/guregu/null.v4"
+	"gorm.io/datatypes"
+)
+
+func TestMapSampleToSampleDataWithUserAnnotations(t *testing.T) {
+	is := is.New(t)
+
+	sample := &models.Sample{
+		Text:   "John lives in Paris",
+		Status: models.Uncertain.ToNullString(),
+		UserAnnotations: []models.SampleAnnotation{
+			{UserID: 1, Status: models.Accepted.ToNullString(), Annotations: datatypes.JSON(`{"entities": [{"id": 1, "start": 14, "end": 19, "tag": "LOC"}]}`)},
+			{UserID: 2, Status: models.Rejected.ToNullString()},
+		},
+	}
+
+	sampleData, exportErr := MapSampleToSampleData(sample)
+	is.NoErr(exportErr)
+	is.Equal(len(sampleData.Annotations.Entities), 0)
+	is.Equal(len(sampleData.UserAnnotations), 2)
+	is.Equal(sampleData.UserAnnotations[0].UserID, uint(1))
+	is.Equal(sampleData.UserAnnotations[0].Annotations.Entities[0].Tag, null.StringFrom("LOC"))
+	is.Equal(sampleData.UserAnnotations[1].Status, models.Rejected.ToNullString())
+
+	// a single annotation is already copied to the sample
+	sample.UserAnnotations = sample.UserAnnotations[:1]
+	sampleData, exportErr = MapSampleToSampleData(sample)
+	is.NoErr(exportErr)
+	is.Equal(sampleData.UserAnnotations, nil)
+}
@@ -0,0 +1,45 @@
+package dataset_export
+
+import (
+	"backend/app/models"
+	dataset_utils "backend/app/utils/dataset"
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+// ExportDatasetSpacy writes the samples as a JSON array of spaCy docs
+func ExportDatasetSpacy(w io.Writer, samples []*models.Sample) error {
+	writer := bufio.NewWriter(w)
+	if _, writeErr := writer.WriteString("["); writeErr != nil {
+		return writeErr
+	}
+
+	for i, sample := range samples {
+		sampleData, mapErr := MapSampleToSampleData(sample)
+		if mapErr != nil {
+			return mapErr
+		}
+
+		doc, marshalErr := json.Marshal(dataset_utils.MapSampleDataToSpacyDoc(sampleData))
+		if marshalErr != nil {
+			return marshalErr
+		}
+
+		if i > 0 {
+			if _, writeErr := writer.WriteString(",\n"); writeErr != nil {
+				return writeErr
+			}
+		}
+
+		if _, writeErr := writer.Write(doc); writeErr != nil {
+			return writeErr
+		}
+	}
+
+	if _, writeErr := writer.WriteString("]\n"); writeErr != nil {
+		return writeErr
+	}
+
+	return writer.Flush()
+}
@@ -0,0 +1,84 @@
+package dataset
+
+import (
+	"errors"
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+type Format string
+
+const (
+	JsonFormat  Format = "json"
+	JsonlFormat Format = "jsonl"
+	ConllFormat Format = "conll"
+	SpacyFormat Format = "spacy"
+	BratFormat  Format = "brat"
+)
+
+var ErrUnknownFormat = errors.New("unknown dataset format")
+
+var formatContentTypes = map[Format][]string{
+	JsonFormat:  {"application/json"},
+	JsonlFormat: {"application/x-ndjson", "application/jsonl", "application/x-jsonlines", "application/json-lines"},
+	ConllFormat: {"text/x-conll"},
+	SpacyFormat: {"application/x-spacy+json"},
+	BratFormat:  {"application/zip", "application/x-zip-compressed"},
+}
+
+var formatFileExtensions = map[string]Format{
+	"json":   JsonFormat,
+	"jsonl":  JsonlFormat,
+	"ndjson": JsonlFormat,
+	"conll":  ConllFormat,
+	"zip":    BratFormat,
+}
+
+func (f Format) IsValid() error {
+	if _, ok := formatContentTypes[f]; ok {
+		return nil
+	}
+	return ErrUnknownFormat
+}
+
+func (f Format) ContentType() string {
+	return formatContentTypes[f][0]
+}
+
+func (f Format) FileExtension() string {
+	switch f {
+	case SpacyFormat:
+		return ".spacy.json"
+	case BratFormat:
+		return ".zip"
+	default:
+		return "." + string(f)
+	}
+}
+
+func FormatFromContentType(contentType string) (Format, bool) {
+	mediaType, _, parseErr := mime.ParseMediaType(contentType)
+	if parseErr != nil {
+		return "", false
+	}
+
+	for format, contentTypes := range formatContentTypes {
+		for _, formatContentType := range contentTypes {
+			if mediaType == formatContentType {
+				return format, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func FormatFromFileName(fileName string) (Format, bool) {
+	if strings.HasSuffix(strings.ToLower(fileName), SpacyFormat.FileExtension()) {
+		return SpacyFormat, true
+	}
+
+	format, ok := formatFileExtensions[strings.TrimPrefix(strings.ToLower(filepath.Ext(fileName)), ".")]
+	return format, ok
+}
@@ -0,0 +1,113 @@
+package dataset_import
+
+import (
+	"archive/zip"
+	"io"
+	"path"
+
+	dataset "backend/app/utils/dataset"
+)
+
+type bratDatasetReader struct {
+	files     map[string]*zip.File
+	documents []string
+	position  int
+	name      string
+	metadata  *dataset.Metadata
+}
+
+// NewBratDatasetReader reads a zip archive of brat standoff files, every .txt file with its .ann file
+// becomes a sample. Without the given metadata, the tags are read from the annotation.conf in the archive.
+func NewBratDatasetReader(r io.ReaderAt, size int64, name string, metadata *dataset.Metadata) (DatasetReader, error) {
+	archive, archiveErr := zip.NewReader(r, size)
+	if archiveErr != nil {
+		return nil, archiveErr
+	}
+
+	reader := &bratDatasetReader{files: map[string]*zip.File{}, name: name, metadata: metadata}
+	var fileNames []string
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		reader.files[file.Name] = file
+		fileNames = append(fileNames, file.Name)
+	}
+	reader.documents = dataset.SortedBratDocumentNames(fileNames)
+
+	if reader.metadata == nil {
+		for fileName, file := range reader.files {
+			if path.Base(fileName) != dataset.BratConfigFileName {
+				continue
+			}
+
+			conf, readErr := readZipFile(file)
+			if readErr != nil {
+				return nil, readErr
+			}
+			reader.metadata = dataset.ParseBratConfig(conf)
+		}
+	}
+
+	return reader, nil
+}
+
+func (b *bratDatasetReader) Name() string {
+	return b.name
+}
+
+func (b *bratDatasetReader) Metadata() *dataset.Metadata {
+	return b.metadata
+}
+
+func (b *bratDatasetReader) Next() (*dataset.SampleData, error) {
+	if b.position >= len(b.documents) {
+		return nil, io.EOF
+	}
+
+	document := b.documents[b.position]
+	b.position++
+
+	text, textErr := readZipFile(b.files[document+".txt"])
+	if textErr != nil {
+		return nil, textErr
+	}
+
+	sample := &dataset.SampleData{
+		Text: text,
+		Annotations: dataset.AnnotationData{
+			Entities:      []dataset.Entity{},
+			Relationships: []dataset.Relationship{},
+		},
+	}
+
+	if annFile, hasAnn := b.files[document+".ann"]; hasAnn {
+		ann, annErr := readZipFile(annFile)
+		if annErr != nil {
+			return nil, annErr
+		}
+
+		annotations, parsingErr := dataset.ParseBratAnnotations(ann)
+		if parsingErr != nil {
+			return nil, &SampleDecodeError{Err: parsingErr}
+		}
+		sample.Annotations = *annotations
+	}
+
+	return sample, nil
+}
+
+func readZipFile(file *zip.File) (string, error) {
+	fileReader, openErr := file.Open()
+	if openErr != nil {
+		return "", openErr
+	}
+	defer fileReader.Close()
+
+	content, readErr := io.ReadAll(fileReader)
+	if readErr != nil {
+		return "", readErr
+	}
+
+	return string(content), nil
+}
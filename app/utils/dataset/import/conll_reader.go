@@ -0,0 +1,191 @@
+package dataset_import
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	dataset "backend/app/utils/dataset"
+	"gopkg.in/guregu/null.v4"
+)
+
+type conllDatasetReader struct {
+	scanner       *bufio.Scanner
+	name          string
+	metadata      *dataset.Metadata
+	givenMetadata bool
+	seenTags      map[string]bool
+	done          bool
+}
+
+// NewConllDatasetReader reads CoNLL files with one token per line, the token in the first column
+// and its BIO label in the last one. Every sentence becomes a sample. When no metadata is given,
+// it is collected from the labels and becomes available once all samples have been read.
+func NewConllDatasetReader(r io.Reader, name string, metadata *dataset.Metadata) (DatasetReader, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	return &conllDatasetReader{
+		scanner:       scanner,
+		name:          name,
+		metadata:      metadata,
+		givenMetadata: metadata != nil,
+		seenTags:      map[string]bool{},
+	}, nil
+}
+
+func (c *conllDatasetReader) Name() string {
+	return c.name
+}
+
+func (c *conllDatasetReader) Metadata() *dataset.Metadata {
+	if c.givenMetadata || c.done {
+		return c.metadata
+	}
+
+	return nil
+}
+
+func (c *conllDatasetReader) Next() (*dataset.SampleData, error) {
+	var tokens []string
+	var labels []string
+
+	for c.scanner.Scan() {
+		line := strings.TrimSpace(c.scanner.Text())
+		if strings.HasPrefix(line, "-DOCSTART-") {
+			continue
+		}
+
+		if line == "" {
+			if len(tokens) > 0 {
+				return c.buildSample(tokens, labels)
+			}
+			continue
+		}
+
+		columns := strings.Fields(line)
+		label := "O"
+		if len(columns) > 1 {
+			label = columns[len(columns)-1]
+		}
+
+		tokens = append(tokens, columns[0])
+		labels = append(labels, label)
+	}
+
+	if scanErr := c.scanner.Err(); scanErr != nil {
+		return nil, scanErr
+	}
+
+	if len(tokens) > 0 {
+		return c.buildSample(tokens, labels)
+	}
+
+	c.finish()
+	return nil, io.EOF
+}
+
+func (c *conllDatasetReader) finish() {
+	if c.done {
+		return
+	}
+
+	c.done = true
+	if !c.givenMetadata {
+		tags := make([]string, 0, len(c.seenTags))
+		for tag := range c.seenTags {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+
+		c.metadata = &dataset.Metadata{EntityTags: []dataset.Tag{}, RelationshipTags: []dataset.Tag{}}
+		for _, tag := range tags {
+			c.metadata.EntityTags = append(c.metadata.EntityTags, dataset.Tag{Name: tag})
+		}
+	}
+}
+
+func (c *conllDatasetReader) buildSample(tokens []string, labels []string) (*dataset.SampleData, error) {
+	entities, entitiesErr := MapBIOToEntities(tokens, labels)
+	if entitiesErr != nil {
+		return nil, &SampleDecodeError{Err: entitiesErr}
+	}
+
+	for _, entity := range entities {
+		c.seenTags[entity.Tag.String] = true
+	}
+
+	return &dataset.SampleData{
+		Text: strings.Join(tokens, " "),
+		Annotations: dataset.AnnotationData{
+			Entities:      entities,
+			Relationships: []dataset.Relationship{},
+		},
+	}, nil
+}
+
+// MapBIOToEntities maps labeled tokens to entity spans over the tokens joined with single spaces.
+// BIO, IOB1 and BIOES labels are supported.
+func MapBIOToEntities(tokens []string, labels []string) ([]dataset.Entity, error) {
+	if len(tokens) != len(labels) {
+		return nil, errors.New("number of tokens and labels does not match")
+	}
+
+	entities := []dataset.Entity{}
+	var current *dataset.Entity
+	var offset uint
+
+	closeCurrent := func() {
+		if current != nil {
+			entities = append(entities, *current)
+			current = nil
+		}
+	}
+
+	for i, token := range tokens {
+		if i > 0 {
+			offset++
+		}
+		tokenLength := dataset.TextLength(token)
+		label := labels[i]
+
+		if label == "O" {
+			closeCurrent()
+			offset += tokenLength
+			continue
+		}
+
+		parts := strings.SplitN(label, "-", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("invalid label %q on token %d", label, i)
+		}
+
+		prefix, tag := parts[0], parts[1]
+		switch prefix {
+		case "B", "S":
+			closeCurrent()
+		case "I", "E":
+			if current != nil && current.Tag.String != tag {
+				closeCurrent()
+			}
+		default:
+			return nil, fmt.Errorf("invalid label prefix %q on token %d", prefix, i)
+		}
+
+		if current == nil {
+			current = &dataset.Entity{Id: uint(len(entities) + 1), Start: offset, Tag: null.StringFrom(tag)}
+		}
+		current.End = offset + tokenLength
+
+		if prefix == "S" || prefix == "E" {
+			closeCurrent()
+		}
+		offset += tokenLength
+	}
+	closeCurrent()
+
+	return entities, nil
+}
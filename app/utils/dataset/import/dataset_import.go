@@ -2,8 +2,11 @@ package dataset_import
 
 import (
 	"backend/app/models"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"io"
+	"strings"
 
 	dataset "backend/app/utils/dataset"
 	"gorm.io/datatypes"
@@ -12,27 +15,43 @@ import (
 func MapSampleDataToSample(sampleData []dataset.SampleData, datasetId uint) ([]models.Sample, error) {
 	samples := make([]models.Sample, len(sampleData))
 
-	for i, d := range sampleData {
-		annotationsData, err := json.Marshal(d.Annotations)
+	for i := range sampleData {
+		sample, err := MapSingleSampleDataToSample(&sampleData[i], datasetId)
 		if err != nil {
 			return nil, err
 		}
+		samples[i] = *sample
+	}
 
-		metadata, metadataErr := json.Marshal(d.Metadata)
-		if metadataErr != nil {
-			return nil, err
-		}
+	return samples, nil
+}
 
-		samples[i] = models.Sample{
-			DatasetID:   datasetId,
-			Annotations: datatypes.JSON(annotationsData),
-			Status:      d.Status,
-			Text:        d.Text,
-			Metadata:    metadata,
-		}
+func MapSingleSampleDataToSample(sampleData *dataset.SampleData, datasetId uint) (*models.Sample, error) {
+	annotationsData, err := json.Marshal(sampleData.Annotations)
+	if err != nil {
+		return nil, err
 	}
 
-	return samples, nil
+	metadata, metadataErr := json.Marshal(sampleData.Metadata)
+	if metadataErr != nil {
+		return nil, metadataErr
+	}
+
+	return &models.Sample{
+		DatasetID:   datasetId,
+		ExternalID:  sampleData.ExternalID,
+		Annotations: datatypes.JSON(annotationsData),
+		Status:      sampleData.Status,
+		Text:        sampleData.Text,
+		ContentHash: ContentHash(sampleData.Text),
+		Metadata:    metadata,
+	}, nil
+}
+
+// ContentHash identifies a sample by its text, texts that only differ in whitespace have the same hash
+func ContentHash(text string) string {
+	hash := sha256.Sum256([]byte(strings.Join(strings.Fields(text), " ")))
+	return hex.EncodeToString(hash[:])
 }
 
 func CreateDatasetMetadata(entityTags []string, relationshipTags []string) (datatypes.JSON, error) {
@@ -0,0 +1,158 @@
+package dataset_import
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	dataset "backend/app/utils/dataset"
+)
+
+var ErrInvalidDataset = errors.New("invalid dataset")
+
+// SampleDecodeError is returned by a DatasetReader when a single sample could not be decoded,
+// reading can continue with the next sample.
+type SampleDecodeError struct {
+	Err error
+}
+
+func (e *SampleDecodeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *SampleDecodeError) Unwrap() error {
+	return e.Err
+}
+
+type DatasetReader interface {
+	Name() string
+	// Metadata may change while reading, it is complete once Next returns io.EOF
+	Metadata() *dataset.Metadata
+	// Next returns io.EOF when there are no samples left
+	Next() (*dataset.SampleData, error)
+}
+
+type jsonDatasetReader struct {
+	decoder   *json.Decoder
+	name      string
+	metadata  *dataset.Metadata
+	inSamples bool
+	done      bool
+}
+
+func NewJsonDatasetReader(r io.Reader) (DatasetReader, error) {
+	reader := &jsonDatasetReader{decoder: json.NewDecoder(r)}
+	if delimErr := reader.expectDelim('{'); delimErr != nil {
+		return nil, delimErr
+	}
+
+	if readErr := reader.readUntilSamples(); readErr != nil {
+		return nil, readErr
+	}
+
+	return reader, nil
+}
+
+func (j *jsonDatasetReader) Name() string {
+	return j.name
+}
+
+func (j *jsonDatasetReader) Metadata() *dataset.Metadata {
+	return j.metadata
+}
+
+func (j *jsonDatasetReader) Next() (*dataset.SampleData, error) {
+	for !j.done {
+		if j.inSamples {
+			if j.decoder.More() {
+				sample := &dataset.SampleData{}
+				if decodeErr := j.decoder.Decode(sample); decodeErr != nil {
+					var typeErr *json.UnmarshalTypeError
+					if errors.As(decodeErr, &typeErr) {
+						return nil, &SampleDecodeError{Err: decodeErr}
+					}
+					return nil, decodeErr
+				}
+				return sample, nil
+			}
+
+			// consume the closing bracket of the samples array
+			if _, tokenErr := j.decoder.Token(); tokenErr != nil {
+				return nil, tokenErr
+			}
+			j.inSamples = false
+		}
+
+		if readErr := j.readUntilSamples(); readErr != nil {
+			return nil, readErr
+		}
+	}
+
+	return nil, io.EOF
+}
+
+func (j *jsonDatasetReader) expectDelim(expected json.Delim) error {
+	token, tokenErr := j.decoder.Token()
+	if tokenErr != nil {
+		return tokenErr
+	}
+
+	if delim, ok := token.(json.Delim); !ok || delim != expected {
+		return fmt.Errorf("expected %q, got %v", expected, token)
+	}
+
+	return nil
+}
+
+// readUntilSamples reads the top level keys until it finds the start of the samples array
+// or the end of the dataset object
+func (j *jsonDatasetReader) readUntilSamples() error {
+	for j.decoder.More() {
+		token, tokenErr := j.decoder.Token()
+		if tokenErr != nil {
+			return tokenErr
+		}
+
+		switch token {
+		case "name":
+			if decodeErr := j.decoder.Decode(&j.name); decodeErr != nil {
+				return decodeErr
+			}
+		case "metadata":
+			metadata := &dataset.Metadata{}
+			if decodeErr := j.decoder.Decode(metadata); decodeErr != nil {
+				return decodeErr
+			}
+			j.metadata = metadata
+		case "samples":
+			valueToken, valueErr := j.decoder.Token()
+			if valueErr != nil {
+				return valueErr
+			}
+
+			if valueToken == nil {
+				continue
+			}
+
+			if delim, ok := valueToken.(json.Delim); !ok || delim != '[' {
+				return fmt.Errorf("expected samples to be an array, got %v", valueToken)
+			}
+
+			j.inSamples = true
+			return nil
+		default:
+			var skipped json.RawMessage
+			if decodeErr := j.decoder.Decode(&skipped); decodeErr != nil {
+				return decodeErr
+			}
+		}
+	}
+
+	// consume the closing brace of the dataset object
+	if _, tokenErr := j.decoder.Token(); tokenErr != nil {
+		return tokenErr
+	}
+	j.done = true
+	return nil
+}
@@ -0,0 +1,68 @@
+package dataset_import
+
+import (
+	"backend/app/models"
+	"fmt"
+
+	dataset "backend/app/utils/dataset"
+
+	"gopkg.in/guregu/null.v4"
+)
+
+type RejectedSample struct {
+	Index  int                      `json:"index"`
+	Errors dataset.ValidationErrors `json:"errors"`
+}
+
+// ImportReport counts the samples of a new dataset. The samples are kept when the pre-annotation
+// that runs after the import fails, PreAnnotationError tells why it failed.
+type ImportReport struct {
+	Dataset            *models.Dataset  `json:"dataset"`
+	ImportedSamples    int              `json:"imported_samples"`
+	RejectedSamples    []RejectedSample `json:"rejected_samples"`
+	PreAnnotationError null.String      `json:"pre_annotation_error"`
+}
+
+func NewImportReport(dataset *models.Dataset) *ImportReport {
+	return &ImportReport{
+		Dataset:         dataset,
+		RejectedSamples: []RejectedSample{},
+	}
+}
+
+func (r *ImportReport) Reject(index int, errs dataset.ValidationErrors) {
+	r.RejectedSamples = append(r.RejectedSamples, RejectedSample{Index: index, Errors: errs})
+}
+
+// AppendReport counts the samples appended to an existing dataset, duplicates of existing samples are skipped or updated.
+// Like for imports, a failing pre-annotation does not undo the append.
+type AppendReport struct {
+	Dataset            *models.Dataset  `json:"dataset"`
+	AddedSamples       int              `json:"added_samples"`
+	SkippedSamples     int              `json:"skipped_samples"`
+	UpdatedSamples     int              `json:"updated_samples"`
+	RejectedSamples    []RejectedSample `json:"rejected_samples"`
+	PreAnnotationError null.String      `json:"pre_annotation_error"`
+}
+
+func NewAppendReport(dataset *models.Dataset) *AppendReport {
+	return &AppendReport{
+		Dataset:         dataset,
+		RejectedSamples: []RejectedSample{},
+	}
+}
+
+func (r *AppendReport) Reject(index int, errs dataset.ValidationErrors) {
+	r.RejectedSamples = append(r.RejectedSamples, RejectedSample{Index: index, Errors: errs})
+}
+
+func ValidateSampleData(sample *dataset.SampleData, metadata *dataset.Metadata) dataset.ValidationErrors {
+	errs := dataset.ValidateAnnotations(sample.Text, &sample.Annotations, metadata)
+	if sample.Status.Valid {
+		if statusErr := models.StatusType(sample.Status.String).IsValid(); statusErr != nil {
+			errs = append(errs, dataset.ValidationError{Field: "status", Reason: fmt.Sprintf("invalid status %q", sample.Status.String)})
+		}
+	}
+
+	return errs
+}
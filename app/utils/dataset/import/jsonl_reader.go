@@ -0,0 +1,124 @@
+package dataset_import
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+
+	dataset "backend/app/utils/dataset"
+)
+
+type jsonlDatasetReader struct {
+	reader     *bufio.Reader
+	name       string
+	metadata   *dataset.Metadata
+	pending    []byte
+	hasPending bool
+}
+
+// NewJsonlDatasetReader reads one sample per line. The first line can be a header record
+// with the dataset name and metadata, the given name and metadata take precedence over it.
+func NewJsonlDatasetReader(r io.Reader, name string, metadata *dataset.Metadata) (DatasetReader, error) {
+	reader := &jsonlDatasetReader{reader: bufio.NewReader(r)}
+
+	firstLine, lineErr := reader.readLine()
+	if lineErr != nil && !errors.Is(lineErr, io.EOF) {
+		return nil, lineErr
+	}
+
+	if header, isHeader := parseJsonlHeader(firstLine); isHeader {
+		reader.name = header.Name
+		reader.metadata = header.Metadata
+	} else if firstLine != nil {
+		reader.pending = firstLine
+		reader.hasPending = true
+	}
+
+	if name != "" {
+		reader.name = name
+	}
+
+	if metadata != nil {
+		reader.metadata = metadata
+	}
+
+	return reader, nil
+}
+
+func (j *jsonlDatasetReader) Name() string {
+	return j.name
+}
+
+func (j *jsonlDatasetReader) Metadata() *dataset.Metadata {
+	return j.metadata
+}
+
+func (j *jsonlDatasetReader) Next() (*dataset.SampleData, error) {
+	line := j.pending
+	if j.hasPending {
+		j.pending = nil
+		j.hasPending = false
+	} else {
+		var lineErr error
+		line, lineErr = j.readLine()
+		if lineErr != nil && !errors.Is(lineErr, io.EOF) {
+			return nil, lineErr
+		}
+
+		if line == nil {
+			return nil, io.EOF
+		}
+	}
+
+	sample := &dataset.SampleData{}
+	if decodeErr := json.Unmarshal(line, sample); decodeErr != nil {
+		return nil, &SampleDecodeError{Err: decodeErr}
+	}
+
+	return sample, nil
+}
+
+// readLine returns the next non-empty line, or nil and io.EOF when there are no lines left
+func (j *jsonlDatasetReader) readLine() ([]byte, error) {
+	for {
+		line, readErr := j.reader.ReadBytes('\n')
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			return line, nil
+		}
+
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+}
+
+func parseJsonlHeader(line []byte) (*dataset.JsonlHeader, bool) {
+	if line == nil {
+		return nil, false
+	}
+
+	var fields map[string]json.RawMessage
+	if decodeErr := json.Unmarshal(line, &fields); decodeErr != nil {
+		return nil, false
+	}
+
+	if _, hasText := fields["text"]; hasText {
+		return nil, false
+	}
+
+	_, hasName := fields["name"]
+	_, hasMetadata := fields["metadata"]
+	if !hasName && !hasMetadata {
+		return nil, false
+	}
+
+	header := &dataset.JsonlHeader{}
+	if decodeErr := json.Unmarshal(line, header); decodeErr != nil {
+		return nil, false
+	}
+
+	return header, true
+}
@@ -0,0 +1,63 @@
+package dataset_import
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+
+	dataset "backend/app/utils/dataset"
+)
+
+type spacyDatasetReader struct {
+	decoder  *json.Decoder
+	name     string
+	metadata *dataset.Metadata
+	done     bool
+}
+
+// NewSpacyDatasetReader reads a JSON array of spaCy docs in the Doc.to_json format
+func NewSpacyDatasetReader(r io.Reader, name string, metadata *dataset.Metadata) (DatasetReader, error) {
+	reader := &spacyDatasetReader{decoder: json.NewDecoder(r), name: name, metadata: metadata}
+	token, tokenErr := reader.decoder.Token()
+	if tokenErr != nil {
+		return nil, tokenErr
+	}
+
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, errors.New("expected an array of spaCy docs")
+	}
+
+	return reader, nil
+}
+
+func (s *spacyDatasetReader) Name() string {
+	return s.name
+}
+
+func (s *spacyDatasetReader) Metadata() *dataset.Metadata {
+	return s.metadata
+}
+
+func (s *spacyDatasetReader) Next() (*dataset.SampleData, error) {
+	if s.done || !s.decoder.More() {
+		if !s.done {
+			// consume the closing bracket
+			if _, tokenErr := s.decoder.Token(); tokenErr != nil {
+				return nil, tokenErr
+			}
+			s.done = true
+		}
+		return nil, io.EOF
+	}
+
+	doc := &dataset.SpacyDoc{}
+	if decodeErr := s.decoder.Decode(doc); decodeErr != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(decodeErr, &typeErr) {
+			return nil, &SampleDecodeError{Err: decodeErr}
+		}
+		return nil, decodeErr
+	}
+
+	return dataset.MapSpacyDocToSampleData(doc), nil
+}
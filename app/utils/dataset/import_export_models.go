@@ -1,19 +1,97 @@
 package dataset
 
 import (
+	"encoding/json"
+
 	"gopkg.in/guregu/null.v4"
 )
 
+// Tag is an entity or relationship tag. Relationship tags may restrict the entity tags they link,
+// empty sources or targets allow any entity tag and undirected relationships may link them in either order.
 type Tag struct {
-	Name  string      `json:"name"`
-	Color null.String `json:"color"`
+	Name        string      `json:"name"`
+	Color       null.String `json:"color"`
+	Description null.String `json:"description"`
+	Hotkey      null.String `json:"hotkey"`
+	Sources     []string    `json:"sources,omitempty"`
+	Targets     []string    `json:"targets,omitempty"`
+	Directed    bool        `json:"directed,omitempty"`
+}
+
+func (t *Tag) HasConstraints() bool {
+	return len(t.Sources) > 0 || len(t.Targets) > 0
+}
+
+// Allows checks whether the relationship tag may link entities with the given tags
+func (t *Tag) Allows(source null.String, target null.String) bool {
+	if allowsTag(t.Sources, source) && allowsTag(t.Targets, target) {
+		return true
+	}
+
+	return !t.Directed && allowsTag(t.Sources, target) && allowsTag(t.Targets, source)
 }
 
+func allowsTag(allowed []string, tag null.String) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	for _, name := range allowed {
+		if tag.Valid && tag.String == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Metadata holds the tags of a dataset. Samples share the type for their metadata,
+// keys other than the tags are kept in Extra so that they survive an import and export.
 type Metadata struct {
-	EntityTags       []Tag `json:"entityTags"`
-	RelationshipTags []Tag `json:"relationshipTags"`
+	EntityTags       []Tag                      `json:"entityTags"`
+	RelationshipTags []Tag                      `json:"relationshipTags"`
+	Extra            map[string]json.RawMessage `json:"-"`
 }
 
+// metadataTags keeps the default JSON encoding of the tags
+type metadataTags Metadata
+
+func (m *Metadata) UnmarshalJSON(data []byte) error {
+	if parsingErr := json.Unmarshal(data, (*metadataTags)(m)); parsingErr != nil {
+		return parsingErr
+	}
+
+	var fields map[string]json.RawMessage
+	if parsingErr := json.Unmarshal(data, &fields); parsingErr != nil {
+		return parsingErr
+	}
+
+	delete(fields, "entityTags")
+	delete(fields, "relationshipTags")
+	m.Extra = nil
+	if len(fields) > 0 {
+		m.Extra = fields
+	}
+
+	return nil
+}
+
+func (m Metadata) MarshalJSON() ([]byte, error) {
+	if len(m.Extra) == 0 {
+		return json.Marshal(metadataTags(m))
+	}
+
+	fields := make(map[string]interface{}, len(m.Extra)+2)
+	for key, value := range m.Extra {
+		fields[key] = value
+	}
+	fields["entityTags"] = m.EntityTags
+	fields["relationshipTags"] = m.RelationshipTags
+
+	return json.Marshal(fields)
+}
+
+// Entity is an annotated span, Model names the pre-annotator that generated it and is empty for human annotations
 type Entity struct {
 	Id    uint        `json:"id"`
 	Start uint        `json:"start"`
@@ -21,6 +99,7 @@ type Entity struct {
 	Tag   null.String `json:"tag"`
 	Notes null.String `json:"notes"`
 	Color null.String `json:"color"`
+	Model string      `json:"model,omitempty"`
 }
 
 type BoxPosition struct {
@@ -35,6 +114,7 @@ type Relationship struct {
 	Name        string       `json:"name"`
 	Color       null.String  `json:"color"`
 	BoxPosition *BoxPosition `json:"boxPosition"`
+	Model       string       `json:"model,omitempty"`
 }
 
 type AnnotationData struct {
@@ -42,15 +122,104 @@ type AnnotationData struct {
 	Relationships []Relationship `json:"relationships"`
 }
 
+// SampleData is a sample as it is imported and exported, the optional external id identifies it in the source of the dataset.
+// Samples annotated by several users export the completed annotation of each one, they are ignored on import.
 type SampleData struct {
-	Text        string         `json:"text"`
-	Annotations AnnotationData `json:"annotations"`
+	ExternalID      null.String              `json:"external_id"`
+	Text            string                   `json:"text"`
+	Annotations     AnnotationData           `json:"annotations"`
+	Status          null.String              `json:"status"`
+	Metadata        Metadata                 `json:"metadata"`
+	UserAnnotations []ExportedUserAnnotation `json:"user_annotations,omitempty"`
+}
+
+type ExportedUserAnnotation struct {
+	UserID      uint           `json:"user_id"`
 	Status      null.String    `json:"status"`
-	Metadata    Metadata       `json:"metadata"`
+	Annotations AnnotationData `json:"annotations"`
 }
 
 type JsonDataset struct {
 	Name     string       `json:"name"`
-	Samples  []SampleData `json:"samples"`
 	Metadata Metadata     `json:"metadata"`
+	Samples  []SampleData `json:"samples"`
+}
+
+type JsonlHeader struct {
+	Name     string    `json:"name"`
+	Metadata *Metadata `json:"metadata"`
+}
+
+func ParseMetadata(data []byte) (*Metadata, error) {
+	metadata := &Metadata{}
+	if len(data) == 0 {
+		return metadata, nil
+	}
+
+	if parsingErr := json.Unmarshal(data, metadata); parsingErr != nil {
+		return nil, parsingErr
+	}
+
+	return metadata, nil
+}
+
+// RenameTag renames the entity tags and the relationships with the old name, it reports whether anything changed
+func (a *AnnotationData) RenameTag(oldName string, newName string) bool {
+	renamedEntities := a.RenameEntityTag(oldName, newName)
+	renamedRelationships := a.RenameRelationshipTag(oldName, newName)
+	return renamedEntities || renamedRelationships
+}
+
+func (a *AnnotationData) RenameEntityTag(oldName string, newName string) bool {
+	renamed := false
+	for i := range a.Entities {
+		if a.Entities[i].Tag.Valid && a.Entities[i].Tag.String == oldName {
+			a.Entities[i].Tag = null.StringFrom(newName)
+			renamed = true
+		}
+	}
+
+	return renamed
+}
+
+func (a *AnnotationData) RenameRelationshipTag(oldName string, newName string) bool {
+	renamed := false
+	for i := range a.Relationships {
+		if a.Relationships[i].Name == oldName {
+			a.Relationships[i].Name = newName
+			renamed = true
+		}
+	}
+
+	return renamed
+}
+
+// HasHumanAnnotations reports whether any entity or relationship was not generated by a pre-annotator
+func (a *AnnotationData) HasHumanAnnotations() bool {
+	for _, entity := range a.Entities {
+		if entity.Model == "" {
+			return true
+		}
+	}
+
+	for _, relationship := range a.Relationships {
+		if relationship.Model == "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func ParseAnnotations(data []byte) (*AnnotationData, error) {
+	annotations := &AnnotationData{}
+	if len(data) == 0 {
+		return annotations, nil
+	}
+
+	if parsingErr := json.Unmarshal(data, annotations); parsingErr != nil {
+		return nil, parsingErr
+	}
+
+	return annotations, nil
 }
@@ -0,0 +1,28 @@
+package dataset
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestMetadataKeepsExtraKeys(t *testing.T) {
+	is := is.New(t)
+
+	metadata, parsingErr := ParseMetadata([]byte(`{"entityTags": [{"name": "PER"}], "source": "news", "page": 3}`))
+	is.NoErr(parsingErr)
+	is.Equal(metadata.EntityTags[0].Name, "PER")
+
+	is.Equal(string(metadata.Extra["source"]), `"news"`)
+	is.Equal(string(metadata.Extra["page"]), "3")
+
+	data, marshalErr := json.Marshal(metadata)
+	is.NoErr(marshalErr)
+	is.Equal(string(data), `{"entityTags":[{"name":"PER","color":null,"description":null,"hotkey":null}],"page":3,"relationshipTags":null,"source":"news"}`)
+
+	// metadata without extra keys is encoded as before
+	data, marshalErr = json.Marshal(Metadata{EntityTags: []Tag{{Name: "PER"}}})
+	is.NoErr(marshalErr)
+	is.Equal(string(data), `{"entityTags":[{"name":"PER","color":null,"description":null,"hotkey":null}],"relationshipTags":null}`)
+}
@@ -0,0 +1,94 @@
+package dataset
+
+import (
+	"sort"
+
+	"gopkg.in/guregu/null.v4"
+)
+
+// SpacyDoc follows the format of spaCy's Doc.to_json and Doc.from_json
+type SpacyDoc struct {
+	Text   string        `json:"text"`
+	Ents   []SpacyEntity `json:"ents"`
+	Tokens []SpacyToken  `json:"tokens"`
+}
+
+type SpacyEntity struct {
+	Start uint   `json:"start"`
+	End   uint   `json:"end"`
+	Label string `json:"label"`
+}
+
+type SpacyToken struct {
+	Id    int  `json:"id"`
+	Start uint `json:"start"`
+	End   uint `json:"end"`
+}
+
+func MapSampleDataToSpacyDoc(sample *SampleData) *SpacyDoc {
+	doc := &SpacyDoc{Text: sample.Text, Ents: []SpacyEntity{}, Tokens: []SpacyToken{}}
+
+	var boundaries []uint
+	for _, entity := range sample.Annotations.Entities {
+		if !entity.Tag.Valid || entity.Tag.String == "" {
+			continue
+		}
+
+		doc.Ents = append(doc.Ents, SpacyEntity{Start: entity.Start, End: entity.End, Label: entity.Tag.String})
+		boundaries = append(boundaries, entity.Start, entity.End)
+	}
+
+	sort.SliceStable(doc.Ents, func(i, j int) bool {
+		return doc.Ents[i].Start < doc.Ents[j].Start
+	})
+
+	// spaCy requires the entities to line up with the tokens
+	for i, token := range splitTokensAt(Tokenize(sample.Text), boundaries) {
+		doc.Tokens = append(doc.Tokens, SpacyToken{Id: i, Start: token.Start, End: token.End})
+	}
+
+	return doc
+}
+
+func MapSpacyDocToSampleData(doc *SpacyDoc) *SampleData {
+	entities := make([]Entity, len(doc.Ents))
+	for i, ent := range doc.Ents {
+		entities[i] = Entity{Id: uint(i + 1), Start: ent.Start, End: ent.End, Tag: null.StringFrom(ent.Label)}
+	}
+
+	return &SampleData{
+		Text: doc.Text,
+		Annotations: AnnotationData{
+			Entities:      entities,
+			Relationships: []Relationship{},
+		},
+	}
+}
+
+// splitTokensAt splits the tokens that cross any of the given offsets
+func splitTokensAt(tokens []Token, offsets []uint) []Token {
+	var result []Token
+	for _, token := range tokens {
+		runes := []rune(token.Text)
+		start := token.Start
+
+		var cuts []uint
+		for _, offset := range offsets {
+			if offset > token.Start && offset < token.End {
+				cuts = append(cuts, offset)
+			}
+		}
+		sort.Slice(cuts, func(i, j int) bool { return cuts[i] < cuts[j] })
+
+		for _, cut := range cuts {
+			if cut == start {
+				continue
+			}
+			result = append(result, Token{Text: string(runes[start-token.Start : cut-token.Start]), Start: start, End: cut})
+			start = cut
+		}
+		result = append(result, Token{Text: string(runes[start-token.Start:]), Start: start, End: token.End})
+	}
+
+	return result
+}
@@ -0,0 +1,46 @@
+package dataset
+
+import (
+	"unicode"
+)
+
+type Token struct {
+	Text  string
+	Start uint
+	End   uint
+}
+
+// Tokenize splits the text on whitespace and punctuation, punctuation characters become separate tokens.
+// Token offsets are in the same units as entity offsets.
+func Tokenize(text string) []Token {
+	var tokens []Token
+	var current []rune
+	var currentStart uint
+
+	flush := func() {
+		if len(current) > 0 {
+			tokens = append(tokens, Token{Text: string(current), Start: currentStart, End: currentStart + uint(len(current))})
+			current = current[:0]
+		}
+	}
+
+	var offset uint
+	for _, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+			flush()
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			flush()
+			tokens = append(tokens, Token{Text: string(r), Start: offset, End: offset + 1})
+		default:
+			if len(current) == 0 {
+				currentStart = offset
+			}
+			current = append(current, r)
+		}
+		offset++
+	}
+	flush()
+
+	return tokens
+}
@@ -0,0 +1,174 @@
+package dataset
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/guregu/null.v4"
+)
+
+type ValidationError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+type ValidationErrors []ValidationError
+
+func (v ValidationErrors) Error() string {
+	reasons := make([]string, len(v))
+	for i, validationErr := range v {
+		reasons[i] = fmt.Sprintf("%s: %s", validationErr.Field, validationErr.Reason)
+	}
+
+	return strings.Join(reasons, "; ")
+}
+
+func (m *Metadata) HasEntityTag(name string) bool {
+	return hasTag(m.EntityTags, name)
+}
+
+func (m *Metadata) HasRelationshipTag(name string) bool {
+	return hasTag(m.RelationshipTags, name)
+}
+
+func (m *Metadata) RelationshipTag(name string) *Tag {
+	return findTag(m.RelationshipTags, name)
+}
+
+func hasTag(tags []Tag, name string) bool {
+	return findTag(tags, name) != nil
+}
+
+func findTag(tags []Tag, name string) *Tag {
+	for i := range tags {
+		if tags[i].Name == name {
+			return &tags[i]
+		}
+	}
+
+	return nil
+}
+
+// TextLength returns the length of the text in the units used by entity offsets
+func TextLength(text string) uint {
+	return uint(utf8.RuneCountInString(text))
+}
+
+// ValidateAnnotations checks the annotations against the sample text and the dataset metadata
+func ValidateAnnotations(text string, annotations *AnnotationData, metadata *Metadata) ValidationErrors {
+	errs := validateEntityOffsets(text, annotations)
+	errs = append(errs, validateReferences(annotations)...)
+	errs = append(errs, ValidateAnnotationTags(annotations, metadata)...)
+	return append(errs, validateRelationshipConstraints(annotations, metadata)...)
+}
+
+func validateReferences(annotations *AnnotationData) ValidationErrors {
+	var errs ValidationErrors
+
+	entityIds := map[uint]bool{}
+	for i, entity := range annotations.Entities {
+		if entityIds[entity.Id] {
+			errs = append(errs, ValidationError{Field: fmt.Sprintf("annotations.entities[%d].id", i), Reason: fmt.Sprintf("duplicate entity id %d", entity.Id)})
+		}
+		entityIds[entity.Id] = true
+	}
+
+	relationshipIds := map[uint]bool{}
+	for i, relationship := range annotations.Relationships {
+		field := fmt.Sprintf("annotations.relationships[%d]", i)
+		if relationshipIds[relationship.Id] {
+			errs = append(errs, ValidationError{Field: field + ".id", Reason: fmt.Sprintf("duplicate relationship id %d", relationship.Id)})
+		}
+		relationshipIds[relationship.Id] = true
+
+		if !entityIds[relationship.Entity1] {
+			errs = append(errs, ValidationError{Field: field + ".entity1", Reason: fmt.Sprintf("entity %d does not exist", relationship.Entity1)})
+		}
+
+		if !entityIds[relationship.Entity2] {
+			errs = append(errs, ValidationError{Field: field + ".entity2", Reason: fmt.Sprintf("entity %d does not exist", relationship.Entity2)})
+		}
+	}
+
+	return errs
+}
+
+func validateEntityOffsets(text string, annotations *AnnotationData) ValidationErrors {
+	var errs ValidationErrors
+	textLength := TextLength(text)
+
+	for i, entity := range annotations.Entities {
+		field := fmt.Sprintf("annotations.entities[%d]", i)
+		if entity.Start >= entity.End {
+			errs = append(errs, ValidationError{Field: field + ".start", Reason: fmt.Sprintf("start %d must be smaller than end %d", entity.Start, entity.End)})
+		}
+
+		if entity.End > textLength {
+			errs = append(errs, ValidationError{Field: field + ".end", Reason: fmt.Sprintf("end %d is out of range, text length is %d", entity.End, textLength)})
+		}
+	}
+
+	return errs
+}
+
+// ValidateAnnotationTags checks that all the used tags are declared in the metadata, a dataset without
+// declared tags accepts no tagged annotations. The check is skipped when metadata is nil, i.e. not known yet.
+func ValidateAnnotationTags(annotations *AnnotationData, metadata *Metadata) ValidationErrors {
+	var errs ValidationErrors
+	if metadata == nil {
+		return errs
+	}
+
+	for i, entity := range annotations.Entities {
+		if entity.Tag.Valid && !metadata.HasEntityTag(entity.Tag.String) {
+			errs = append(errs, ValidationError{Field: fmt.Sprintf("annotations.entities[%d].tag", i), Reason: fmt.Sprintf("unknown entity tag %q", entity.Tag.String)})
+		}
+	}
+
+	for i, relationship := range annotations.Relationships {
+		if !metadata.HasRelationshipTag(relationship.Name) {
+			errs = append(errs, ValidationError{Field: fmt.Sprintf("annotations.relationships[%d].name", i), Reason: fmt.Sprintf("unknown relationship tag %q", relationship.Name)})
+		}
+	}
+
+	return errs
+}
+
+// validateRelationshipConstraints checks that the relationships link the entity tags allowed by their tag
+func validateRelationshipConstraints(annotations *AnnotationData, metadata *Metadata) ValidationErrors {
+	var errs ValidationErrors
+	if metadata == nil {
+		return errs
+	}
+
+	entityTags := map[uint]null.String{}
+	for _, entity := range annotations.Entities {
+		entityTags[entity.Id] = entity.Tag
+	}
+
+	for i, relationship := range annotations.Relationships {
+		tag := metadata.RelationshipTag(relationship.Name)
+		if tag == nil || !tag.HasConstraints() {
+			continue
+		}
+
+		source, target := entityTags[relationship.Entity1], entityTags[relationship.Entity2]
+		if !tag.Allows(source, target) {
+			errs = append(errs, ValidationError{
+				Field:  fmt.Sprintf("annotations.relationships[%d]", i),
+				Reason: fmt.Sprintf("relationship %q cannot link %s to %s", relationship.Name, describeTag(source), describeTag(target)),
+			})
+		}
+	}
+
+	return errs
+}
+
+func describeTag(tag null.String) string {
+	if !tag.Valid {
+		return "an untagged entity"
+	}
+
+	return fmt.Sprintf("%q", tag.String)
+}
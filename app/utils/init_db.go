@@ -11,20 +11,41 @@ import (
 	"gorm.io/gorm"
 )
 
+type DBBackend string
+
+const (
+	SQLiteBackend DBBackend = "sqlite"
+	MySQLBackend  DBBackend = "mysql"
+)
+
+// GetDBBackend returns the database backend configured by the environment, SQLite takes precedence over MySQL
+func GetDBBackend() (DBBackend, error) {
+	if os.Getenv("SQLITE_FILE_PATH") != "" {
+		return SQLiteBackend, nil
+	} else if os.Getenv("MYSQL_HOST") != "" {
+		return MySQLBackend, nil
+	}
+
+	return "", errors.New("DB not configured")
+}
+
 func Init_db() (*gorm.DB, error) {
+	backend, backendErr := GetDBBackend()
+	if backendErr != nil {
+		return nil, backendErr
+	}
+
 	var db *gorm.DB
 	var err error
-	if sqliteFilePath := os.Getenv("SQLITE_FILE_PATH"); sqliteFilePath != "" {
-		db, err = gorm.Open(sqlite.Open(sqliteFilePath))
-
-	} else if mysqlHost := os.Getenv("MYSQL_HOST"); mysqlHost != "" {
+	switch backend {
+	case SQLiteBackend:
+		db, err = gorm.Open(sqlite.Open(os.Getenv("SQLITE_FILE_PATH")))
+	case MySQLBackend:
 		user := os.Getenv("MYSQL_USER")
 		pass := os.Getenv("MYSQL_PASS")
 		dbName := os.Getenv("MYSQL_DBNAME")
-		dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", user, pass, mysqlHost, dbName)
+		dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", user, pass, os.Getenv("MYSQL_HOST"), dbName)
 		db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
-	} else {
-		return nil, errors.New("DB not configured")
 	}
 
 	if err != nil {
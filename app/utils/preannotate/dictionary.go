@@ -0,0 +1,195 @@
+package preannotate
+
+import (
+	dataset "backend/app/utils/dataset"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/guregu/null.v4"
+)
+
+// DictionaryRule tags the whole word occurrences of the terms and the matches of the pattern,
+// matching is case insensitive unless CaseSensitive is set
+type DictionaryRule struct {
+	Tag           string   `json:"tag"`
+	Terms         []string `json:"terms"`
+	Pattern       string   `json:"pattern"`
+	CaseSensitive bool     `json:"case_sensitive"`
+}
+
+type dictionaryRule struct {
+	tag     string
+	terms   *regexp.Regexp
+	pattern *regexp.Regexp
+}
+
+// DictionaryPreAnnotator tags the spans matched by its rules. Overlapping matches are resolved in favor
+// of the earliest one, then of the longest one and then of the first rule.
+type DictionaryPreAnnotator struct {
+	rules []dictionaryRule
+}
+
+// DictionaryMatch is a span matched by the rule with the given index, its offsets count runes
+type DictionaryMatch struct {
+	Rule  int
+	Start uint
+	End   uint
+}
+
+type dictionaryMatch struct {
+	rule  int
+	start int
+	end   int
+}
+
+func NewDictionaryPreAnnotator(rules []DictionaryRule) (*DictionaryPreAnnotator, error) {
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("%w: the dictionary has no rules", ErrInvalidConfig)
+	}
+
+	dictionary := &DictionaryPreAnnotator{}
+	for i, rule := range rules {
+		if rule.Tag == "" {
+			return nil, fmt.Errorf("%w: rule %d has no tag", ErrInvalidConfig, i)
+		}
+
+		compiled := dictionaryRule{tag: rule.Tag}
+		compile := func(expression string) (*regexp.Regexp, error) {
+			if expression == "" {
+				return nil, nil
+			} else if !rule.CaseSensitive {
+				expression = "(?i)" + expression
+			}
+
+			pattern, compileErr := regexp.Compile(expression)
+			if compileErr != nil {
+				return nil, fmt.Errorf("%w: rule %d: %v", ErrInvalidConfig, i, compileErr)
+			}
+			return pattern, nil
+		}
+
+		var compileErr error
+		if compiled.terms, compileErr = compile(termsPattern(rule.Terms)); compileErr != nil {
+			return nil, compileErr
+		}
+		if compiled.pattern, compileErr = compile(rule.Pattern); compileErr != nil {
+			return nil, compileErr
+		}
+
+		if compiled.terms == nil && compiled.pattern == nil {
+			return nil, fmt.Errorf("%w: rule %d has neither terms nor a pattern", ErrInvalidConfig, i)
+		}
+
+		dictionary.rules = append(dictionary.rules, compiled)
+	}
+
+	return dictionary, nil
+}
+
+// termsPattern matches the longest terms first
+func termsPattern(terms []string) string {
+	sorted := make([]string, 0, len(terms))
+	for _, term := range terms {
+		if term = strings.TrimSpace(term); term != "" {
+			sorted = append(sorted, term)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+
+	quoted := make([]string, len(sorted))
+	for i, term := range sorted {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+
+	return strings.Join(quoted, "|")
+}
+
+// isWholeWord checks that the match does not start or end inside a word, the \b of regexp only knows ASCII words
+func isWholeWord(text string, start int, end int) bool {
+	first, _ := utf8.DecodeRuneInString(text[start:])
+	before, _ := utf8.DecodeLastRuneInString(text[:start])
+	if start > 0 && isWordRune(first) && isWordRune(before) {
+		return false
+	}
+
+	last, _ := utf8.DecodeLastRuneInString(text[:end])
+	after, _ := utf8.DecodeRuneInString(text[end:])
+	return end == len(text) || !isWordRune(last) || !isWordRune(after)
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func (d *DictionaryPreAnnotator) PreAnnotate(text string, tags *dataset.Metadata) ([]dataset.Entity, []dataset.Relationship, error) {
+	matches := d.Match(text)
+	entities := make([]dataset.Entity, len(matches))
+	for i, match := range matches {
+		entities[i] = dataset.Entity{
+			Id:    uint(i + 1),
+			Start: match.Start,
+			End:   match.End,
+			Tag:   null.StringFrom(d.rules[match.Rule].tag),
+		}
+	}
+
+	return entities, []dataset.Relationship{}, nil
+}
+
+// Match returns the spans matched by the rules without overlaps, ordered by their start
+func (d *DictionaryPreAnnotator) Match(text string) []DictionaryMatch {
+	var matches []dictionaryMatch
+	for i, rule := range d.rules {
+		if rule.terms != nil {
+			for _, location := range rule.terms.FindAllStringIndex(text, -1) {
+				if isWholeWord(text, location[0], location[1]) {
+					matches = append(matches, dictionaryMatch{rule: i, start: location[0], end: location[1]})
+				}
+			}
+		}
+
+		if rule.pattern != nil {
+			for _, location := range rule.pattern.FindAllStringIndex(text, -1) {
+				if location[1] > location[0] {
+					matches = append(matches, dictionaryMatch{rule: i, start: location[0], end: location[1]})
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].start != matches[j].start {
+			return matches[i].start < matches[j].start
+		}
+		if matches[i].end != matches[j].end {
+			return matches[i].end > matches[j].end
+		}
+		return matches[i].rule < matches[j].rule
+	})
+
+	// entity offsets count runes, the matches bytes
+	runeOffsets := make([]uint, len(text)+1)
+	offset := uint(0)
+	for i := range text {
+		runeOffsets[i] = offset
+		offset++
+	}
+	runeOffsets[len(text)] = offset
+
+	result := []DictionaryMatch{}
+	end := 0
+	for _, match := range matches {
+		if match.start < end {
+			continue
+		}
+
+		result = append(result, DictionaryMatch{Rule: match.rule, Start: runeOffsets[match.start], End: runeOffsets[match.end]})
+		end = match.end
+	}
+
+	return result
+}
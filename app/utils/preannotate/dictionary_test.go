@@ -0,0 +1,49 @@
+package preannotate
+
+import (
+	dataset "backend/app/utils/dataset"
+	"errors"
+	"testing"
+
+	"github.com/matryer/is"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestDictionaryPreAnnotator(t *testing.T) {
+	is := is.New(t)
+
+	model, modelErr := NewModel(&Config{Backend: DictionaryBackend, Rules: []DictionaryRule{
+		{Tag: "ORG", Terms: []string{"Acme", "Acme Corp"}},
+		{Tag: "PER", Terms: []string{"Zoë"}, CaseSensitive: true},
+		{Tag: "MONEY", Pattern: `\$[0-9]+`},
+		{Tag: "LOC", Terms: []string{"Paris"}},
+	}}, nil)
+	is.NoErr(modelErr)
+
+	tags := &dataset.Metadata{EntityTags: []dataset.Tag{{Name: "ORG"}, {Name: "PER"}, {Name: "MONEY"}}}
+	annotations, annotateErr := model.Annotate("Zoë paid acme corp $300 in Paris, not zoë or Acmeville", tags)
+	is.NoErr(annotateErr)
+
+	is.Equal(annotations.Entities, []dataset.Entity{
+		{Id: 1, Start: 0, End: 3, Tag: null.StringFrom("PER"), Model: "dictionary"},
+		{Id: 2, Start: 9, End: 18, Tag: null.StringFrom("ORG"), Model: "dictionary"},
+		{Id: 3, Start: 19, End: 23, Tag: null.StringFrom("MONEY"), Model: "dictionary"},
+	})
+	is.Equal(len(annotations.Relationships), 0)
+}
+
+func TestInvalidDictionaryConfig(t *testing.T) {
+	is := is.New(t)
+
+	_, modelErr := NewModel(&Config{Backend: DictionaryBackend}, nil)
+	is.True(errors.Is(modelErr, ErrInvalidConfig))
+
+	_, modelErr = NewModel(&Config{Backend: DictionaryBackend, Rules: []DictionaryRule{{Tag: "PER", Pattern: "("}}}, nil)
+	is.True(errors.Is(modelErr, ErrInvalidConfig))
+
+	_, modelErr = NewModel(&Config{Backend: DictionaryBackend, Rules: []DictionaryRule{{Terms: []string{"John"}}}}, nil)
+	is.True(errors.Is(modelErr, ErrInvalidConfig))
+
+	_, modelErr = NewModel(&Config{Backend: "spacy"}, nil)
+	is.True(errors.Is(modelErr, ErrInvalidConfig))
+}
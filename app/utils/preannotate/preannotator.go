@@ -0,0 +1,145 @@
+package preannotate
+
+import (
+	dataset "backend/app/utils/dataset"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PreAnnotator labels a text with the tags of a dataset before users annotate it.
+// The returned entities and relationships may be invalid, Model.Annotate drops them.
+type PreAnnotator interface {
+	PreAnnotate(text string, tags *dataset.Metadata) ([]dataset.Entity, []dataset.Relationship, error)
+}
+
+type Backend string
+
+const (
+	WebhookBackend    Backend = "webhook"
+	DictionaryBackend Backend = "dictionary"
+)
+
+const defaultWebhookTimeout = 30 * time.Second
+
+var ErrInvalidConfig = errors.New("invalid pre-annotator config")
+
+var ErrPreAnnotationFailed = errors.New("pre-annotation failed")
+
+// Config selects and configures a pre-annotator, the name marks the spans it generates and defaults to the backend
+type Config struct {
+	Backend        Backend          `json:"backend"`
+	Name           string           `json:"name"`
+	URL            string           `json:"url"`
+	TimeoutSeconds int              `json:"timeout_seconds"`
+	Rules          []DictionaryRule `json:"rules"`
+}
+
+// Model is a configured pre-annotator
+type Model struct {
+	Name         string
+	PreAnnotator PreAnnotator
+}
+
+// NewModel builds the pre-annotator of the config, webhooks can only post to one of the webhookUrls
+// so that users cannot make the server send requests to arbitrary hosts
+func NewModel(config *Config, webhookUrls []string) (*Model, error) {
+	model := &Model{Name: config.Name}
+	if model.Name == "" {
+		model.Name = string(config.Backend)
+	}
+
+	switch config.Backend {
+	case WebhookBackend:
+		if !isAllowedWebhook(config.URL, webhookUrls) {
+			return nil, fmt.Errorf("%w: webhook url %q is not allowed", ErrInvalidConfig, config.URL)
+		}
+
+		timeout := defaultWebhookTimeout
+		if config.TimeoutSeconds > 0 {
+			timeout = time.Duration(config.TimeoutSeconds) * time.Second
+		}
+
+		webhook, webhookErr := NewWebhookPreAnnotator(config.URL, timeout)
+		if webhookErr != nil {
+			return nil, webhookErr
+		}
+		model.PreAnnotator = webhook
+	case DictionaryBackend:
+		dictionary, dictionaryErr := NewDictionaryPreAnnotator(config.Rules)
+		if dictionaryErr != nil {
+			return nil, dictionaryErr
+		}
+		model.PreAnnotator = dictionary
+	default:
+		return nil, fmt.Errorf("%w: unknown backend %q", ErrInvalidConfig, config.Backend)
+	}
+
+	return model, nil
+}
+
+func isAllowedWebhook(webhookUrl string, webhookUrls []string) bool {
+	for _, allowed := range webhookUrls {
+		if webhookUrl == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Annotate runs the pre-annotator and keeps the entities and relationships that are valid for the text and the tags.
+// They are numbered from 1 and marked with the name of the model.
+func (m *Model) Annotate(text string, tags *dataset.Metadata) (*dataset.AnnotationData, error) {
+	entities, relationships, annotateErr := m.PreAnnotator.PreAnnotate(text, tags)
+	if annotateErr != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPreAnnotationFailed, annotateErr)
+	}
+
+	annotations := &dataset.AnnotationData{Entities: []dataset.Entity{}, Relationships: []dataset.Relationship{}}
+	textLength := dataset.TextLength(text)
+	entityIds := map[uint]uint{}
+
+	for _, entity := range entities {
+		if entity.Start >= entity.End || entity.End > textLength || !entity.Tag.Valid {
+			continue
+		}
+
+		if _, duplicate := entityIds[entity.Id]; duplicate {
+			continue
+		}
+
+		if tags != nil && len(tags.EntityTags) > 0 && !tags.HasEntityTag(entity.Tag.String) {
+			continue
+		}
+
+		newId := uint(len(annotations.Entities) + 1)
+		entityIds[entity.Id] = newId
+		entity.Id = newId
+		entity.Model = m.Name
+		annotations.Entities = append(annotations.Entities, entity)
+	}
+
+	for _, relationship := range relationships {
+		entity1, ok1 := entityIds[relationship.Entity1]
+		entity2, ok2 := entityIds[relationship.Entity2]
+		if !ok1 || !ok2 {
+			continue
+		}
+
+		if tags != nil && len(tags.RelationshipTags) > 0 {
+			tag := tags.RelationshipTag(relationship.Name)
+			if tag == nil || !tag.Allows(annotations.Entities[entity1-1].Tag, annotations.Entities[entity2-1].Tag) {
+				continue
+			}
+		}
+
+		relationship.Id = uint(len(annotations.Relationships) + 1)
+		relationship.Entity1 = entity1
+		relationship.Entity2 = entity2
+		relationship.Model = m.Name
+		annotations.Relationships = append(annotations.Relationships, relationship)
+	}
+
+	return annotations, nil
+}
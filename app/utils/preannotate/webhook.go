@@ -0,0 +1,71 @@
+package preannotate
+
+import (
+	dataset "backend/app/utils/dataset"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const maxWebhookResponseSize = 10 << 20
+
+type webhookRequest struct {
+	Text     string            `json:"text"`
+	Metadata *dataset.Metadata `json:"metadata"`
+}
+
+type webhookResponse struct {
+	Entities      []dataset.Entity       `json:"entities"`
+	Relationships []dataset.Relationship `json:"relationships"`
+}
+
+// WebhookPreAnnotator posts the text and the tags of the dataset as JSON to a model server,
+// which answers with the entities and relationships in the format of the sample annotations
+type WebhookPreAnnotator struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewWebhookPreAnnotator(webhookUrl string, timeout time.Duration) (*WebhookPreAnnotator, error) {
+	parsedUrl, parsingErr := url.Parse(webhookUrl)
+	if parsingErr != nil || (parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https") || parsedUrl.Host == "" {
+		return nil, fmt.Errorf("%w: invalid webhook url %q", ErrInvalidConfig, webhookUrl)
+	}
+
+	return &WebhookPreAnnotator{
+		URL:    webhookUrl,
+		Client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (w *WebhookPreAnnotator) PreAnnotate(text string, tags *dataset.Metadata) ([]dataset.Entity, []dataset.Relationship, error) {
+	if tags == nil {
+		tags = &dataset.Metadata{}
+	}
+
+	body, marshalErr := json.Marshal(webhookRequest{Text: text, Metadata: tags})
+	if marshalErr != nil {
+		return nil, nil, marshalErr
+	}
+
+	response, requestErr := w.Client.Post(w.URL, "application/json", bytes.NewReader(body))
+	if requestErr != nil {
+		return nil, nil, requestErr
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("webhook returned %s", response.Status)
+	}
+
+	result := &webhookResponse{}
+	if decodeErr := json.NewDecoder(io.LimitReader(response.Body, maxWebhookResponseSize)).Decode(result); decodeErr != nil {
+		return nil, nil, fmt.Errorf("invalid webhook response: %v", decodeErr)
+	}
+
+	return result.Entities, result.Relationships, nil
+}
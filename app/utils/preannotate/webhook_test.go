@@ -0,0 +1,82 @@
+package preannotate
+
+import (
+	dataset "backend/app/utils/dataset"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/matryer/is"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestWebhookPreAnnotator(t *testing.T) {
+	is := is.New(t)
+
+	var received webhookRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Write([]byte(`{
+			"entities": [
+				{"id": 10, "start": 0, "end": 4, "tag": "PER"},
+				{"id": 11, "start": 15, "end": 19, "tag": "ORG"},
+				{"id": 12, "start": 15, "end": 40, "tag": "ORG"},
+				{"id": 13, "start": 5, "end": 10, "tag": "VERB"}
+			],
+			"relationships": [
+				{"id": 1, "entity1": 10, "entity2": 11, "name": "works_for"},
+				{"id": 2, "entity1": 11, "entity2": 10, "name": "works_for"},
+				{"id": 3, "entity1": 10, "entity2": 12, "name": "works_for"}
+			]
+		}`))
+	}))
+	defer server.Close()
+
+	model, modelErr := NewModel(&Config{Backend: WebhookBackend, Name: "ner-v2", URL: server.URL}, []string{server.URL})
+	is.NoErr(modelErr)
+
+	tags := &dataset.Metadata{
+		EntityTags:       []dataset.Tag{{Name: "PER"}, {Name: "ORG"}},
+		RelationshipTags: []dataset.Tag{{Name: "works_for", Sources: []string{"PER"}, Targets: []string{"ORG"}, Directed: true}},
+	}
+	annotations, annotateErr := model.Annotate("John works for Acme", tags)
+	is.NoErr(annotateErr)
+	is.Equal(received.Text, "John works for Acme")
+	is.Equal(len(received.Metadata.EntityTags), 2)
+
+	// invalid spans, unknown tags and relationships that break the constraints are dropped
+	is.Equal(annotations.Entities, []dataset.Entity{
+		{Id: 1, Start: 0, End: 4, Tag: null.StringFrom("PER"), Model: "ner-v2"},
+		{Id: 2, Start: 15, End: 19, Tag: null.StringFrom("ORG"), Model: "ner-v2"},
+	})
+	is.Equal(annotations.Relationships, []dataset.Relationship{
+		{Id: 1, Entity1: 1, Entity2: 2, Name: "works_for", Model: "ner-v2"},
+	})
+}
+
+func TestFailingWebhookPreAnnotator(t *testing.T) {
+	is := is.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	model, modelErr := NewModel(&Config{Backend: WebhookBackend, URL: server.URL}, []string{server.URL})
+	is.NoErr(modelErr)
+
+	_, annotateErr := model.Annotate("John", nil)
+	is.True(errors.Is(annotateErr, ErrPreAnnotationFailed))
+
+	_, modelErr = NewModel(&Config{Backend: WebhookBackend, URL: "file:///etc/passwd"}, []string{"file:///etc/passwd"})
+	is.True(errors.Is(modelErr, ErrInvalidConfig))
+
+	// only the configured model servers can be reached
+	_, modelErr = NewModel(&Config{Backend: WebhookBackend, URL: "http://169.254.169.254/latest/meta-data"}, []string{server.URL})
+	is.True(errors.Is(modelErr, ErrInvalidConfig))
+
+	_, modelErr = NewModel(&Config{Backend: WebhookBackend, URL: server.URL}, nil)
+	is.True(errors.Is(modelErr, ErrInvalidConfig))
+}
@@ -0,0 +1,125 @@
+package search
+
+import (
+	"backend/app/models"
+	"backend/app/utils"
+	dataset_utils "backend/app/utils/dataset"
+	"encoding/json"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// NoteSnippet is a matched note of an entity of the sample annotations, or of the annotation of a user
+type NoteSnippet struct {
+	EntityID uint `json:"entity_id"`
+	UserID   uint `json:"user_id,omitempty"`
+	Snippet
+}
+
+type Hit struct {
+	SampleID  uint           `json:"sample_id"`
+	DatasetID uint           `json:"dataset_id"`
+	Text      *Snippet       `json:"text"`
+	Notes     []*NoteSnippet `json:"notes"`
+}
+
+// Index searches the text and the entity notes of samples and of the annotations of their users
+type Index interface {
+	// Migrate creates the index and adds the existing samples to it
+	Migrate() error
+	// Search returns the best matching samples containing all the terms, a nil datasetIds searches every dataset
+	Search(terms []string, datasetIds []uint, limit int) ([]*Hit, error)
+}
+
+// NewIndex returns the full-text index of the backend, FTS5 for SQLite and a FULLTEXT index for MySQL
+func NewIndex(db *gorm.DB, backend utils.DBBackend) Index {
+	if backend == utils.MySQLBackend {
+		return &mysqlIndex{db: db}
+	}
+
+	return &sqliteIndex{db: db}
+}
+
+type sampleRow struct {
+	ID              uint
+	DatasetID       uint
+	Text            string
+	Annotations     datatypes.JSON
+	UserAnnotations []models.SampleAnnotation `gorm:"-"`
+}
+
+func searchSamples(db *gorm.DB, datasetIds []uint, limit int) ([]sampleRow, error) {
+	if datasetIds != nil {
+		db = db.Where("samples.dataset_id IN ?", datasetIds)
+	}
+
+	var rows []sampleRow
+	if dbErr := db.Where("samples.deleted_at IS NULL").Limit(limit).Scan(&rows).Error; dbErr != nil {
+		return nil, dbErr
+	}
+
+	if len(rows) == 0 {
+		return rows, nil
+	}
+
+	rowIndexes := map[uint]int{}
+	sampleIds := make([]uint, len(rows))
+	for i, row := range rows {
+		rowIndexes[row.ID] = i
+		sampleIds[i] = row.ID
+	}
+
+	var sampleAnnotations []models.SampleAnnotation
+	dbErr := db.Session(&gorm.Session{NewDB: true}).
+		Select("sample_id", "user_id", "annotations").
+		Where("sample_id IN ? AND annotations IS NOT NULL", sampleIds).
+		Order("id").
+		Find(&sampleAnnotations).Error
+	if dbErr != nil {
+		return nil, dbErr
+	}
+
+	for _, sampleAnnotation := range sampleAnnotations {
+		row := &rows[rowIndexes[sampleAnnotation.SampleID]]
+		row.UserAnnotations = append(row.UserAnnotations, sampleAnnotation)
+	}
+
+	return rows, nil
+}
+
+func makeHits(rows []sampleRow, terms []string) []*Hit {
+	hits := make([]*Hit, len(rows))
+	for i, row := range rows {
+		text, _ := MakeSnippet(row.Text, terms)
+		hit := &Hit{SampleID: row.ID, DatasetID: row.DatasetID, Text: text, Notes: []*NoteSnippet{}}
+
+		hit.Notes = appendNoteSnippets(hit.Notes, row.Annotations, 0, terms)
+		for _, sampleAnnotation := range row.UserAnnotations {
+			hit.Notes = appendNoteSnippets(hit.Notes, sampleAnnotation.Annotations, sampleAnnotation.UserID, terms)
+		}
+
+		hits[i] = hit
+	}
+
+	return hits
+}
+
+func appendNoteSnippets(snippets []*NoteSnippet, data datatypes.JSON, userId uint, terms []string) []*NoteSnippet {
+	annotations := &dataset_utils.AnnotationData{}
+	if len(data) == 0 || json.Unmarshal(data, annotations) != nil {
+		return snippets
+	}
+
+	for _, entity := range annotations.Entities {
+		if !entity.Notes.Valid {
+			continue
+		}
+
+		if notes, matched := MakeSnippet(entity.Notes.String, terms); matched {
+			snippets = append(snippets, &NoteSnippet{EntityID: entity.Id, UserID: userId, Snippet: *notes})
+		}
+	}
+
+	return snippets
+}
@@ -0,0 +1,104 @@
+package search
+
+import (
+	"backend/app/models"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const mysqlMatch = "MATCH(samples.text, samples.search_notes) AGAINST (? IN BOOLEAN MODE)"
+
+// mysqlIndex searches a FULLTEXT index over the text and a column holding the entity notes of the sample
+// and of the annotations of its users, triggers keep the column in sync
+type mysqlIndex struct {
+	db *gorm.DB
+}
+
+// mysqlNotes concatenates the entity notes of the sample and of the annotations of its users
+func mysqlNotes(row string) string {
+	return fmt.Sprintf(`CONCAT_WS(' ', JSON_UNQUOTE(JSON_EXTRACT(%s.annotations, '$.entities[*].notes')),
+		(SELECT GROUP_CONCAT(JSON_UNQUOTE(JSON_EXTRACT(sample_annotations.annotations, '$.entities[*].notes')) SEPARATOR ' ')
+			FROM sample_annotations WHERE sample_annotations.sample_id = %s.id AND sample_annotations.deleted_at IS NULL))`, row, row)
+}
+
+func (i *mysqlIndex) Migrate() error {
+	migrator := i.db.Migrator()
+
+	// the notes used to be a generated column of the sample annotations only
+	var generated int64
+	dbErr := i.db.Raw(`SELECT COUNT(*) FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'samples' AND COLUMN_NAME = 'search_notes' AND EXTRA LIKE '%GENERATED%'`).
+		Scan(&generated).Error
+	if dbErr != nil {
+		return dbErr
+	}
+
+	if generated > 0 {
+		if migrator.HasIndex(&models.Sample{}, "idx_samples_search") {
+			if dbErr := i.db.Exec("DROP INDEX idx_samples_search ON samples").Error; dbErr != nil {
+				return dbErr
+			}
+		}
+
+		if dbErr := i.db.Exec("ALTER TABLE samples DROP COLUMN search_notes").Error; dbErr != nil {
+			return dbErr
+		}
+	}
+
+	if !migrator.HasColumn(&models.Sample{}, "search_notes") {
+		if dbErr := i.db.Exec("ALTER TABLE samples ADD COLUMN search_notes LONGTEXT").Error; dbErr != nil {
+			return dbErr
+		}
+	}
+
+	statements := []string{
+		"DROP TRIGGER IF EXISTS sample_search_insert",
+		"DROP TRIGGER IF EXISTS sample_search_update",
+		"DROP TRIGGER IF EXISTS sample_annotation_search_insert",
+		"DROP TRIGGER IF EXISTS sample_annotation_search_update",
+		"DROP TRIGGER IF EXISTS sample_annotation_search_delete",
+		"CREATE TRIGGER sample_search_insert BEFORE INSERT ON samples FOR EACH ROW SET NEW.search_notes = " + mysqlNotes("NEW"),
+		"CREATE TRIGGER sample_search_update BEFORE UPDATE ON samples FOR EACH ROW SET NEW.search_notes = " + mysqlNotes("NEW"),
+		// updating the sample runs its trigger, which reads the notes of the users again
+		"CREATE TRIGGER sample_annotation_search_insert AFTER INSERT ON sample_annotations FOR EACH ROW UPDATE samples SET search_notes = NULL WHERE id = NEW.sample_id",
+		"CREATE TRIGGER sample_annotation_search_update AFTER UPDATE ON sample_annotations FOR EACH ROW UPDATE samples SET search_notes = NULL WHERE id = NEW.sample_id",
+		"CREATE TRIGGER sample_annotation_search_delete AFTER DELETE ON sample_annotations FOR EACH ROW UPDATE samples SET search_notes = NULL WHERE id = OLD.sample_id",
+		"UPDATE samples SET search_notes = " + mysqlNotes("samples"),
+	}
+
+	for _, statement := range statements {
+		if dbErr := i.db.Exec(statement).Error; dbErr != nil {
+			return dbErr
+		}
+	}
+
+	if !migrator.HasIndex(&models.Sample{}, "idx_samples_search") {
+		if dbErr := i.db.Exec("CREATE FULLTEXT INDEX idx_samples_search ON samples (text, search_notes)").Error; dbErr != nil {
+			return dbErr
+		}
+	}
+
+	return nil
+}
+
+func (i *mysqlIndex) Search(terms []string, datasetIds []uint, limit int) ([]*Hit, error) {
+	required := make([]string, len(terms))
+	for j, term := range terms {
+		required[j] = "+" + term
+	}
+	query := strings.Join(required, " ")
+
+	db := i.db.Table("samples").
+		Select("samples.id, samples.dataset_id, samples.text, samples.annotations, "+mysqlMatch+" AS score", query).
+		Where(mysqlMatch, query).
+		Order("score DESC")
+
+	rows, searchErr := searchSamples(db, datasetIds, limit)
+	if searchErr != nil {
+		return nil, searchErr
+	}
+
+	return makeHits(rows, terms), nil
+}
@@ -0,0 +1,118 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// snippetRadius is the number of runes kept around the first match of a snippet
+const snippetRadius = 60
+
+const ellipsis = "…"
+
+// Highlight marks a matched word of a snippet, offsets are runes
+type Highlight struct {
+	Start uint `json:"start"`
+	End   uint `json:"end"`
+}
+
+type Snippet struct {
+	Text       string      `json:"text"`
+	Highlights []Highlight `json:"highlights"`
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// Terms splits a search query into its distinct lower case words
+func Terms(query string) []string {
+	var terms []string
+	seen := map[string]bool{}
+	for _, term := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool { return !isWordRune(r) }) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+
+	return terms
+}
+
+// findTerms returns the rune offsets of the words of the text that are one of the terms
+func findTerms(runes []rune, terms []string) []Highlight {
+	var matches []Highlight
+	for start := 0; start < len(runes); {
+		if !isWordRune(runes[start]) {
+			start++
+			continue
+		}
+
+		end := start
+		for end < len(runes) && isWordRune(runes[end]) {
+			end++
+		}
+
+		word := strings.ToLower(string(runes[start:end]))
+		for _, term := range terms {
+			if word == term {
+				matches = append(matches, Highlight{Start: uint(start), End: uint(end)})
+				break
+			}
+		}
+		start = end
+	}
+
+	return matches
+}
+
+// MakeSnippet cuts the text around the first of its words that is one of the terms and highlights the matched words.
+// It reports whether any term was found, a text without matches is cut from its start.
+func MakeSnippet(text string, terms []string) (*Snippet, bool) {
+	runes := []rune(text)
+	matches := findTerms(runes, terms)
+
+	start, end := 0, 2*snippetRadius
+	if len(matches) > 0 {
+		start = int(matches[0].Start) - snippetRadius
+		end = int(matches[0].End) + snippetRadius
+	}
+
+	if start < 0 {
+		start = 0
+	}
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	// do not cut words in half
+	for start > 0 && isWordRune(runes[start-1]) {
+		start--
+	}
+	for end < len(runes) && isWordRune(runes[end]) {
+		end++
+	}
+
+	var builder strings.Builder
+	offset := uint(0)
+	if start > 0 {
+		builder.WriteString(ellipsis)
+		offset = 1
+	}
+	builder.WriteString(string(runes[start:end]))
+	if end < len(runes) {
+		builder.WriteString(ellipsis)
+	}
+
+	snippet := &Snippet{Text: builder.String(), Highlights: []Highlight{}}
+	for _, match := range matches {
+		if int(match.Start) >= start && int(match.End) <= end {
+			snippet.Highlights = append(snippet.Highlights, Highlight{
+				Start: match.Start - uint(start) + offset,
+				End:   match.End - uint(start) + offset,
+			})
+		}
+	}
+
+	return snippet, len(matches) > 0
+}
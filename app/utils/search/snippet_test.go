@@ -0,0 +1,54 @@
+package search
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestTerms(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(Terms(`Acme "Corp" acme, AND zürich*`), []string{"acme", "corp", "and", "zürich"})
+	is.Equal(len(Terms(" -*\" ")), 0)
+}
+
+func TestMakeSnippet(t *testing.T) {
+	is := is.New(t)
+
+	snippet, matched := MakeSnippet("Zürich is where Acme was founded, acme grew there.", []string{"acme"})
+	is.True(matched)
+	is.Equal(snippet.Text, "Zürich is where Acme was founded, acme grew there.")
+	is.Equal(snippet.Highlights, []Highlight{{Start: 16, End: 20}, {Start: 34, End: 38}})
+
+	// words containing the term are not matches
+	_, matched = MakeSnippet("Acmes and acmeish", []string{"acme"})
+	is.True(!matched)
+}
+
+func TestMakeSnippetOfLongText(t *testing.T) {
+	is := is.New(t)
+
+	text := strings.Repeat("lorem ipsum ", 20) + "the Acme company " + strings.Repeat("dolor sit ", 20)
+	snippet, matched := MakeSnippet(text, []string{"acme"})
+	is.True(matched)
+
+	is.True(strings.HasPrefix(snippet.Text, ellipsis))
+	is.True(strings.HasSuffix(snippet.Text, ellipsis))
+	is.True(len([]rune(snippet.Text)) < len([]rune(text)))
+
+	// the snippet starts and ends at word boundaries
+	cut := strings.TrimSuffix(strings.TrimPrefix(snippet.Text, ellipsis), ellipsis)
+	is.True(strings.Contains(text, " "+cut+" "))
+
+	is.Equal(len(snippet.Highlights), 1)
+	highlight := snippet.Highlights[0]
+	is.Equal(string([]rune(snippet.Text)[highlight.Start:highlight.End]), "Acme")
+
+	// texts without matches are cut from the start
+	snippet, matched = MakeSnippet(text, []string{"missing"})
+	is.True(!matched)
+	is.True(strings.HasPrefix(snippet.Text, "lorem ipsum"))
+	is.Equal(len(snippet.Highlights), 0)
+}
@@ -0,0 +1,118 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ErrFTS5Unavailable is returned when SQLite was built without FTS5, the backend has to be built with the sqlite_fts5 tag
+var ErrFTS5Unavailable = errors.New("the SQLite full-text index needs FTS5, build with -tags json1,sqlite_fts5")
+
+// sqliteIndex keeps an FTS5 table in sync with the samples and the annotations of their users by triggers,
+// the rowid of the table is the sample id
+type sqliteIndex struct {
+	db *gorm.DB
+}
+
+// sqliteNotes concatenates the entity notes of the sample and of the annotations of its users
+func sqliteNotes(row string) string {
+	return fmt.Sprintf(`COALESCE((SELECT group_concat(json_extract(value, '$.notes'), ' ') FROM json_each(%s.annotations, '$.entities')), '') || ' ' ||
+		COALESCE((SELECT group_concat(json_extract(entities.value, '$.notes'), ' ')
+			FROM sample_annotations, json_each(sample_annotations.annotations, '$.entities') AS entities
+			WHERE sample_annotations.sample_id = %s.id AND sample_annotations.deleted_at IS NULL), '')`, row, row)
+}
+
+// sqliteReindex replaces the row of the sample in the index
+func sqliteReindex(sampleId string) string {
+	return fmt.Sprintf(`DELETE FROM sample_search WHERE rowid = %s;
+			INSERT INTO sample_search(rowid, text, notes) SELECT id, text, %s FROM samples WHERE id = %s;`, sampleId, sqliteNotes("samples"), sampleId)
+}
+
+var sqliteTriggers = []string{
+	"sample_search_insert",
+	"sample_search_update",
+	"sample_search_delete",
+	"sample_annotation_search_insert",
+	"sample_annotation_search_update",
+	"sample_annotation_search_delete",
+}
+
+func (i *sqliteIndex) Migrate() error {
+	// indexes created before the notes of the users were indexed are rebuilt
+	var triggers int64
+	dbErr := i.db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = ?", sqliteTriggers[len(sqliteTriggers)-1]).Scan(&triggers).Error
+	if dbErr != nil {
+		return dbErr
+	}
+
+	if i.db.Migrator().HasTable("sample_search") && triggers > 0 {
+		return nil
+	}
+
+	var statements []string
+	for _, trigger := range sqliteTriggers {
+		statements = append(statements, "DROP TRIGGER IF EXISTS "+trigger)
+	}
+
+	statements = append(statements,
+		"DROP TABLE IF EXISTS sample_search",
+		"CREATE VIRTUAL TABLE sample_search USING fts5(text, notes)",
+		"INSERT INTO sample_search(rowid, text, notes) SELECT id, text, "+sqliteNotes("samples")+" FROM samples",
+		`CREATE TRIGGER sample_search_insert AFTER INSERT ON samples BEGIN
+			INSERT INTO sample_search(rowid, text, notes) VALUES (NEW.id, NEW.text, `+sqliteNotes("NEW")+`);
+		END`,
+		`CREATE TRIGGER sample_search_update AFTER UPDATE OF text, annotations ON samples BEGIN
+			DELETE FROM sample_search WHERE rowid = OLD.id;
+			INSERT INTO sample_search(rowid, text, notes) VALUES (NEW.id, NEW.text, `+sqliteNotes("NEW")+`);
+		END`,
+		`CREATE TRIGGER sample_search_delete AFTER DELETE ON samples BEGIN
+			DELETE FROM sample_search WHERE rowid = OLD.id;
+		END`,
+		`CREATE TRIGGER sample_annotation_search_insert AFTER INSERT ON sample_annotations BEGIN
+			`+sqliteReindex("NEW.sample_id")+`
+		END`,
+		`CREATE TRIGGER sample_annotation_search_update AFTER UPDATE OF annotations, deleted_at ON sample_annotations BEGIN
+			`+sqliteReindex("NEW.sample_id")+`
+		END`,
+		`CREATE TRIGGER sample_annotation_search_delete AFTER DELETE ON sample_annotations BEGIN
+			`+sqliteReindex("OLD.sample_id")+`
+		END`,
+	)
+
+	return i.db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			if dbErr := tx.Exec(statement).Error; dbErr != nil {
+				if strings.Contains(dbErr.Error(), "no such module: fts5") {
+					return ErrFTS5Unavailable
+				}
+				return dbErr
+			}
+		}
+
+		return nil
+	})
+}
+
+func (i *sqliteIndex) Search(terms []string, datasetIds []uint, limit int) ([]*Hit, error) {
+	// the terms only hold letters and numbers, quoting them keeps FTS5 from reading them as operators
+	quoted := make([]string, len(terms))
+	for j, term := range terms {
+		quoted[j] = `"` + term + `"`
+	}
+
+	db := i.db.Table("sample_search").
+		Select("samples.id, samples.dataset_id, samples.text, samples.annotations").
+		Joins("JOIN samples ON samples.id = sample_search.rowid").
+		Where("sample_search MATCH ?", strings.Join(quoted, " ")).
+		Order("sample_search.rank")
+
+	rows, searchErr := searchSamples(db, datasetIds, limit)
+	if searchErr != nil {
+		return nil, searchErr
+	}
+
+	return makeHits(rows, terms), nil
+}
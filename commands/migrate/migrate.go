@@ -3,8 +3,11 @@ package main
 import (
 	"backend/app/models"
 	"backend/app/utils"
+	"backend/app/utils/search"
 	"github.com/joho/godotenv"
+	"gorm.io/gorm"
 	"log"
+	"time"
 )
 
 func main() {
@@ -28,6 +31,26 @@ func main() {
 		return
 	}
 
+	if migrationErr := db.AutoMigrate(&models.SampleAnnotation{}); migrationErr != nil {
+		log.Fatal(migrationErr)
+		return
+	}
+
+	if migrationErr := migrateSampleAssignments(db); migrationErr != nil {
+		log.Fatal(migrationErr)
+		return
+	}
+
+	if migrationErr := db.AutoMigrate(&models.SampleRevision{}); migrationErr != nil {
+		log.Fatal(migrationErr)
+		return
+	}
+
+	if migrationErr := db.AutoMigrate(&models.LabelingRule{}); migrationErr != nil {
+		log.Fatal(migrationErr)
+		return
+	}
+
 	if migrationErr := db.AutoMigrate(&models.User{}); migrationErr != nil {
 		log.Fatal(migrationErr)
 		return
@@ -48,5 +71,58 @@ func main() {
 		return
 	}
 
+	if migrationErr := db.AutoMigrate(&models.APIKey{}); migrationErr != nil {
+		log.Fatal(migrationErr)
+		return
+	}
+
+	backend, backendErr := utils.GetDBBackend()
+	if backendErr != nil {
+		log.Fatal(backendErr)
+		return
+	}
+
+	if migrationErr := search.NewIndex(db, backend).Migrate(); migrationErr != nil {
+		log.Fatal(migrationErr)
+		return
+	}
+
 	log.Println("Migration successful!")
 }
+
+// migrateSampleAssignments moves the assignments kept on the samples before per-user annotations were introduced
+// to sample annotations and drops the old columns. Pending assignments without a lease get one that has already expired.
+func migrateSampleAssignments(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&models.Sample{}, "assigned_to") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		// only databases migrated while samples had their own lease keep its expiration
+		leaseExpiresAt := "?"
+		if tx.Migrator().HasColumn(&models.Sample{}, "lease_expires_at") {
+			leaseExpiresAt = "COALESCE(samples.lease_expires_at, ?)"
+		}
+
+		now := time.Now()
+		insertErr := tx.Exec(`INSERT INTO sample_annotations (created_at, updated_at, sample_id, user_id, slot, annotations, status, lease_expires_at)
+			SELECT ?, ?, samples.id, samples.assigned_to, 0, samples.annotations, samples.status,
+				CASE WHEN samples.status IS NULL THEN `+leaseExpiresAt+` ELSE NULL END
+			FROM samples
+			WHERE samples.assigned_to IS NOT NULL AND samples.deleted_at IS NULL
+				AND NOT EXISTS (SELECT 1 FROM sample_annotations WHERE sample_annotations.sample_id = samples.id)`, now, now, now).Error
+		if insertErr != nil {
+			return insertErr
+		}
+
+		if dropErr := tx.Migrator().DropColumn(&models.Sample{}, "assigned_to"); dropErr != nil {
+			return dropErr
+		}
+
+		if tx.Migrator().HasColumn(&models.Sample{}, "lease_expires_at") {
+			return tx.Migrator().DropColumn(&models.Sample{}, "lease_expires_at")
+		}
+
+		return nil
+	})
+}
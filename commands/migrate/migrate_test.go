@@ -0,0 +1,97 @@
+package main
+
+import (
+	"backend/app/models"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"gopkg.in/guregu/null.v4"
+	"gorm.io/datatypes"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// baselineSample is the sample table before per-user annotations were introduced
+type baselineSample struct {
+	gorm.Model
+	DatasetID   uint
+	Annotations datatypes.JSON
+	Metadata    datatypes.JSON
+	Status      null.String
+	Text        string
+	AssignedTo  null.Int
+}
+
+func (baselineSample) TableName() string {
+	return "samples"
+}
+
+func setupDBForMigrateTests(t *testing.T) (*gorm.DB, func() error) {
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+
+	if err != nil {
+		t.Fatalf("failed to open sqlite connection: %v", err)
+	}
+
+	if migrationErr := db.AutoMigrate(&models.Dataset{}, &baselineSample{}); migrationErr != nil {
+		t.Fatalf("failed to migrate the baseline schema: %v", migrationErr)
+	}
+
+	sqlDB, sqlErr := db.DB()
+	if sqlErr != nil {
+		t.Fatalf("failed to obtain SQL DB: %v", sqlErr)
+	}
+	return db, sqlDB.Close
+}
+
+func TestMigrateSampleAssignmentsFromBaseline(t *testing.T) {
+	db, cleanup := setupDBForMigrateTests(t)
+	defer cleanup()
+
+	is := is.New(t)
+
+	dataset := &models.Dataset{Name: "dataset1", Type: models.EntityAnnotation}
+	is.NoErr(db.Create(dataset).Error)
+
+	annotations := datatypes.JSON(`{"entities": [], "relationships": []}`)
+	samples := []baselineSample{
+		{DatasetID: dataset.ID, Text: "pending", AssignedTo: null.IntFrom(1)},
+		{DatasetID: dataset.ID, Text: "done", AssignedTo: null.IntFrom(2), Annotations: annotations, Status: models.Accepted.ToNullString()},
+		{DatasetID: dataset.ID, Text: "unassigned"},
+	}
+	is.NoErr(db.Create(&samples).Error)
+
+	is.NoErr(db.AutoMigrate(&models.Sample{}, &models.SampleAnnotation{}))
+	is.True(!db.Migrator().HasColumn(&models.Sample{}, "lease_expires_at"))
+
+	before := time.Now()
+	is.NoErr(migrateSampleAssignments(db))
+	is.True(!db.Migrator().HasColumn(&models.Sample{}, "assigned_to"))
+
+	var sampleAnnotations []models.SampleAnnotation
+	is.NoErr(db.Order("sample_id").Find(&sampleAnnotations).Error)
+	is.Equal(len(sampleAnnotations), 2)
+
+	// the pending assignment gets a lease that has already expired
+	is.Equal(sampleAnnotations[0].SampleID, samples[0].ID)
+	is.Equal(sampleAnnotations[0].UserID, uint(1))
+	is.True(sampleAnnotations[0].LeaseExpiresAt.Valid)
+	is.True(!sampleAnnotations[0].LeaseExpiresAt.Time.After(time.Now()))
+	is.True(!sampleAnnotations[0].LeaseExpiresAt.Time.Before(before.Add(-time.Second)))
+
+	is.Equal(sampleAnnotations[1].SampleID, samples[1].ID)
+	is.Equal(sampleAnnotations[1].UserID, uint(2))
+	is.Equal(sampleAnnotations[1].Status, models.Accepted.ToNullString())
+	is.Equal(sampleAnnotations[1].Annotations, annotations)
+	is.True(!sampleAnnotations[1].LeaseExpiresAt.Valid)
+
+	// the samples are kept and running the migration again does nothing
+	var samplesCount int64
+	is.NoErr(db.Model(&models.Sample{}).Count(&samplesCount).Error)
+	is.Equal(samplesCount, int64(3))
+	is.NoErr(migrateSampleAssignments(db))
+}